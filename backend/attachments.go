@@ -0,0 +1,241 @@
+package main
+
+import (
+	"database/sql"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// SERVICES
+// ====================
+
+// AttachmentService keeps files attached to orders: reference images and
+// briefs from the client. Images go through the image pipeline, so the
+// admin screens can show thumbnails without loading the originals.
+type AttachmentService interface {
+	GetAttachments(orderID string) ([]Upload, error)
+	GetAttachment(id int) (*Upload, error)
+	AddAttachment(orderID, filename string, file io.Reader) (*Upload, error)
+	DeleteAttachment(id int) error
+	// FilePath is where the requested size of an attachment is stored.
+	FilePath(u *Upload, size string) (path, contentType string)
+}
+
+type attachmentService struct {
+	db       *sql.DB
+	root     string
+	pipeline *ImagePipeline
+}
+
+func NewAttachmentService(db *sql.DB, uploadDir string, pipeline *ImagePipeline) AttachmentService {
+	return &attachmentService{db: db, root: uploadDir, pipeline: pipeline}
+}
+
+func (s *attachmentService) GetAttachments(orderID string) ([]Upload, error) {
+	if _, err := NewOrderRepository(s.db).GetByID(orderID); err != nil {
+		return nil, err
+	}
+	return NewUploadRepository(s.db).GetByOwner("order", orderID)
+}
+
+func (s *attachmentService) GetAttachment(id int) (*Upload, error) {
+	u, err := NewUploadRepository(s.db).GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if u.OwnerType != "order" {
+		return nil, sql.ErrNoRows
+	}
+	return u, nil
+}
+
+func (s *attachmentService) AddAttachment(orderID, filename string, file io.Reader) (*Upload, error) {
+	if _, err := NewOrderRepository(s.db).GetByID(orderID); err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, maxUploadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	u, err := storeUpload(s.db, s.root, "order", orderID, filename, data, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Status == "pending" {
+		s.pipeline.Enqueue(u.ID)
+	}
+	return u, nil
+}
+
+func (s *attachmentService) DeleteAttachment(id int) error {
+	u, err := s.GetAttachment(id)
+	if err != nil {
+		return err
+	}
+	if err := NewUploadRepository(s.db).Delete(id); err != nil {
+		return err
+	}
+
+	removeUploadFiles(s.root, u)
+	return nil
+}
+
+func (s *attachmentService) FilePath(u *Upload, size string) (string, string) {
+	path, contentType := variantFile(u, size)
+	return filepath.Join(s.root, path), contentType
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type AttachmentHandler struct {
+	service AttachmentService
+}
+
+func NewAttachmentHandler(service AttachmentService) *AttachmentHandler {
+	return &AttachmentHandler{service: service}
+}
+
+func (h *AttachmentHandler) GetAttachments(c *gin.Context) {
+	uploads, err := h.service.GetAttachments(c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Order not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    uploads,
+	})
+}
+
+// AddAttachment takes the file from the multipart "file" field.
+func (h *AttachmentHandler) AddAttachment(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	defer f.Close()
+
+	upload, err := h.service.AddAttachment(c.Param("id"), file.Filename, f)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Order not found",
+		})
+		return
+	}
+	if err == ErrImageTooBig {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err == ErrUploadTooLarge {
+		c.JSON(http.StatusRequestEntityTooLarge, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, APIResponse{
+		Success: true,
+		Message: "Attachment uploaded successfully",
+		Data:    upload,
+	})
+}
+
+// DownloadAttachment serves the file. The size query picks a processed
+// variant (thumb, medium or large); the original is served otherwise, and
+// while the variants are still being made.
+func (h *AttachmentHandler) DownloadAttachment(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	upload, err := h.service.GetAttachment(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Attachment not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	path, contentType := h.service.FilePath(upload, c.Query("size"))
+	c.Header("Content-Type", contentType)
+	if c.Query("size") == "" || c.Query("size") == "original" {
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": upload.Filename}))
+	}
+	c.File(path)
+}
+
+func (h *AttachmentHandler) DeleteAttachment(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	err := h.service.DeleteAttachment(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Attachment not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Attachment deleted successfully",
+	})
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ====================
+// MODELS
+// ====================
+
+type User struct {
+	ID            string    `json:"id" db:"id"`
+	Username      string    `json:"username" db:"username"`
+	Name          string    `json:"name" db:"name"`
+	Email         string    `json:"email" db:"email"`
+	Role          string    `json:"role" db:"role"`
+	PasswordHash  string    `json:"-" db:"password_hash"`
+	CalendarToken string    `json:"-" db:"calendar_token"`
+	CreatedAt     time.Time `json:"createdAt" db:"created_at"`
+}
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type LoginResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	User      *User     `json:"user"`
+}
+
+// sessionTTL is how long a login token stays valid.
+const sessionTTL = 7 * 24 * time.Hour
+
+// Administrators manage the team and see all work; artists see what is
+// assigned to them.
+const (
+	roleAdministrator = "administrator"
+	roleArtist        = "artist"
+)
+
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// ====================
+// REPOSITORIES
+// ====================
+
+type UserRepository interface {
+	Count() (int, error)
+	GetAll() ([]User, error)
+	Create(user *User) error
+	GetByID(id string) (*User, error)
+	GetByUsername(username string) (*User, error)
+	GetByCalendarToken(token string) (*User, error)
+	SetCalendarToken(id, token string) error
+	CreateSession(token, userID string, expiresAt time.Time) error
+	GetBySession(token string, now time.Time) (*User, error)
+}
+
+type userRepository struct {
+	db DBTX
+}
+
+func NewUserRepository(db DBTX) UserRepository {
+	return &userRepository{db: db}
+}
+
+const userColumns = `id, username, name, email, role, password_hash, calendar_token, created_at`
+
+func scanUser(row rowScanner) (*User, error) {
+	var u User
+	err := row.Scan(&u.ID, &u.Username, &u.Name, &u.Email, &u.Role, &u.PasswordHash,
+		&u.CalendarToken, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+func (r *userRepository) Count() (int, error) {
+	var n int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&n)
+	return n, err
+}
+
+func (r *userRepository) GetAll() ([]User, error) {
+	rows, err := r.db.Query("SELECT " + userColumns + " FROM users ORDER BY name, username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+
+	return users, rows.Err()
+}
+
+func (r *userRepository) Create(user *User) error {
+	_, err := r.db.Exec(`
+		INSERT INTO users (id, username, name, email, role, password_hash, calendar_token, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, user.ID, user.Username, user.Name, user.Email, user.Role, user.PasswordHash,
+		user.CalendarToken, user.CreatedAt)
+
+	return err
+}
+
+func (r *userRepository) GetByID(id string) (*User, error) {
+	return scanUser(r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", id))
+}
+
+func (r *userRepository) GetByUsername(username string) (*User, error) {
+	return scanUser(r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE username = ?", username))
+}
+
+func (r *userRepository) GetByCalendarToken(token string) (*User, error) {
+	return scanUser(r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE calendar_token = ?", token))
+}
+
+func (r *userRepository) SetCalendarToken(id, token string) error {
+	result, err := r.db.Exec("UPDATE users SET calendar_token = ? WHERE id = ?", token, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *userRepository) CreateSession(token, userID string, expiresAt time.Time) error {
+	_, err := r.db.Exec(`
+		INSERT INTO sessions (token, user_id, expires_at, created_at) VALUES (?, ?, ?, ?)
+	`, token, userID, expiresAt, time.Now())
+
+	return err
+}
+
+func (r *userRepository) GetBySession(token string, now time.Time) (*User, error) {
+	var userID string
+	var expiresAt time.Time
+	err := r.db.QueryRow("SELECT user_id, expires_at FROM sessions WHERE token = ?", token).
+		Scan(&userID, &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if now.After(expiresAt) {
+		return nil, sql.ErrNoRows
+	}
+
+	return r.GetByID(userID)
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type AuthService interface {
+	EnsureAdmin(cfg AdminConfig) error
+	Login(req LoginRequest) (*LoginResponse, error)
+	Authenticate(sessionToken string) (*User, error)
+	UserForCalendar(calendarToken string) (*User, error)
+	RotateCalendarToken(userID string) (string, error)
+}
+
+type authService struct {
+	db *sql.DB
+}
+
+func NewAuthService(db *sql.DB) AuthService {
+	return &authService{db: db}
+}
+
+// EnsureAdmin creates the first account on an empty users table from the
+// admin config. There is no default password, so a fresh deploy never
+// starts with a known login; without one the server runs with no accounts
+// until ADMIN_PASSWORD is set and it is restarted.
+func (s *authService) EnsureAdmin(cfg AdminConfig) error {
+	repo := NewUserRepository(s.db)
+	n, err := repo.Count()
+	if err != nil || n > 0 {
+		return err
+	}
+
+	username := cfg.Username
+	if username == "" {
+		username = "admin"
+	}
+	if cfg.Password == "" {
+		log.Println("warning: no user accounts yet; set ADMIN_PASSWORD and restart to create the first administrator")
+		return nil
+	}
+
+	_, err = createUser(repo, username, "Administrator", studioEmail(), roleAdministrator, cfg.Password)
+	return err
+}
+
+func createUser(repo UserRepository, username, name, email, role, password string) (*User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	calendarToken, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	user := &User{
+		ID:            "USER-" + strconv.FormatInt(nextIDNano(), 10),
+		Username:      username,
+		Name:          name,
+		Email:         email,
+		Role:          role,
+		PasswordHash:  string(hash),
+		CalendarToken: calendarToken,
+		CreatedAt:     time.Now(),
+	}
+	if err := repo.Create(user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *authService) Login(req LoginRequest) (*LoginResponse, error) {
+	repo := NewUserRepository(s.db)
+	user, err := repo.GetByUsername(strings.TrimSpace(req.Username))
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(sessionTTL)
+	if err := repo.CreateSession(token, user.ID, expiresAt); err != nil {
+		return nil, err
+	}
+
+	return &LoginResponse{Token: token, ExpiresAt: expiresAt, User: user}, nil
+}
+
+func (s *authService) Authenticate(sessionToken string) (*User, error) {
+	return NewUserRepository(s.db).GetBySession(sessionToken, time.Now())
+}
+
+func (s *authService) UserForCalendar(calendarToken string) (*User, error) {
+	if calendarToken == "" {
+		return nil, sql.ErrNoRows
+	}
+	return NewUserRepository(s.db).GetByCalendarToken(calendarToken)
+}
+
+// RotateCalendarToken invalidates the user's current feed URL.
+func (s *authService) RotateCalendarToken(userID string) (string, error) {
+	token, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+	if err := NewUserRepository(s.db).SetCalendarToken(userID, token); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type AuthHandler struct {
+	service AuthService
+}
+
+func NewAuthHandler(service AuthService) *AuthHandler {
+	return &AuthHandler{service: service}
+}
+
+// RequireAuth rejects requests without a valid "Authorization: Bearer"
+// session token and stores the user under "user" for the handlers.
+func (h *AuthHandler) RequireAuth(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	user, err := h.service.Authenticate(token)
+	if err == sql.ErrNoRows {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "Authentication required",
+		})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.Set("user", user)
+	c.Next()
+}
+
+// RequireAdmin runs after RequireAuth and turns away everyone but
+// administrators.
+func (h *AuthHandler) RequireAdmin(c *gin.Context) {
+	if user := currentUser(c); user == nil || user.Role != roleAdministrator {
+		c.AbortWithStatusJSON(http.StatusForbidden, APIResponse{
+			Success: false,
+			Message: "Administrator access required",
+		})
+		return
+	}
+
+	c.Next()
+}
+
+func currentUser(c *gin.Context) *User {
+	user, _ := c.Get("user")
+	u, _ := user.(*User)
+	return u
+}
+
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	result, err := h.service.Login(req)
+	if err == ErrInvalidCredentials {
+		c.JSON(http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Login successful",
+		Data:    result,
+	})
+}
+
+func (h *AuthHandler) Me(c *gin.Context) {
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    currentUser(c),
+	})
+}
+
+// GetCalendarLink returns the signed-in user's private feed URL.
+func (h *AuthHandler) GetCalendarLink(c *gin.Context) {
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    gin.H{"url": calendarFeedURL(c, currentUser(c).CalendarToken)},
+	})
+}
+
+func (h *AuthHandler) RotateCalendarToken(c *gin.Context) {
+	token, err := h.service.RotateCalendarToken(currentUser(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Calendar link reset; the old link no longer works",
+		Data:    gin.H{"url": calendarFeedURL(c, token)},
+	})
+}
+
+func calendarFeedURL(c *gin.Context, token string) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + "/api/calendar.ics?token=" + token
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// ICALENDAR
+// ====================
+
+// calendarEvent is an all-day entry in the feed. Modified feeds DTSTAMP and
+// SEQUENCE so calendar apps pick up changes to an existing UID.
+type calendarEvent struct {
+	UID         string
+	Date        time.Time
+	Summary     string
+	Description string
+	Categories  string
+	Modified    time.Time
+}
+
+func writeICalendar(events []calendarEvent, now time.Time) []byte {
+	var b bytes.Buffer
+	line := func(s string) {
+		b.WriteString(foldICalLine(s))
+		b.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//" + invoiceBrandName + "//Studio Deadlines//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:" + escapeICalText(invoiceBrandName+" deadlines"))
+	for _, e := range events {
+		modified := e.Modified
+		if modified.IsZero() {
+			modified = now
+		}
+		line("BEGIN:VEVENT")
+		line("UID:" + e.UID)
+		line("DTSTAMP:" + modified.UTC().Format("20060102T150405Z"))
+		line("LAST-MODIFIED:" + modified.UTC().Format("20060102T150405Z"))
+		line(fmt.Sprintf("SEQUENCE:%d", modified.Unix()))
+		line("DTSTART;VALUE=DATE:" + e.Date.Format("20060102"))
+		line("DTEND;VALUE=DATE:" + e.Date.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY:" + escapeICalText(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION:" + escapeICalText(e.Description))
+		}
+		if e.Categories != "" {
+			line("CATEGORIES:" + escapeICalText(e.Categories))
+		}
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+
+	return b.Bytes()
+}
+
+func escapeICalText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// foldICalLine splits content lines longer than 75 octets as RFC 5545
+// requires, never inside a UTF-8 sequence.
+func foldICalLine(s string) string {
+	if len(s) <= 75 {
+		return s
+	}
+
+	var b strings.Builder
+	width := 0
+	for _, r := range s {
+		size := len(string(r))
+		if width+size > 75 {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type CalendarService interface {
+	Feed(user *User, now time.Time) ([]byte, error)
+}
+
+type calendarService struct {
+	db *sql.DB
+}
+
+func NewCalendarService(db *sql.DB) CalendarService {
+	return &calendarService{db: db}
+}
+
+// Feed lists the deadline of every open order and the due date of every
+// unfinished milestone; cancelled and completed work drops out of the feed.
+// Artists only see work assigned to them, administrators see everything.
+func (s *calendarService) Feed(user *User, now time.Time) ([]byte, error) {
+	mine := func(assigneeID string) bool {
+		return user.Role == roleAdministrator || assigneeID == user.ID
+	}
+
+	orders, err := NewOrderRepository(s.db).GetOpenWithDeadline()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []calendarEvent
+	for _, o := range orders {
+		if !mine(o.AssigneeID) {
+			continue
+		}
+		summary := fmt.Sprintf("Due: %s (%s)", o.ProjectTitle, o.ClientName)
+		if o.DeadlineStatus == "overdue" {
+			summary = "OVERDUE " + summary
+		}
+		events = append(events, calendarEvent{
+			UID:     "order-" + o.ID + "@" + strings.ToLower(invoiceBrandName),
+			Date:    *o.DeadlineAt,
+			Summary: summary,
+			Description: fmt.Sprintf("Order %s\nStatus: %s\nPriority: %s\nClient: %s <%s>",
+				o.ID, o.Status, o.Priority, o.ClientName, o.Email),
+			Categories: o.Status,
+			Modified:   o.UpdatedAt,
+		})
+	}
+
+	milestones, err := NewMilestoneRepository(s.db).GetOpenWithDueDate()
+	if err != nil {
+		return nil, err
+	}
+	projects := map[int]*Project{}
+	for _, m := range milestones {
+		project, ok := projects[m.ProjectID]
+		if !ok {
+			if project, err = NewProjectRepository(s.db).GetByID(m.ProjectID); err != nil && err != sql.ErrNoRows {
+				return nil, err
+			}
+			projects[m.ProjectID] = project
+		}
+		if project == nil || !mine(project.AssigneeID) {
+			continue
+		}
+
+		done := 0
+		for _, t := range m.Tasks {
+			if t.Done {
+				done++
+			}
+		}
+		events = append(events, calendarEvent{
+			UID:     fmt.Sprintf("milestone-%d@%s", m.ID, strings.ToLower(invoiceBrandName)),
+			Date:    *m.DueDate,
+			Summary: fmt.Sprintf("%s: %s (%s)", m.Name, project.ProjectTitle, project.ClientName),
+			Description: fmt.Sprintf("Project %d milestone\nTasks done: %d of %d",
+				project.ID, done, len(m.Tasks)),
+			Categories: "milestone",
+			Modified:   m.UpdatedAt,
+		})
+	}
+
+	return writeICalendar(events, now), nil
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type CalendarHandler struct {
+	service CalendarService
+	auth    AuthService
+}
+
+func NewCalendarHandler(service CalendarService, auth AuthService) *CalendarHandler {
+	return &CalendarHandler{service: service, auth: auth}
+}
+
+// GetFeed authenticates with the user's calendar token in the query string,
+// since calendar apps subscribe by URL and cannot send headers.
+func (h *CalendarHandler) GetFeed(c *gin.Context) {
+	user, err := h.auth.UserForCalendar(c.Query("token"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "Invalid calendar token",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	feed, err := h.service.Feed(user, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", `inline; filename="calendar.ics"`)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", feed)
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ====================
+// CONFIG
+// ====================
+
+// Config is every setting the server reads at start-up. Values come from
+// the defaults, then the YAML or TOML file named by CONFIG_FILE, then the
+// environment variable in each field's env tag, each overriding the last.
+type Config struct {
+	ListenAddr  string `yaml:"listenAddr" toml:"listenAddr" env:"LISTEN_ADDR"`
+	DatabaseDSN string `yaml:"databaseDsn" toml:"databaseDsn" env:"DATABASE_DSN"`
+	// Proxies whose X-Forwarded-For is believed; none by default, so
+	// clients can't pick the IP their rate limits count against
+	TrustedProxies []string `yaml:"trustedProxies" toml:"trustedProxies" env:"TRUSTED_PROXIES"`
+	LogLevel       string   `yaml:"logLevel" toml:"logLevel" env:"LOG_LEVEL"`
+	// DevMode allows the stand-ins meant for local setups and tests, such
+	// as the fake payment gateway; never turn it on in production
+	DevMode bool `yaml:"devMode" toml:"devMode" env:"DEV_MODE"`
+
+	UploadDir        string `yaml:"uploadDir" toml:"uploadDir" env:"UPLOAD_DIR"`
+	PublicBaseURL    string `yaml:"publicBaseUrl" toml:"publicBaseUrl" env:"PUBLIC_BASE_URL"`
+	StudioEmail      string `yaml:"studioEmail" toml:"studioEmail" env:"STUDIO_EMAIL"`
+	PricingRulesFile string `yaml:"pricingRulesFile" toml:"pricingRulesFile" env:"PRICING_RULES_FILE"`
+
+	CORS        CORSConfig       `yaml:"cors" toml:"cors"`
+	Admin       AdminConfig      `yaml:"admin" toml:"admin"`
+	SMTP        SMTPConfig       `yaml:"smtp" toml:"smtp"`
+	Payments    PaymentConfig    `yaml:"payments" toml:"payments"`
+	Watermark   WatermarkConfig  `yaml:"watermark" toml:"watermark"`
+	Captcha     CaptchaConfig    `yaml:"captcha" toml:"captcha"`
+	OrderLimits SubmissionLimits `yaml:"orderLimits" toml:"orderLimits"`
+	RateLimits  RateLimits       `yaml:"rateLimits" toml:"rateLimits"`
+}
+
+// AdminConfig is the first account, created on an empty users table.
+type AdminConfig struct {
+	Username string `yaml:"username" toml:"username" env:"ADMIN_USERNAME"`
+	Password string `yaml:"password" toml:"password" env:"ADMIN_PASSWORD"`
+}
+
+// SMTPConfig sends mail through Host when it is set; without one, mail is
+// printed to stdout.
+type SMTPConfig struct {
+	Host     string `yaml:"host" toml:"host" env:"SMTP_HOST"`
+	Port     string `yaml:"port" toml:"port" env:"SMTP_PORT"`
+	Username string `yaml:"username" toml:"username" env:"SMTP_USERNAME"`
+	Password string `yaml:"password" toml:"password" env:"SMTP_PASSWORD"`
+	From     string `yaml:"from" toml:"from" env:"SMTP_FROM"`
+}
+
+type PaymentConfig struct {
+	// stripe, or fake in dev mode; without one, online checkout is off
+	Gateway             string `yaml:"gateway" toml:"gateway" env:"PAYMENT_GATEWAY"`
+	StripeSecretKey     string `yaml:"stripeSecretKey" toml:"stripeSecretKey" env:"STRIPE_SECRET_KEY"`
+	StripeWebhookSecret string `yaml:"stripeWebhookSecret" toml:"stripeWebhookSecret" env:"STRIPE_WEBHOOK_SECRET"`
+	StripeAPIBase       string `yaml:"stripeApiBase" toml:"stripeApiBase" env:"STRIPE_API_BASE"`
+	FakeGatewaySecret   string `yaml:"fakeGatewaySecret" toml:"fakeGatewaySecret" env:"FAKE_GATEWAY_SECRET"`
+	SuccessURL          string `yaml:"successUrl" toml:"successUrl" env:"CHECKOUT_SUCCESS_URL"`
+	CancelURL           string `yaml:"cancelUrl" toml:"cancelUrl" env:"CHECKOUT_CANCEL_URL"`
+	// New orders need DepositPercent of their final price paid before they
+	// can move to "in-progress", unless RequireDeposit is off; staff can
+	// still change it per order
+	DepositPercent float64 `yaml:"depositPercent" toml:"depositPercent" env:"DEPOSIT_PERCENT"`
+	RequireDeposit bool    `yaml:"requireDeposit" toml:"requireDeposit" env:"REQUIRE_DEPOSIT"`
+}
+
+type WatermarkConfig struct {
+	Text           string  `yaml:"text" toml:"text" env:"WATERMARK_TEXT"`
+	Logo           string  `yaml:"logo" toml:"logo" env:"WATERMARK_LOGO"` // a PNG or JPEG file
+	Opacity        float64 `yaml:"opacity" toml:"opacity" env:"WATERMARK_OPACITY"`
+	Tiled          bool    `yaml:"tiled" toml:"tiled" env:"WATERMARK_TILED"`
+	PreviewMaxEdge int     `yaml:"previewMaxEdge" toml:"previewMaxEdge" env:"PREVIEW_MAX_EDGE"`
+}
+
+// CaptchaConfig turns captcha checks on the order form on when Provider is
+// set: recaptcha, hcaptcha, turnstile, or fake, which accepts FakeToken.
+type CaptchaConfig struct {
+	Provider  string `yaml:"provider" toml:"provider" env:"CAPTCHA_PROVIDER"`
+	Secret    string `yaml:"secret" toml:"secret" env:"CAPTCHA_SECRET"`
+	VerifyURL string `yaml:"verifyUrl" toml:"verifyUrl" env:"CAPTCHA_VERIFY_URL"`
+	FakeToken string `yaml:"fakeToken" toml:"fakeToken" env:"FAKE_CAPTCHA_TOKEN"`
+}
+
+// Duration reads as a Go duration string such as "30m" from files and the
+// environment alike.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func defaultConfig() Config {
+	watermark := defaultWatermarkSettings()
+	return Config{
+		ListenAddr:    ":8080",
+		DatabaseDSN:   "./projects.db",
+		LogLevel:      "info",
+		CORS:          defaultCORSConfig(),
+		UploadDir:     "uploads",
+		PublicBaseURL: "http://localhost:5173",
+		StudioEmail:   "studio@localhost",
+		SMTP:          SMTPConfig{Port: "587", From: "studio@localhost"},
+		Payments: PaymentConfig{
+			SuccessURL:     "http://localhost:5173/payment/success",
+			CancelURL:      "http://localhost:5173/payment/cancelled",
+			DepositPercent: 50,
+			RequireDeposit: true,
+		},
+		Watermark: WatermarkConfig{
+			Text:           watermark.Text,
+			Opacity:        watermark.Opacity,
+			Tiled:          watermark.Tiled,
+			PreviewMaxEdge: watermark.PreviewEdge,
+		},
+		OrderLimits: defaultSubmissionLimits(),
+		RateLimits:  defaultRateLimits(),
+	}
+}
+
+var logLevels = map[string]bool{"debug": true, "info": true, "warn": true, "error": true}
+
+// appConfig backs the few helpers that are called too deep to be handed the
+// config: uploadDir, studioEmail, publicLink and the deposit rules. main
+// sets it once.
+var appConfig = defaultConfig()
+
+// loadConfig builds the config and checks it, listing every problem at
+// once rather than stopping at the first.
+func loadConfig() (Config, error) {
+	cfg := defaultConfig()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := cfg.readFile(path); err != nil {
+			return cfg, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(&cfg).Elem()); err != nil {
+		return cfg, err
+	}
+
+	if err := cfg.validate(); err != nil {
+		return cfg, err
+	}
+	cfg.normalize()
+	return cfg, nil
+}
+
+func (cfg *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(cfg)
+		// An empty file is fine; it just changes nothing
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		return err
+	case ".toml":
+		return toml.NewDecoder(bytes.NewReader(data)).DisallowUnknownFields().Decode(cfg)
+	default:
+		return errors.New("must end in .yaml, .yml or .toml")
+	}
+}
+
+// applyEnv overlays every set environment variable named in an env tag,
+// walking nested sections. Lists are comma-separated.
+func applyEnv(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+		name := field.Tag.Get("env")
+		if name == "" {
+			if field.Type.Kind() == reflect.Struct {
+				if err := applyEnv(value); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		raw := strings.TrimSpace(os.Getenv(name))
+		if raw == "" {
+			continue
+		}
+		if err := setFromString(value, raw); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setFromString(v reflect.Value, raw string) error {
+	if v.Type() == reflect.TypeOf(Duration(0)) {
+		return v.Addr().Interface().(*Duration).UnmarshalText([]byte(raw))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", raw)
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", raw)
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+func (cfg *Config) validate() error {
+	var problems []string
+	problem := func(key, env, format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf("%s (%s): %s", key, env, fmt.Sprintf(format, args...)))
+	}
+
+	if _, port, err := net.SplitHostPort(cfg.ListenAddr); err != nil || port == "" {
+		problem("listenAddr", "LISTEN_ADDR", "%q is not a host:port address such as \":8080\"", cfg.ListenAddr)
+	}
+	if strings.TrimSpace(cfg.DatabaseDSN) == "" {
+		problem("databaseDsn", "DATABASE_DSN", "must not be empty")
+	}
+	for _, origin := range cfg.CORS.AllowedOrigins {
+		switch {
+		case origin == "*":
+			if cfg.CORS.AllowCredentials {
+				problem("cors.allowedOrigins", "CORS_ALLOWED_ORIGINS", "\"*\" can't be used with cors.allowCredentials")
+			}
+		case !isOrigin(strings.Replace(origin, "://*.", "://", 1)):
+			problem("cors.allowedOrigins", "CORS_ALLOWED_ORIGINS", "%q is not an origin such as https://example.com or https://*.example.com", origin)
+		}
+	}
+	if cfg.CORS.MaxAge < 0 {
+		problem("cors.maxAge", "CORS_MAX_AGE", "must not be negative")
+	}
+	for _, proxy := range cfg.TrustedProxies {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		if net.ParseIP(proxy) == nil && cidrErr != nil {
+			problem("trustedProxies", "TRUSTED_PROXIES", "%q is not an IP address or CIDR range", proxy)
+		}
+	}
+	if !logLevels[cfg.LogLevel] {
+		problem("logLevel", "LOG_LEVEL", "%q must be debug, info, warn or error", cfg.LogLevel)
+	}
+
+	if strings.TrimSpace(cfg.UploadDir) == "" {
+		problem("uploadDir", "UPLOAD_DIR", "must not be empty")
+	}
+	if u, err := url.Parse(cfg.PublicBaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		problem("publicBaseUrl", "PUBLIC_BASE_URL", "%q is not an absolute URL", cfg.PublicBaseURL)
+	}
+	if _, err := mail.ParseAddress(cfg.StudioEmail); err != nil {
+		problem("studioEmail", "STUDIO_EMAIL", "%q is not an email address", cfg.StudioEmail)
+	}
+
+	if cfg.Admin.Password != "" && len(cfg.Admin.Password) < 8 {
+		problem("admin.password", "ADMIN_PASSWORD", "must be at least 8 characters")
+	}
+
+	if cfg.SMTP.Host != "" {
+		if port, err := strconv.Atoi(cfg.SMTP.Port); err != nil || port < 1 || port > 65535 {
+			problem("smtp.port", "SMTP_PORT", "%q is not a port number", cfg.SMTP.Port)
+		}
+		if _, err := mail.ParseAddress(cfg.SMTP.From); err != nil {
+			problem("smtp.from", "SMTP_FROM", "%q is not an email address", cfg.SMTP.From)
+		}
+	}
+
+	switch cfg.Payments.Gateway {
+	case "":
+	case "fake":
+		// Anyone who knows the secret can forge a payment, so the fake
+		// gateway needs one of its own and stays out of production
+		if !cfg.DevMode {
+			problem("payments.gateway", "PAYMENT_GATEWAY", "fake is only allowed with devMode (DEV_MODE); use stripe")
+		}
+		if cfg.Payments.FakeGatewaySecret == "" {
+			problem("payments.fakeGatewaySecret", "FAKE_GATEWAY_SECRET", "is required for the fake gateway")
+		}
+	case "stripe":
+		if cfg.Payments.StripeSecretKey == "" || cfg.Payments.StripeWebhookSecret == "" {
+			problem("payments", "STRIPE_SECRET_KEY, STRIPE_WEBHOOK_SECRET", "both are required for the stripe gateway")
+		}
+	default:
+		problem("payments.gateway", "PAYMENT_GATEWAY", "%q must be stripe or fake", cfg.Payments.Gateway)
+	}
+
+	if cfg.Payments.DepositPercent < 0 || cfg.Payments.DepositPercent > 100 {
+		problem("payments.depositPercent", "DEPOSIT_PERCENT", "%v must be between 0 and 100", cfg.Payments.DepositPercent)
+	}
+
+	if cfg.Watermark.Opacity <= 0 || cfg.Watermark.Opacity > 1 {
+		problem("watermark.opacity", "WATERMARK_OPACITY", "%v must be above 0 and at most 1", cfg.Watermark.Opacity)
+	}
+	if cfg.Watermark.PreviewMaxEdge < 64 {
+		problem("watermark.previewMaxEdge", "PREVIEW_MAX_EDGE", "%d must be at least 64", cfg.Watermark.PreviewMaxEdge)
+	}
+
+	switch provider := cfg.Captcha.Provider; {
+	case provider == "" || provider == "fake":
+	case captchaVerifyURLs[provider] == "":
+		problem("captcha.provider", "CAPTCHA_PROVIDER", "%q must be recaptcha, hcaptcha, turnstile or fake", provider)
+	case cfg.Captcha.Secret == "":
+		problem("captcha.secret", "CAPTCHA_SECRET", "is required for %s", provider)
+	}
+
+	if cfg.OrderLimits.PerIP < 1 {
+		problem("orderLimits.perIp", "ORDER_LIMIT_PER_IP", "must be at least 1")
+	}
+	if cfg.OrderLimits.PerEmail < 1 {
+		problem("orderLimits.perEmail", "ORDER_LIMIT_PER_EMAIL", "must be at least 1")
+	}
+	if cfg.OrderLimits.Window <= 0 {
+		problem("orderLimits.window", "ORDER_LIMIT_WINDOW", "must be a positive duration such as 1h")
+	}
+	for group, limit := range cfg.RateLimits {
+		if limit.PerMinute < 0 || limit.Burst < 0 {
+			problems = append(problems, fmt.Sprintf("rateLimits.%s: perMinute and burst must not be negative", group))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New("invalid configuration:\n  " + strings.Join(problems, "\n  "))
+}
+
+// normalize fills in values derived from others once the config is valid.
+func (cfg *Config) normalize() {
+	cfg.PublicBaseURL = strings.TrimRight(cfg.PublicBaseURL, "/")
+	for group, limit := range cfg.RateLimits {
+		// Without a burst nothing could ever get through
+		if limit.PerMinute > 0 && limit.Burst == 0 {
+			limit.Burst = max(1, int(limit.PerMinute))
+			cfg.RateLimits[group] = limit
+		}
+	}
+}
+
+// isOrigin reports whether s is a bare scheme://host[:port].
+func isOrigin(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		(u.Path == "" || u.Path == "/") && u.RawQuery == "" && u.Fragment == ""
+}
+
+// newRouter sets up the gin engine for cfg: request logs only at debug and
+// info, and client IPs taken from X-Forwarded-For only behind a trusted proxy.
+func newRouter(cfg Config) (*gin.Engine, error) {
+	if cfg.LogLevel == "debug" {
+		gin.SetMode(gin.DebugMode)
+	} else {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	r := gin.New()
+	if cfg.LogLevel == "debug" || cfg.LogLevel == "info" {
+		r.Use(gin.Logger())
+	}
+	r.Use(gin.Recovery())
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
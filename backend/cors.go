@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// CORS
+// ====================
+
+// CORSConfig decides which browser origins may call the API. An origin may
+// start its host with "*." to allow every subdomain, such as the Vercel
+// preview deploys; "*" alone allows any origin but not with credentials.
+type CORSConfig struct {
+	AllowedOrigins   []string `yaml:"allowedOrigins" toml:"allowedOrigins" env:"CORS_ALLOWED_ORIGINS"`
+	AllowCredentials bool     `yaml:"allowCredentials" toml:"allowCredentials" env:"CORS_ALLOW_CREDENTIALS"`
+	AllowedHeaders   []string `yaml:"allowedHeaders" toml:"allowedHeaders" env:"CORS_ALLOWED_HEADERS"`
+	// Response headers the frontend may read besides the simple ones
+	ExposedHeaders []string `yaml:"exposedHeaders" toml:"exposedHeaders" env:"CORS_EXPOSED_HEADERS"`
+	// How long browsers may cache a preflight answer
+	MaxAge Duration `yaml:"maxAge" toml:"maxAge" env:"CORS_MAX_AGE"`
+}
+
+func defaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedOrigins:   []string{"https://alle.noxturne.my.id", "http://localhost:5173"},
+		AllowCredentials: true,
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", idempotencyHeader, "X-Requested-With"},
+		ExposedHeaders: []string{
+			"Content-Disposition", "Retry-After", "Idempotent-Replayed",
+			"RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset",
+		},
+		MaxAge: Duration(10 * time.Minute),
+	}
+}
+
+const corsAllowedMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+
+// CORS answers preflights and adds the CORS headers to allowed origins.
+// Requests from other origins still run, since a browser's same-origin
+// policy is what keeps their responses from the page, but get no headers.
+type CORS struct {
+	anyOrigin     bool
+	origins       map[string]bool
+	subdomains    []originPattern
+	credentials   bool
+	allowHeaders  string
+	exposeHeaders string
+	maxAge        string
+}
+
+// originPattern is a "scheme://*.host" origin split around the star.
+type originPattern struct {
+	prefix, suffix string
+}
+
+func NewCORS(cfg CORSConfig) *CORS {
+	p := &CORS{
+		origins:       map[string]bool{},
+		credentials:   cfg.AllowCredentials,
+		allowHeaders:  strings.Join(cfg.AllowedHeaders, ", "),
+		exposeHeaders: strings.Join(cfg.ExposedHeaders, ", "),
+		maxAge:        strconv.Itoa(int(time.Duration(cfg.MaxAge).Seconds())),
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimRight(origin, "/"))
+		if origin == "*" {
+			p.anyOrigin = true
+		} else if i := strings.Index(origin, "://*."); i >= 0 {
+			p.subdomains = append(p.subdomains, originPattern{prefix: origin[:i+3], suffix: origin[i+4:]})
+		} else {
+			p.origins[origin] = true
+		}
+	}
+	return p
+}
+
+func (p *CORS) allows(origin string) bool {
+	origin = strings.ToLower(origin)
+	if p.anyOrigin || p.origins[origin] {
+		return true
+	}
+	for _, pattern := range p.subdomains {
+		if len(origin) > len(pattern.prefix)+len(pattern.suffix) &&
+			strings.HasPrefix(origin, pattern.prefix) && strings.HasSuffix(origin, pattern.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle goes first in the chain, so rate-limited and failed responses
+// carry the headers too and the frontend can read why.
+func (p *CORS) Handle(c *gin.Context) {
+	origin := c.GetHeader("Origin")
+	preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+	// The answer depends on the origin, so caches must keep them apart
+	c.Writer.Header().Add("Vary", "Origin")
+	if preflight {
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+	}
+
+	if origin != "" && p.allows(origin) {
+		if p.anyOrigin && !p.credentials {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if p.credentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+		if p.exposeHeaders != "" {
+			c.Header("Access-Control-Expose-Headers", p.exposeHeaders)
+		}
+	} else if preflight {
+		c.AbortWithStatusJSON(http.StatusForbidden, APIResponse{
+			Success: false,
+			Message: "Origin not allowed",
+		})
+		return
+	}
+
+	if c.Request.Method == http.MethodOptions {
+		if preflight {
+			c.Header("Access-Control-Allow-Methods", corsAllowedMethods)
+			c.Header("Access-Control-Allow-Headers", p.allowHeaders)
+			c.Header("Access-Control-Max-Age", p.maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+
+	c.Next()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func corsTestRouter(cfg CORSConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(NewCORS(cfg).Handle)
+	r.GET("/api/orders", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	return r
+}
+
+func corsRequest(r *gin.Engine, method, origin string, preflight bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/api/orders", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if preflight {
+		req.Header.Set("Access-Control-Request-Method", "GET")
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSAllowlist(t *testing.T) {
+	r := corsTestRouter(CORSConfig{
+		AllowedOrigins:   []string{"https://alle.example.com/", "https://*.vercel.app"},
+		AllowCredentials: true,
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		MaxAge:           Duration(10 * time.Minute),
+	})
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://alle.example.com", true},
+		{"HTTPS://Alle.Example.com", true},
+		{"https://preview-123.vercel.app", true},
+		{"https://a.b.vercel.app", true},
+		{"https://vercel.app", false},
+		{"https://.vercel.app", false},
+		{"http://preview-123.vercel.app", false},
+		{"https://evil-vercel.app", false},
+		{"https://alle.example.com.evil.com", false},
+		{"https://evil.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			w := corsRequest(r, http.MethodGet, tt.origin, false)
+			if w.Code != http.StatusOK {
+				t.Errorf("GET status = %d, want 200", w.Code)
+			}
+			got := w.Header().Get("Access-Control-Allow-Origin")
+			if tt.allowed && (got != tt.origin || w.Header().Get("Access-Control-Allow-Credentials") != "true") {
+				t.Errorf("GET allow-origin = %q, want %q with credentials", got, tt.origin)
+			}
+			if !tt.allowed && got != "" {
+				t.Errorf("GET allow-origin = %q, want none", got)
+			}
+
+			w = corsRequest(r, http.MethodOptions, tt.origin, true)
+			switch {
+			case tt.allowed && w.Code != http.StatusNoContent:
+				t.Errorf("preflight status = %d, want 204", w.Code)
+			case !tt.allowed && w.Code != http.StatusForbidden:
+				t.Errorf("preflight status = %d, want 403", w.Code)
+			case tt.allowed && w.Header().Get("Access-Control-Max-Age") != "600":
+				t.Errorf("preflight max-age = %q, want 600", w.Header().Get("Access-Control-Max-Age"))
+			}
+		})
+	}
+
+	// Requests without an Origin are not cross-origin at all
+	if w := corsRequest(r, http.MethodGet, "", false); w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("same-origin GET = %d with allow-origin %q", w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	r := corsTestRouter(CORSConfig{AllowedOrigins: []string{"*"}})
+	w := corsRequest(r, http.MethodGet, "https://anywhere.example", false)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("allow-origin = %q, want *", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("allow-credentials = %q, want none", got)
+	}
+}
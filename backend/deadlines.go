@@ -0,0 +1,337 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// DEADLINES
+// ====================
+
+const (
+	// Open orders due within atRiskDays are flagged "at-risk"; reminders go
+	// out reminderDaysBefore the deadline.
+	atRiskDays            = 3
+	reminderDaysBefore    = 2
+	deadlineCheckInterval = 15 * time.Minute
+	defaultDueWithin      = 7 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidDeadline = errors.New("deadline must be a date such as 2006-01-02")
+	ErrInvalidWithin   = errors.New("within must look like 7d or 48h")
+)
+
+// deadlineLayouts are tried in order. The order form sends ISO dates; the
+// rest cover what older rows were typed in as.
+var deadlineLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006/01/02",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+}
+
+// Deadlines are calendar dates, kept as midnight UTC of the date written,
+// whatever zone it was written in.
+
+// parseDeadline turns a free-form deadline into a date, or nil when it is
+// empty or cannot be read.
+func parseDeadline(s string) *time.Time {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+
+	for _, layout := range deadlineLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			// The date as written: 23:30 on the 5th at +07:00 is still the 5th
+			t = calendarDate(t)
+			return &t
+		}
+	}
+	return nil
+}
+
+// calendarDate is t's date in t's own zone, as midnight UTC.
+func calendarDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// daysUntil counts calendar days from today to the deadline's date;
+// negative once it has passed. Today is the date where now is, normally the
+// studio's local zone, and both dates are compared as midnight UTC.
+func daysUntil(deadline, now time.Time) int {
+	due := calendarDate(deadline.UTC())
+	today := calendarDate(now)
+	return int(due.Sub(today).Hours() / 24)
+}
+
+var openOrderStatuses = map[string]bool{
+	"pending":     true,
+	"in-progress": true,
+	"on-hold":     true,
+}
+
+// deadlineState is "overdue", "at-risk" or "on-track" for open orders with
+// a deadline and empty otherwise.
+func deadlineState(o *Order, now time.Time) string {
+	if o.DeadlineAt == nil || !openOrderStatuses[o.Status] {
+		return ""
+	}
+
+	switch days := daysUntil(*o.DeadlineAt, now); {
+	case days < 0:
+		return "overdue"
+	case days <= atRiskDays:
+		return "at-risk"
+	default:
+		return "on-track"
+	}
+}
+
+// backfillDeadlines parses deadline strings saved before deadline_at
+// existed. Rows that cannot be parsed stay NULL.
+func backfillDeadlines(db *sql.DB, table string) error {
+	rows, err := db.Query("SELECT id, deadline FROM " + table +
+		" WHERE deadline_at IS NULL AND deadline IS NOT NULL AND deadline != ''")
+	if err != nil {
+		return err
+	}
+
+	parsed := map[interface{}]time.Time{}
+	for rows.Next() {
+		var id interface{}
+		var deadline string
+		if err := rows.Scan(&id, &deadline); err != nil {
+			rows.Close()
+			return err
+		}
+		if t := parseDeadline(deadline); t != nil {
+			parsed[id] = *t
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, t := range parsed {
+		if _, err := db.Exec("UPDATE "+table+" SET deadline_at = ? WHERE id = ?", t, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseWithin reads durations like "7d", "48h" or a bare number of days.
+func parseWithin(s string) (time.Duration, error) {
+	if s == "" {
+		return defaultDueWithin, nil
+	}
+	if days, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil && days >= 0 {
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return d, nil
+	}
+	return 0, ErrInvalidWithin
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type DeadlineService interface {
+	GetDueOrders(within time.Duration) ([]map[string]interface{}, error)
+	RefreshDeadlineStatuses(now time.Time) error
+	SendReminders(now time.Time) error
+}
+
+type deadlineService struct {
+	db     *sql.DB
+	mailer Mailer
+}
+
+func NewDeadlineService(db *sql.DB, mailer Mailer) DeadlineService {
+	return &deadlineService{db: db, mailer: mailer}
+}
+
+// GetDueOrders lists open orders due before now+within, overdue ones
+// included, soonest first.
+func (s *deadlineService) GetDueOrders(within time.Duration) ([]map[string]interface{}, error) {
+	orders, err := NewOrderRepository(s.db).GetOpenWithDeadline()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	cutoff := daysUntil(now.Add(within), now)
+	result := []map[string]interface{}{}
+	for _, o := range orders {
+		days := daysUntil(*o.DeadlineAt, now)
+		if days > cutoff {
+			break
+		}
+		m := orderToMap(o)
+		m["daysLeft"] = days
+		result = append(result, m)
+	}
+
+	return result, nil
+}
+
+// RefreshDeadlineStatuses re-derives the flag on every open order and
+// clears it on orders that have since been closed.
+func (s *deadlineService) RefreshDeadlineStatuses(now time.Time) error {
+	repo := NewOrderRepository(s.db)
+	orders, err := repo.GetOpenWithDeadline()
+	if err != nil {
+		return err
+	}
+
+	for i := range orders {
+		o := &orders[i]
+		if state := deadlineState(o, now); state != o.DeadlineStatus {
+			if err := repo.SetDeadlineStatus(o.ID, state); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE orders SET deadline_status = ''
+		WHERE deadline_status != '' AND status NOT IN ('pending', 'in-progress', 'on-hold')
+	`)
+	return err
+}
+
+// SendReminders mails one reminder per order and deadline once the order is
+// within reminderDaysBefore of it. Moving the deadline re-arms the reminder.
+func (s *deadlineService) SendReminders(now time.Time) error {
+	orders, err := NewOrderRepository(s.db).GetOpenWithDeadline()
+	if err != nil {
+		return err
+	}
+
+	for i := range orders {
+		o := &orders[i]
+		days := daysUntil(*o.DeadlineAt, now)
+		if days < 0 || days > reminderDaysBefore {
+			continue
+		}
+		// One bad address or mail server hiccup shouldn't cost the
+		// other orders their reminder
+		if err := s.remind(o, days, now); err != nil {
+			log.Printf("deadlines: remind %s: %v", o.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// remind claims the reminder before sending it, so a second run never mails
+// twice, and gives the claim back if the mail fails so the next run retries.
+func (s *deadlineService) remind(o *Order, days int, now time.Time) error {
+	result, err := s.db.Exec(`
+		INSERT OR IGNORE INTO deadline_reminders (order_id, deadline_at, sent_at) VALUES (?, ?, ?)
+	`, o.ID, *o.DeadlineAt, now)
+	if err != nil {
+		return err
+	}
+	if inserted, _ := result.RowsAffected(); inserted == 0 {
+		return nil
+	}
+
+	if err := s.mailer.Send(reminderMail(o, days, reminderRecipient(s.db, o))); err != nil {
+		if _, delErr := s.db.Exec("DELETE FROM deadline_reminders WHERE order_id = ? AND deadline_at = ?",
+			o.ID, *o.DeadlineAt); delErr != nil {
+			log.Printf("deadlines: release reminder for %s: %v", o.ID, delErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// reminderRecipient is the assigned artist, or the studio inbox while the
+// order is unassigned.
+func reminderRecipient(db DBTX, o *Order) string {
+	if o.AssigneeID != "" {
+		if user, err := NewUserRepository(db).GetByID(o.AssigneeID); err == nil && user.Email != "" {
+			return user.Email
+		}
+	}
+	return studioEmail()
+}
+
+func reminderMail(o *Order, days int, to string) Mail {
+	when := fmt.Sprintf("in %d days", days)
+	switch days {
+	case 0:
+		when = "today"
+	case 1:
+		when = "tomorrow"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%q for %s is due %s (%s).\n\n", o.ProjectTitle, o.ClientName, when,
+		o.DeadlineAt.Format("Monday 2 January 2006"))
+	fmt.Fprintf(&b, "Order: %s\nStatus: %s\nPriority: %s\n", o.ID, o.Status, o.Priority)
+
+	return Mail{
+		To:      to,
+		Subject: fmt.Sprintf("Deadline %s: %s", when, o.ProjectTitle),
+		Body:    b.String(),
+	}
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type DeadlineHandler struct {
+	service DeadlineService
+}
+
+func NewDeadlineHandler(service DeadlineService) *DeadlineHandler {
+	return &DeadlineHandler{service: service}
+}
+
+func (h *DeadlineHandler) GetDueOrders(c *gin.Context) {
+	within, err := parseWithin(c.Query("within"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	orders, err := h.service.GetDueOrders(within)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    orders,
+	})
+}
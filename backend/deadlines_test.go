@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDeadline(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // empty means nil
+	}{
+		{"", ""},
+		{"   ", ""},
+		{"2026-03-05", "2026-03-05"},
+		{" 2026-03-05 ", "2026-03-05"},
+		{"2026-03-05T23:30:00+07:00", "2026-03-05"},
+		{"2026-03-05T01:00:00+07:00", "2026-03-05"},
+		{"2026-03-05T22:00:00-05:00", "2026-03-05"},
+		{"2026-03-05 10:00:00", "2026-03-05"},
+		{"2026/03/05", "2026-03-05"},
+		{"March 5, 2026", "2026-03-05"},
+		{"Mar 5, 2026", "2026-03-05"},
+		{"5 March 2026", "2026-03-05"},
+		{"5 Mar 2026", "2026-03-05"},
+		{"next friday", ""},
+		{"2026-13-01", ""},
+	}
+	for _, tt := range tests {
+		got := parseDeadline(tt.in)
+		switch {
+		case tt.want == "" && got != nil:
+			t.Errorf("parseDeadline(%q) = %v, want nil", tt.in, *got)
+		case tt.want != "" && got == nil:
+			t.Errorf("parseDeadline(%q) = nil, want %s", tt.in, tt.want)
+		case got != nil && got.Format("2006-01-02") != tt.want:
+			t.Errorf("parseDeadline(%q) = %s, want %s", tt.in, got.Format("2006-01-02"), tt.want)
+		case got != nil && got.Location() != time.UTC:
+			t.Errorf("parseDeadline(%q) is in %v, want UTC", tt.in, got.Location())
+		}
+	}
+}
+
+func TestDeadlineState(t *testing.T) {
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	day := func(offset int) *time.Time {
+		d := time.Date(2026, 3, 10+offset, 0, 0, 0, 0, time.UTC)
+		return &d
+	}
+
+	tests := []struct {
+		name     string
+		status   string
+		deadline *time.Time
+		want     string
+	}{
+		{"no deadline", "pending", nil, ""},
+		{"closed order", "completed", day(-5), ""},
+		{"cancelled order", "cancelled", day(-5), ""},
+		{"yesterday", "in-progress", day(-1), "overdue"},
+		{"today", "pending", day(0), "at-risk"},
+		{"last at-risk day", "on-hold", day(atRiskDays), "at-risk"},
+		{"after the at-risk window", "pending", day(atRiskDays + 1), "on-track"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Order{Status: tt.status, DeadlineAt: tt.deadline}
+			if got := deadlineState(o, now); got != tt.want {
+				t.Errorf("deadlineState() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDaysUntil(t *testing.T) {
+	deadline := time.Date(2026, 3, 12, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		now  time.Time
+		want int
+	}{
+		{time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC), 2},
+		{time.Date(2026, 3, 11, 23, 59, 0, 0, time.UTC), 1},
+		{time.Date(2026, 3, 12, 12, 0, 0, 0, time.UTC), 0},
+		{time.Date(2026, 3, 14, 8, 0, 0, 0, time.UTC), -2},
+		// Today is the date where now is, not the date in UTC
+		{time.Date(2026, 3, 12, 1, 0, 0, 0, jakarta), 0},
+		{time.Date(2026, 3, 11, 22, 0, 0, 0, newYork), 1},
+	}
+	for _, tt := range tests {
+		if got := daysUntil(deadline, tt.now); got != tt.want {
+			t.Errorf("daysUntil(%v) = %d, want %d", tt.now, got, tt.want)
+		}
+	}
+
+	// A deadline that was moved into another zone keeps its date
+	if got := daysUntil(deadline.In(newYork), time.Date(2026, 3, 12, 9, 0, 0, 0, newYork)); got != 0 {
+		t.Errorf("daysUntil(deadline in New York) = %d, want 0", got)
+	}
+}
+
+var (
+	jakarta = time.FixedZone("WIB", 7*60*60)
+	newYork = time.FixedZone("EST", -5*60*60)
+)
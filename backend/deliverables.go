@@ -0,0 +1,536 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"image/jpeg"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// MODELS
+// ====================
+
+// Deliverable is a piece of finished or work-in-progress artwork shared
+// with the client through its token. The client always sees a watermarked
+// preview; the original unlocks once the order is paid in full.
+type Deliverable struct {
+	ID                int        `json:"id" db:"id"`
+	OrderID           string     `json:"orderId" db:"order_id"`
+	Title             string     `json:"title" db:"title"`
+	Token             string     `json:"token" db:"token"`
+	UploadID          int        `json:"-" db:"upload_id"`
+	Review            string     `json:"review" db:"review"` // empty until the client approves or asks for changes
+	ReviewNote        string     `json:"reviewNote" db:"review_note"`
+	ReviewedAt        *time.Time `json:"reviewedAt" db:"reviewed_at"`
+	CreatedAt         time.Time  `json:"createdAt" db:"created_at"`
+	File              *Upload    `json:"file"`
+	PreviewURL        string     `json:"previewUrl"`
+	OriginalURL       string     `json:"originalUrl"`
+	OriginalAvailable bool       `json:"originalAvailable"`
+}
+
+// ReviewRequest is the client's verdict on a preview.
+type ReviewRequest struct {
+	Review string `json:"review"` // approved or changes-requested
+	Note   string `json:"note"`
+}
+
+var deliverableReviews = map[string]bool{
+	"approved":          true,
+	"changes-requested": true,
+}
+
+const deliverablePublicPath = "/api/public/deliverables/"
+
+var (
+	ErrNoPreview     = errors.New("previews are only available for images")
+	ErrBalanceDue    = errors.New("the original is available once the order balance is paid")
+	ErrInvalidReview = errors.New("review must be approved or changes-requested")
+)
+
+// originalUnlocked reports whether the client may download originals: the
+// order has a final price and nothing is left to pay.
+func originalUnlocked(o *Order) bool {
+	return o.FinalPrice > 0 && balanceDue(o) <= 0
+}
+
+// ====================
+// REPOSITORIES
+// ====================
+
+type DeliverableRepository interface {
+	Create(d *Deliverable) error
+	GetByID(id int) (*Deliverable, error)
+	GetByToken(token string) (*Deliverable, error)
+	GetByOrder(orderID string) ([]Deliverable, error)
+	SetReview(id int, review, note string, at time.Time) error
+	Delete(id int) error
+}
+
+type deliverableRepository struct {
+	db DBTX
+}
+
+func NewDeliverableRepository(db DBTX) DeliverableRepository {
+	return &deliverableRepository{db: db}
+}
+
+const deliverableColumns = `id, order_id, title, token, upload_id, review, review_note, reviewed_at, created_at`
+
+func scanDeliverable(row rowScanner) (*Deliverable, error) {
+	var d Deliverable
+	var reviewedAt sql.NullTime
+	err := row.Scan(&d.ID, &d.OrderID, &d.Title, &d.Token, &d.UploadID, &d.Review, &d.ReviewNote,
+		&reviewedAt, &d.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if reviewedAt.Valid {
+		d.ReviewedAt = &reviewedAt.Time
+	}
+	return &d, nil
+}
+
+func (r *deliverableRepository) Create(d *Deliverable) error {
+	result, err := r.db.Exec(`
+		INSERT INTO deliverables (order_id, title, token, upload_id, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, d.OrderID, d.Title, d.Token, d.UploadID, d.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	d.ID = int(id)
+
+	return nil
+}
+
+func (r *deliverableRepository) GetByID(id int) (*Deliverable, error) {
+	return scanDeliverable(r.db.QueryRow("SELECT "+deliverableColumns+" FROM deliverables WHERE id = ?", id))
+}
+
+func (r *deliverableRepository) GetByToken(token string) (*Deliverable, error) {
+	return scanDeliverable(r.db.QueryRow("SELECT "+deliverableColumns+" FROM deliverables WHERE token = ?", token))
+}
+
+func (r *deliverableRepository) GetByOrder(orderID string) ([]Deliverable, error) {
+	rows, err := r.db.Query("SELECT "+deliverableColumns+" FROM deliverables WHERE order_id = ? ORDER BY id", orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliverables := []Deliverable{}
+	for rows.Next() {
+		d, err := scanDeliverable(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliverables = append(deliverables, *d)
+	}
+
+	return deliverables, rows.Err()
+}
+
+func (r *deliverableRepository) SetReview(id int, review, note string, at time.Time) error {
+	result, err := r.db.Exec("UPDATE deliverables SET review = ?, review_note = ?, reviewed_at = ? WHERE id = ?",
+		review, note, at, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *deliverableRepository) Delete(id int) error {
+	result, err := r.db.Exec("DELETE FROM deliverables WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// deleteOrderDeliverables removes every deliverable of an order with its
+// files.
+func deleteOrderDeliverables(db DBTX, root, orderID string) error {
+	repo := NewDeliverableRepository(db)
+	deliverables, err := repo.GetByOrder(orderID)
+	if err != nil {
+		return err
+	}
+	for _, d := range deliverables {
+		if err := repo.Delete(d.ID); err != nil {
+			return err
+		}
+	}
+	return deleteUploads(db, root, "deliverable", orderID)
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type DeliverableService interface {
+	GetDeliverables(orderID string) ([]Deliverable, error)
+	GetDeliverable(id int) (*Deliverable, error)
+	GetByToken(token string) (*Deliverable, error)
+	AddDeliverable(orderID, title, filename string, file io.Reader) (*Deliverable, error)
+	DeleteDeliverable(id int) error
+	ReviewDeliverable(d *Deliverable, req ReviewRequest) error
+	// Preview renders the watermarked JPEG shown to the client.
+	Preview(d *Deliverable) ([]byte, error)
+	// Original is the path of the full file; clients get ErrBalanceDue
+	// until the order is paid.
+	Original(d *Deliverable, asClient bool) (string, error)
+}
+
+type deliverableService struct {
+	db        *sql.DB
+	root      string
+	pipeline  *ImagePipeline
+	watermark WatermarkSettings
+}
+
+func NewDeliverableService(db *sql.DB, uploadDir string, pipeline *ImagePipeline, watermark WatermarkSettings) DeliverableService {
+	return &deliverableService{db: db, root: uploadDir, pipeline: pipeline, watermark: watermark}
+}
+
+func (s *deliverableService) GetDeliverables(orderID string) ([]Deliverable, error) {
+	order, err := NewOrderRepository(s.db).GetByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	deliverables, err := NewDeliverableRepository(s.db).GetByOrder(orderID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range deliverables {
+		if err := s.fill(&deliverables[i], order); err != nil {
+			return nil, err
+		}
+	}
+
+	return deliverables, nil
+}
+
+func (s *deliverableService) GetDeliverable(id int) (*Deliverable, error) {
+	return s.load(NewDeliverableRepository(s.db).GetByID(id))
+}
+
+func (s *deliverableService) GetByToken(token string) (*Deliverable, error) {
+	return s.load(NewDeliverableRepository(s.db).GetByToken(token))
+}
+
+func (s *deliverableService) load(d *Deliverable, err error) (*Deliverable, error) {
+	if err != nil {
+		return nil, err
+	}
+	order, err := NewOrderRepository(s.db).GetByID(d.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.fill(d, order); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// fill attaches the file and the client-facing links.
+func (s *deliverableService) fill(d *Deliverable, order *Order) error {
+	file, err := NewUploadRepository(s.db).GetByID(d.UploadID)
+	if err != nil {
+		return err
+	}
+
+	d.File = file
+	d.OriginalURL = deliverablePublicPath + d.Token + "/original"
+	d.OriginalAvailable = originalUnlocked(order)
+	if _, ok := imageTypes[file.ContentType]; ok {
+		d.PreviewURL = deliverablePublicPath + d.Token + "/preview"
+	}
+	return nil
+}
+
+func (s *deliverableService) AddDeliverable(orderID, title, filename string, file io.Reader) (*Deliverable, error) {
+	order, err := NewOrderRepository(s.db).GetByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, maxUploadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	upload, err := storeUpload(s.db, s.root, "deliverable", orderID, filename, data, false)
+	if err != nil {
+		return nil, err
+	}
+	d := &Deliverable{
+		OrderID:   orderID,
+		Title:     strings.TrimSpace(title),
+		Token:     token,
+		UploadID:  upload.ID,
+		CreatedAt: time.Now(),
+	}
+	if d.Title == "" {
+		d.Title = upload.Filename
+	}
+	if err := NewDeliverableRepository(s.db).Create(d); err != nil {
+		NewUploadRepository(s.db).Delete(upload.ID)
+		removeUploadFiles(s.root, upload)
+		return nil, err
+	}
+
+	if upload.Status == "pending" {
+		s.pipeline.Enqueue(upload.ID)
+	}
+	if err := s.fill(d, order); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (s *deliverableService) DeleteDeliverable(id int) error {
+	repo := NewDeliverableRepository(s.db)
+	d, err := repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if err := repo.Delete(id); err != nil {
+		return err
+	}
+
+	uploads := NewUploadRepository(s.db)
+	if file, err := uploads.GetByID(d.UploadID); err == nil && uploads.Delete(file.ID) == nil {
+		removeUploadFiles(s.root, file)
+	}
+	return nil
+}
+
+// ReviewDeliverable records the client's verdict; a later review replaces
+// an earlier one.
+func (s *deliverableService) ReviewDeliverable(d *Deliverable, req ReviewRequest) error {
+	if !deliverableReviews[req.Review] {
+		return ErrInvalidReview
+	}
+
+	now := time.Now()
+	note := strings.TrimSpace(req.Note)
+	if err := NewDeliverableRepository(s.db).SetReview(d.ID, req.Review, note, now); err != nil {
+		return err
+	}
+
+	d.Review, d.ReviewNote, d.ReviewedAt = req.Review, note, &now
+	return nil
+}
+
+// Preview works from the large variant when the pipeline is done with it,
+// which is already upright and stripped, and from the original otherwise.
+func (s *deliverableService) Preview(d *Deliverable) ([]byte, error) {
+	if _, ok := imageTypes[d.File.ContentType]; !ok || d.File.Status == "failed" {
+		return nil, ErrNoPreview
+	}
+
+	path, _ := variantFile(d.File, "large")
+	data, err := os.ReadFile(filepath.Join(s.root, path))
+	if err != nil {
+		return nil, err
+	}
+	img, err := decodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, renderPreview(img, s.watermark), &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *deliverableService) Original(d *Deliverable, asClient bool) (string, error) {
+	if asClient && !d.OriginalAvailable {
+		return "", ErrBalanceDue
+	}
+	return filepath.Join(s.root, d.File.OriginalPath), nil
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type DeliverableHandler struct {
+	service DeliverableService
+}
+
+func NewDeliverableHandler(service DeliverableService) *DeliverableHandler {
+	return &DeliverableHandler{service: service}
+}
+
+func (h *DeliverableHandler) GetDeliverables(c *gin.Context) {
+	deliverables, err := h.service.GetDeliverables(c.Param("id"))
+	h.respond(c, http.StatusOK, "", deliverables, err)
+}
+
+// AddDeliverable takes the file from the multipart "file" field and an
+// optional "title".
+func (h *DeliverableHandler) AddDeliverable(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	defer f.Close()
+
+	d, err := h.service.AddDeliverable(c.Param("id"), c.PostForm("title"), file.Filename, f)
+	h.respond(c, http.StatusCreated, "Deliverable uploaded successfully", d, err)
+}
+
+func (h *DeliverableHandler) DeleteDeliverable(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	err := h.service.DeleteDeliverable(id)
+	h.respond(c, http.StatusOK, "Deliverable deleted successfully", nil, err)
+}
+
+// DownloadOriginal lets the studio fetch the full file at any time.
+func (h *DeliverableHandler) DownloadOriginal(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	d, err := h.service.GetDeliverable(id)
+	if err != nil {
+		h.respond(c, http.StatusOK, "", nil, err)
+		return
+	}
+	h.sendOriginal(c, d, false)
+}
+
+// GetPublicDeliverable is the client's view of one deliverable.
+func (h *DeliverableHandler) GetPublicDeliverable(c *gin.Context) {
+	d, err := h.service.GetByToken(c.Param("token"))
+	h.respond(c, http.StatusOK, "", d, err)
+}
+
+func (h *DeliverableHandler) GetPublicPreview(c *gin.Context) {
+	d, err := h.service.GetByToken(c.Param("token"))
+	if err != nil {
+		h.respond(c, http.StatusOK, "", nil, err)
+		return
+	}
+
+	preview, err := h.service.Preview(d)
+	if err != nil {
+		h.respond(c, http.StatusOK, "", nil, err)
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Data(http.StatusOK, "image/jpeg", preview)
+}
+
+func (h *DeliverableHandler) GetPublicOriginal(c *gin.Context) {
+	d, err := h.service.GetByToken(c.Param("token"))
+	if err != nil {
+		h.respond(c, http.StatusOK, "", nil, err)
+		return
+	}
+	h.sendOriginal(c, d, true)
+}
+
+func (h *DeliverableHandler) sendOriginal(c *gin.Context, d *Deliverable, asClient bool) {
+	path, err := h.service.Original(d, asClient)
+	if err != nil {
+		h.respond(c, http.StatusOK, "", nil, err)
+		return
+	}
+
+	c.Header("Content-Type", d.File.ContentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": d.File.Filename}))
+	c.File(path)
+}
+
+func (h *DeliverableHandler) respond(c *gin.Context, status int, message string, data interface{}, err error) {
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Not found",
+		})
+		return
+	}
+	if err == ErrNoPreview || err == ErrImageTooBig || err == ErrInvalidReview {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err == ErrBalanceDue {
+		c.JSON(http.StatusPaymentRequired, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err == ErrUploadTooLarge {
+		c.JSON(http.StatusRequestEntityTooLarge, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(status, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    data,
+	})
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// TABLE WRITERS
+// ====================
+
+// TableWriter receives spreadsheet rows one at a time so exports can be
+// streamed straight to the response.
+type TableWriter interface {
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+type csvTableWriter struct {
+	w    *csv.Writer
+	rows int
+}
+
+func NewCSVTableWriter(w io.Writer) TableWriter {
+	return &csvTableWriter{w: csv.NewWriter(w)}
+}
+
+func (t *csvTableWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = csvCell(v)
+	}
+	if err := t.w.Write(record); err != nil {
+		return err
+	}
+
+	// Flush periodically so large exports reach the client as they are produced.
+	t.rows++
+	if t.rows%100 == 0 {
+		t.w.Flush()
+	}
+	return t.w.Error()
+}
+
+func (t *csvTableWriter) Close() error {
+	t.w.Flush()
+	return t.w.Error()
+}
+
+// xlsxTableWriter produces a single-sheet Office Open XML workbook. The sheet
+// is written last so its rows can be streamed into the zip entry directly.
+type xlsxTableWriter struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+}
+
+func NewXLSXTableWriter(w io.Writer, sheetName string) (TableWriter, error) {
+	zw := zip.NewWriter(w)
+
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="` + xmlEscape(sheetName) + `" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`},
+	}
+	for _, part := range parts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	sheet := bufio.NewWriter(f)
+	sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	return &xlsxTableWriter{zw: zw, sheet: sheet}, nil
+}
+
+func (t *xlsxTableWriter) WriteRow(values []interface{}) error {
+	t.rows++
+	fmt.Fprintf(t.sheet, `<row r="%d">`, t.rows)
+	for i, v := range values {
+		ref := xlsxColumn(i) + strconv.Itoa(t.rows)
+		switch n := v.(type) {
+		case int, int64, float64:
+			fmt.Fprintf(t.sheet, `<c r="%s"><v>%s</v></c>`, ref, formatCell(n))
+		default:
+			fmt.Fprintf(t.sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`,
+				ref, xmlEscape(formatCell(v)))
+		}
+	}
+	_, err := t.sheet.WriteString("</row>")
+	return err
+}
+
+func (t *xlsxTableWriter) Close() error {
+	t.sheet.WriteString("</sheetData></worksheet>")
+	if err := t.sheet.Flush(); err != nil {
+		return err
+	}
+	return t.zw.Close()
+}
+
+// xlsxColumn converts a zero-based column index to its spreadsheet letters.
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func formatCell(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case int:
+		return strconv.Itoa(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case time.Time:
+		if x.IsZero() {
+			return ""
+		}
+		return x.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// csvCell formats a cell for CSV, where a spreadsheet reads text as a
+// formula; XLSX text cells never are, so only CSV needs escapeFormula.
+func csvCell(v interface{}) string {
+	switch v.(type) {
+	case int, int64, float64:
+		return formatCell(v)
+	default:
+		return escapeFormula(formatCell(v))
+	}
+}
+
+// formulaChars start a formula when a spreadsheet opens the cell.
+const formulaChars = "=+-@\t\r"
+
+// escapeFormula keeps text from the public order form from running as a
+// formula when a CSV is opened in Excel: a leading quote makes it text.
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune(formulaChars, rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// unescapeFormula undoes escapeFormula for files exported from here.
+func unescapeFormula(s string) string {
+	if len(s) > 1 && s[0] == '\'' && strings.ContainsRune(formulaChars, rune(s[1])) {
+		return s[1:]
+	}
+	return s
+}
+
+// flattenJSONList turns a JSON-encoded string array column such as Services
+// into a single "a; b; c" cell.
+func flattenJSONList(raw string) string {
+	var items []string
+	if err := json.Unmarshal([]byte(raw), &items); err != nil {
+		return raw
+	}
+	return strings.Join(items, "; ")
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type ExportService interface {
+	ExportOrders(filter OrderFilter, w TableWriter) error
+	ExportClients(w TableWriter) error
+}
+
+type exportService struct {
+	orderRepo  OrderRepository
+	clientRepo ClientRepository
+}
+
+func NewExportService(orderRepo OrderRepository, clientRepo ClientRepository) ExportService {
+	return &exportService{
+		orderRepo:  orderRepo,
+		clientRepo: clientRepo,
+	}
+}
+
+var orderExportHeader = []interface{}{
+	"ID", "Client Name", "Email", "Phone", "Company", "Project Type", "Services",
+	"Project Title", "Description", "Budget", "Deadline", "Priority", "Status",
+	"Communication Preference", "Revision Rounds", "File Format", "Color Preferences",
+	"Target Audience", "Additional Notes", "Estimated Price", "Final Price", "Amount Paid",
+	"Balance Due", "Created At", "Updated At",
+}
+
+func (s *exportService) ExportOrders(filter OrderFilter, w TableWriter) error {
+	if err := w.WriteRow(orderExportHeader); err != nil {
+		return err
+	}
+
+	return s.orderRepo.Each(filter, func(o Order) error {
+		return w.WriteRow([]interface{}{
+			o.ID, o.ClientName, o.Email, o.Phone, o.Company, o.ProjectType,
+			flattenJSONList(o.Services), o.ProjectTitle, o.Description, o.Budget,
+			o.Deadline, o.Priority, o.Status, o.CommunicationPreference, o.RevisionRounds,
+			flattenJSONList(o.FileFormat), o.ColorPreferences, o.TargetAudience,
+			o.AdditionalNotes, o.EstimatedPrice, o.FinalPrice, o.AmountPaid, balanceDue(&o), o.CreatedAt, o.UpdatedAt,
+		})
+	})
+}
+
+var clientExportHeader = []interface{}{
+	"ID", "Name", "Email", "Phone", "Company", "Total Orders", "Total Spent",
+	"Last Order Date", "Created At",
+}
+
+func (s *exportService) ExportClients(w TableWriter) error {
+	if err := w.WriteRow(clientExportHeader); err != nil {
+		return err
+	}
+
+	return s.clientRepo.Each(func(client Client) error {
+		return w.WriteRow([]interface{}{
+			client.ID, client.Name, client.Email, client.Phone, client.Company,
+			client.TotalOrders, client.TotalSpent, client.LastOrderDate, client.CreatedAt,
+		})
+	})
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type ExportHandler struct {
+	service ExportService
+}
+
+func NewExportHandler(service ExportService) *ExportHandler {
+	return &ExportHandler{service: service}
+}
+
+func (h *ExportHandler) ExportOrders(c *gin.Context) {
+	filter := orderFilterFromQuery(c)
+	h.stream(c, "orders", func(w TableWriter) error {
+		return h.service.ExportOrders(filter, w)
+	})
+}
+
+func (h *ExportHandler) ExportClients(c *gin.Context) {
+	h.stream(c, "clients", h.service.ExportClients)
+}
+
+// stream picks the writer for ?format= (csv by default) and writes the
+// export directly to the response body.
+func (h *ExportHandler) stream(c *gin.Context, name string, export func(TableWriter) error) {
+	format := c.DefaultQuery("format", "csv")
+	filename := name + "-" + time.Now().Format("2006-01-02") + "." + format
+
+	var contentType string
+	switch format {
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+	case "xlsx":
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Unsupported export format: " + format,
+		})
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	var w TableWriter
+	if format == "xlsx" {
+		xw, err := NewXLSXTableWriter(c.Writer, name)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		w = xw
+	} else {
+		w = NewCSVTableWriter(c.Writer)
+	}
+
+	// Headers are already sent once rows start flowing, so failures can
+	// only be recorded and the body left truncated.
+	if err := export(w); err != nil {
+		c.Error(err)
+		return
+	}
+	if err := w.Close(); err != nil {
+		c.Error(err)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatCell(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		want string
+	}{
+		{"nil", nil, ""},
+		{"plain text", "Logo redesign", "Logo redesign"},
+		{"formula", "=1+1", "=1+1"},
+		{"int", 3, "3"},
+		{"int64", int64(1) << 40, "1099511627776"},
+		{"float", 150000.0, "150000"},
+		{"negative float", -12.5, "-12.5"},
+		{"zero time", time.Time{}, ""},
+		{"time", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), "2026-01-02T03:04:05Z"},
+		{"bool", true, "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatCell(tt.in); got != tt.want {
+				t.Errorf("formatCell(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVCell(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		want string
+	}{
+		{"nil", nil, ""},
+		{"plain text", "Logo redesign", "Logo redesign"},
+		{"equals", "=HYPERLINK(\"http://x\")", "'=HYPERLINK(\"http://x\")"},
+		{"plus", "+62 812", "'+62 812"},
+		{"minus", "-1+1", "'-1+1"},
+		{"at", "@SUM(A1)", "'@SUM(A1)"},
+		{"tab", "\t=1", "'\t=1"},
+		{"carriage return", "\r=1", "'\r=1"},
+		{"formula char later", "a=b", "a=b"},
+		{"negative number", -12.5, "-12.5"},
+		{"int", 3, "3"},
+		{"zero time", time.Time{}, ""},
+		{"time", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), "2026-01-02T03:04:05Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := csvCell(tt.in); got != tt.want {
+				t.Errorf("csvCell(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlattenJSONList(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`["Logo Design","Branding"]`, "Logo Design; Branding"},
+		{`[]`, ""},
+		{"not json", "not json"},
+	}
+	for _, tt := range tests {
+		if got := flattenJSONList(tt.in); got != tt.want {
+			t.Errorf("flattenJSONList(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	tests := []struct {
+		in   int
+		want string
+	}{
+		{0, "A"},
+		{25, "Z"},
+		{26, "AA"},
+		{51, "AZ"},
+		{52, "BA"},
+		{701, "ZZ"},
+		{702, "AAA"},
+	}
+	for _, tt := range tests {
+		if got := xlsxColumn(tt.in); got != tt.want {
+			t.Errorf("xlsxColumn(%d) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCSVTableWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCSVTableWriter(&buf)
+	rows := [][]interface{}{
+		{"Order ID", "Client", "Price"},
+		{"ORD-1", "Budi, Sons & Co", 150000.0},
+		{"ORD-2", `Say "hi"`, 0},
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Order ID,Client,Price\nORD-1,\"Budi, Sons & Co\",150000\nORD-2,\"Say \"\"hi\"\"\",0\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCSVTableWriterEscapesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCSVTableWriter(&buf)
+	if err := w.WriteRow([]interface{}{"=cmd|' /C calc'!A0", "Budi", 150000.0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "'=cmd|' /C calc'!A0,Budi,150000\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestUnescapeFormula(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"'=1+1", "=1+1"},
+		{"'+62 812", "+62 812"},
+		{"'quoted", "'quoted"},
+		{"'", "'"},
+		{"plain", "plain"},
+	}
+	for _, tt := range tests {
+		if got := unescapeFormula(tt.in); got != tt.want {
+			t.Errorf("unescapeFormula(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// xlsxSheet returns the worksheet XML of a workbook written by
+// NewXLSXTableWriter.
+func xlsxSheet(t *testing.T, workbook []byte) string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(workbook), int64(len(workbook)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range zr.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			data, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(data)
+		}
+	}
+	t.Fatal("workbook has no sheet1.xml")
+	return ""
+}
+
+func TestXLSXTableWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewXLSXTableWriter(&buf, "Orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRow([]interface{}{"Client", "Price"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRow([]interface{}{"Budi & <Sons>", 150000.0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sheet := xlsxSheet(t, buf.Bytes())
+	for _, want := range []string{
+		`<row r="1"><c r="A1" t="inlineStr"><is><t xml:space="preserve">Client</t></is></c>`,
+		`<c r="A2" t="inlineStr"><is><t xml:space="preserve">Budi &amp; &lt;Sons&gt;</t></is></c>`,
+		`<c r="B2"><v>150000</v></c>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet is missing %q:\n%s", want, sheet)
+		}
+	}
+}
+
+func TestXLSXTableWriterKeepsTextAsIs(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewXLSXTableWriter(&buf, "Orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRow([]interface{}{"+62 811", "=1+1", -5.0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Text cells are never evaluated, so they need no escaping
+	sheet := xlsxSheet(t, buf.Bytes())
+	for _, want := range []string{">+62 811<", ">=1+1<", "<v>-5</v>"} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet is missing %q:\n%s", want, sheet)
+		}
+	}
+	if strings.Contains(sheet, "'") {
+		t.Errorf("sheet has an escaping quote:\n%s", sheet)
+	}
+}
@@ -0,0 +1,661 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// MODELS
+// ====================
+
+// GalleryItem is a piece of portfolio work. Image is an external URL or,
+// for uploaded files, the large variant once the image pipeline is done;
+// Images lists every processed size.
+type GalleryItem struct {
+	ID          int       `json:"id" db:"id"`
+	Title       string    `json:"title" db:"title"`
+	Description string    `json:"description" db:"description"`
+	Category    string    `json:"category" db:"category"`
+	Tags        []string  `json:"tags" db:"tags"` // stored as a JSON string
+	Image       string    `json:"image" db:"image"`
+	SortOrder   int       `json:"sortOrder" db:"sort_order"`
+	Published   bool      `json:"published" db:"published"`
+	ProjectID   *int      `json:"projectId" db:"project_id"`
+	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time `json:"updatedAt" db:"updated_at"`
+
+	ImageID     *int           `json:"-" db:"image_id"`
+	ImageStatus string         `json:"imageStatus,omitempty"` // status of the uploaded image
+	Images      []GalleryImage `json:"images"`
+}
+
+type GalleryImage struct {
+	Size   string `json:"size"` // thumb, medium, large
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// ====================
+// DTOs
+// ====================
+
+// GalleryItemRequest changes whichever of its fields are set; on create,
+// title is required and everything else defaults to empty or unpublished.
+type GalleryItemRequest struct {
+	Title       *string   `json:"title"`
+	Description *string   `json:"description"`
+	Category    *string   `json:"category"`
+	Tags        *[]string `json:"tags"`
+	Image       *string   `json:"image"` // external URL; upload files separately
+	SortOrder   *int      `json:"sortOrder"`
+	Published   *bool     `json:"published"`
+	ProjectID   *int      `json:"projectId"` // 0 removes the link
+}
+
+type GalleryFilter struct {
+	Category      string
+	Tag           string
+	PublishedOnly bool
+}
+
+const galleryUploadPath = "/uploads/gallery/"
+
+var (
+	ErrGalleryTitleRequired = errors.New("title is required")
+	ErrUnknownProject       = errors.New("project does not exist")
+)
+
+// uploadDir is where uploaded files are kept, from UPLOAD_DIR.
+func uploadDir() string {
+	return appConfig.UploadDir
+}
+
+// ====================
+// REPOSITORIES
+// ====================
+
+type GalleryRepository interface {
+	GetAll(filter GalleryFilter, page, limit int) ([]GalleryItem, int, error)
+	GetByID(id int) (*GalleryItem, error)
+	Create(item *GalleryItem) error
+	Update(item *GalleryItem) error
+	Delete(id int) error
+	ClearProject(projectID int) error
+}
+
+type galleryRepository struct {
+	db DBTX
+}
+
+func NewGalleryRepository(db DBTX) GalleryRepository {
+	return &galleryRepository{db: db}
+}
+
+// galleryFrom joins each item's uploaded image so listings carry the
+// processed variants.
+const galleryFrom = " FROM gallery_items g LEFT JOIN uploads u ON u.id = g.image_id"
+
+const galleryColumns = `g.id, g.title, g.description, g.category, g.tags, g.image, g.sort_order, g.published,
+	g.project_id, g.created_at, g.updated_at, g.image_id, COALESCE(u.status, ''), COALESCE(u.variants, '[]')`
+
+func scanGalleryItem(row rowScanner) (*GalleryItem, error) {
+	var item GalleryItem
+	var tags, variants string
+	var projectID, imageID sql.NullInt64
+
+	err := row.Scan(&item.ID, &item.Title, &item.Description, &item.Category, &tags, &item.Image,
+		&item.SortOrder, &item.Published, &projectID, &item.CreatedAt, &item.UpdatedAt,
+		&imageID, &item.ImageStatus, &variants)
+	if err != nil {
+		return nil, err
+	}
+
+	item.Tags = []string{}
+	json.Unmarshal([]byte(tags), &item.Tags)
+	if projectID.Valid {
+		id := int(projectID.Int64)
+		item.ProjectID = &id
+	}
+	if imageID.Valid {
+		id := int(imageID.Int64)
+		item.ImageID = &id
+	}
+
+	item.Images = []GalleryImage{}
+	for _, v := range parseVariants(variants) {
+		image := GalleryImage{Size: v.Name, URL: galleryUploadPath + filepath.Base(v.Path), Width: v.Width, Height: v.Height}
+		item.Images = append(item.Images, image)
+		if v.Name == "large" {
+			item.Image = image.URL
+		}
+	}
+
+	return &item, nil
+}
+
+func (f GalleryFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if f.PublishedOnly {
+		conditions = append(conditions, "g.published = 1")
+	}
+	if f.Category != "" {
+		conditions = append(conditions, "g.category = ?")
+		args = append(args, f.Category)
+	}
+	if f.Tag != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM json_each(g.tags) WHERE value = ?)")
+		args = append(args, f.Tag)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func (r *galleryRepository) GetAll(filter GalleryFilter, page, limit int) ([]GalleryItem, int, error) {
+	where, args := filter.where()
+
+	var total int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM gallery_items g"+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	rows, err := r.db.Query("SELECT "+galleryColumns+galleryFrom+where+
+		" ORDER BY g.sort_order, g.id DESC LIMIT ? OFFSET ?", append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	items := []GalleryItem{}
+	for rows.Next() {
+		item, err := scanGalleryItem(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, *item)
+	}
+
+	return items, total, rows.Err()
+}
+
+func (r *galleryRepository) GetByID(id int) (*GalleryItem, error) {
+	return scanGalleryItem(r.db.QueryRow("SELECT "+galleryColumns+galleryFrom+" WHERE g.id = ?", id))
+}
+
+func (r *galleryRepository) Create(item *GalleryItem) error {
+	tags, _ := json.Marshal(item.Tags)
+
+	result, err := r.db.Exec(`
+		INSERT INTO gallery_items (title, description, category, tags, image, sort_order, published,
+		project_id, image_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, item.Title, item.Description, item.Category, string(tags), item.storedImage(), item.SortOrder,
+		item.Published, item.ProjectID, item.ImageID, item.CreatedAt, item.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	item.ID = int(id)
+
+	return nil
+}
+
+func (r *galleryRepository) Update(item *GalleryItem) error {
+	tags, _ := json.Marshal(item.Tags)
+
+	result, err := r.db.Exec(`
+		UPDATE gallery_items SET title = ?, description = ?, category = ?, tags = ?, image = ?,
+		sort_order = ?, published = ?, project_id = ?, image_id = ?, updated_at = ?
+		WHERE id = ?
+	`, item.Title, item.Description, item.Category, string(tags), item.storedImage(), item.SortOrder,
+		item.Published, item.ProjectID, item.ImageID, item.UpdatedAt, item.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *galleryRepository) Delete(id int) error {
+	result, err := r.db.Exec("DELETE FROM gallery_items WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// storedImage is the image column: the external URL, or nothing when the
+// image is an upload whose URL comes from its variants.
+func (item *GalleryItem) storedImage() string {
+	if item.ImageID != nil {
+		return ""
+	}
+	return item.Image
+}
+
+// ClearProject unlinks gallery items from a project that is being deleted;
+// the published work itself stays.
+func (r *galleryRepository) ClearProject(projectID int) error {
+	_, err := r.db.Exec("UPDATE gallery_items SET project_id = NULL WHERE project_id = ?", projectID)
+	return err
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type GalleryService interface {
+	GetItems(filter GalleryFilter, page, limit int) ([]GalleryItem, PaginationResponse, error)
+	GetItem(id int, publishedOnly bool) (*GalleryItem, error)
+	CreateItem(req GalleryItemRequest) (*GalleryItem, error)
+	UpdateItem(id int, req GalleryItemRequest) (*GalleryItem, error)
+	DeleteItem(id int) error
+	UploadImage(id int, filename string, image io.Reader) (*GalleryItem, error)
+}
+
+type galleryService struct {
+	db       *sql.DB
+	root     string // upload directory
+	pipeline *ImagePipeline
+}
+
+func NewGalleryService(db *sql.DB, uploadDir string, pipeline *ImagePipeline) GalleryService {
+	return &galleryService{db: db, root: uploadDir, pipeline: pipeline}
+}
+
+func (s *galleryService) GetItems(filter GalleryFilter, page, limit int) ([]GalleryItem, PaginationResponse, error) {
+	items, total, err := NewGalleryRepository(s.db).GetAll(filter, page, limit)
+	if err != nil {
+		return nil, PaginationResponse{}, err
+	}
+
+	return items, PaginationResponse{
+		Page:       page,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: (total + limit - 1) / limit,
+	}, nil
+}
+
+// GetItem hides unpublished items from the public endpoint.
+func (s *galleryService) GetItem(id int, publishedOnly bool) (*GalleryItem, error) {
+	item, err := NewGalleryRepository(s.db).GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if publishedOnly && !item.Published {
+		return nil, sql.ErrNoRows
+	}
+	return item, nil
+}
+
+func (s *galleryService) CreateItem(req GalleryItemRequest) (*GalleryItem, error) {
+	now := time.Now()
+	item := &GalleryItem{Tags: []string{}, CreatedAt: now}
+	if err := s.apply(item, req); err != nil {
+		return nil, err
+	}
+	item.UpdatedAt = now
+
+	if err := NewGalleryRepository(s.db).Create(item); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// UpdateItem removes the uploaded image when an external URL replaces it.
+func (s *galleryService) UpdateItem(id int, req GalleryItemRequest) (*GalleryItem, error) {
+	repo := NewGalleryRepository(s.db)
+	item, err := repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	previous, previousImage := item.ImageID, item.Image
+	if err := s.apply(item, req); err != nil {
+		return nil, err
+	}
+	item.UpdatedAt = time.Now()
+
+	if err := repo.Update(item); err != nil {
+		return nil, err
+	}
+
+	if previous != nil && item.ImageID == nil {
+		s.removeUpload(*previous)
+	} else if previous == nil && item.Image != previousImage {
+		s.removeLegacyUpload(previousImage)
+	}
+	return item, nil
+}
+
+func (s *galleryService) apply(item *GalleryItem, req GalleryItemRequest) error {
+	if req.Title != nil {
+		item.Title = strings.TrimSpace(*req.Title)
+	}
+	if item.Title == "" {
+		return ErrGalleryTitleRequired
+	}
+	if req.Description != nil {
+		item.Description = *req.Description
+	}
+	if req.Category != nil {
+		item.Category = strings.TrimSpace(*req.Category)
+	}
+	if req.Tags != nil {
+		item.Tags = []string{}
+		for _, tag := range *req.Tags {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				item.Tags = append(item.Tags, tag)
+			}
+		}
+	}
+	if req.Image != nil {
+		item.Image = strings.TrimSpace(*req.Image)
+		item.ImageID = nil
+		item.Images = []GalleryImage{}
+		item.ImageStatus = ""
+	}
+	if req.SortOrder != nil {
+		item.SortOrder = *req.SortOrder
+	}
+	if req.Published != nil {
+		item.Published = *req.Published
+	}
+	if req.ProjectID != nil {
+		if *req.ProjectID == 0 {
+			item.ProjectID = nil
+		} else {
+			_, err := NewProjectRepository(s.db).GetByID(*req.ProjectID)
+			if err == sql.ErrNoRows {
+				return ErrUnknownProject
+			}
+			if err != nil {
+				return err
+			}
+			item.ProjectID = req.ProjectID
+		}
+	}
+
+	return nil
+}
+
+// DeleteItem also removes the item's uploaded image, if it has one.
+func (s *galleryService) DeleteItem(id int) error {
+	repo := NewGalleryRepository(s.db)
+	item, err := repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if err := repo.Delete(id); err != nil {
+		return err
+	}
+
+	if item.ImageID != nil {
+		s.removeUpload(*item.ImageID)
+	} else {
+		s.removeLegacyUpload(item.Image)
+	}
+	return nil
+}
+
+// UploadImage stores the original and hands it to the image pipeline; the
+// item shows imageStatus pending until the variants exist. Variant names
+// are fresh for every upload, so cached copies of the previous image never
+// show the new one.
+func (s *galleryService) UploadImage(id int, filename string, image io.Reader) (*GalleryItem, error) {
+	repo := NewGalleryRepository(s.db)
+	item, err := repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(image, maxUploadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	upload, err := storeUpload(s.db, s.root, "gallery", strconv.Itoa(item.ID), filename, data, true)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, previousImage := item.ImageID, item.Image
+	item.ImageID = &upload.ID
+	item.UpdatedAt = time.Now()
+	if err := repo.Update(item); err != nil {
+		NewUploadRepository(s.db).Delete(upload.ID)
+		removeUploadFiles(s.root, upload)
+		return nil, err
+	}
+
+	if previous != nil {
+		s.removeUpload(*previous)
+	} else {
+		s.removeLegacyUpload(previousImage)
+	}
+	s.pipeline.Enqueue(upload.ID)
+
+	return repo.GetByID(id)
+}
+
+// removeUpload deletes an uploaded image with its files. A worker still
+// processing it cleans up the variants it writes afterwards.
+func (s *galleryService) removeUpload(id int) {
+	repo := NewUploadRepository(s.db)
+	upload, err := repo.GetByID(id)
+	if err != nil {
+		return
+	}
+	if repo.Delete(id) == nil {
+		removeUploadFiles(s.root, upload)
+	}
+}
+
+// removeLegacyUpload deletes a file stored directly under /uploads/gallery
+// before images went through the pipeline; external URLs are left alone.
+func (s *galleryService) removeLegacyUpload(image string) {
+	if strings.HasPrefix(image, galleryUploadPath) {
+		os.Remove(filepath.Join(s.root, "gallery", filepath.Base(image)))
+	}
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type GalleryHandler struct {
+	service GalleryService
+}
+
+func NewGalleryHandler(service GalleryService) *GalleryHandler {
+	return &GalleryHandler{service: service}
+}
+
+// GetPublishedItems is the public listing, filtered by the category and tag
+// query parameters.
+func (h *GalleryHandler) GetPublishedItems(c *gin.Context) {
+	h.getItems(c, true)
+}
+
+// GetAllItems includes unpublished drafts for the admin screens.
+func (h *GalleryHandler) GetAllItems(c *gin.Context) {
+	h.getItems(c, false)
+}
+
+func (h *GalleryHandler) getItems(c *gin.Context, publishedOnly bool) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "24"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 24
+	}
+
+	filter := GalleryFilter{
+		Category:      c.Query("category"),
+		Tag:           c.Query("tag"),
+		PublishedOnly: publishedOnly,
+	}
+	items, pagination, err := h.service.GetItems(filter, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success:    true,
+		Data:       items,
+		Pagination: pagination,
+	})
+}
+
+func (h *GalleryHandler) GetPublishedItem(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	item, err := h.service.GetItem(id, true)
+	h.respond(c, http.StatusOK, "", item, err)
+}
+
+func (h *GalleryHandler) GetItem(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	item, err := h.service.GetItem(id, false)
+	h.respond(c, http.StatusOK, "", item, err)
+}
+
+func (h *GalleryHandler) CreateItem(c *gin.Context) {
+	var req GalleryItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	item, err := h.service.CreateItem(req)
+	h.respond(c, http.StatusCreated, "Gallery item created successfully", item, err)
+}
+
+func (h *GalleryHandler) UpdateItem(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req GalleryItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	item, err := h.service.UpdateItem(id, req)
+	h.respond(c, http.StatusOK, "Gallery item updated successfully", item, err)
+}
+
+func (h *GalleryHandler) DeleteItem(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	err := h.service.DeleteItem(id)
+	h.respond(c, http.StatusOK, "Gallery item deleted successfully", nil, err)
+}
+
+// UploadImage takes the file from the multipart "image" field.
+func (h *GalleryHandler) UploadImage(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	file, err := c.FormFile("image")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	defer f.Close()
+
+	item, err := h.service.UploadImage(id, file.Filename, f)
+	h.respond(c, http.StatusOK, "Image uploaded successfully", item, err)
+}
+
+func (h *GalleryHandler) respond(c *gin.Context, status int, message string, data interface{}, err error) {
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Gallery item not found",
+		})
+		return
+	}
+	if err == ErrGalleryTitleRequired || err == ErrUnsupportedImage || err == ErrUnknownProject ||
+		err == ErrImageTooBig {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err == ErrUploadTooLarge {
+		c.JSON(http.StatusRequestEntityTooLarge, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(status, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    data,
+	})
+}
@@ -0,0 +1,580 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// MODELS
+// ====================
+
+type CheckoutRequest struct {
+	OrderID       string
+	Kind          string
+	Description   string
+	CustomerEmail string
+	Amount        float64
+	Currency      string
+	SuccessURL    string
+	CancelURL     string
+}
+
+type CheckoutSession struct {
+	ID       string  `json:"id"`
+	URL      string  `json:"url"`
+	Provider string  `json:"provider"`
+	OrderID  string  `json:"orderId"`
+	Kind     string  `json:"kind"`
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+}
+
+// GatewayEvent is a verified webhook event reduced to what the order needs.
+// Paid is only set for events that confirm money was captured.
+type GatewayEvent struct {
+	ID        string  `json:"id"`
+	Type      string  `json:"type"`
+	SessionID string  `json:"sessionId"`
+	OrderID   string  `json:"orderId"`
+	Kind      string  `json:"kind"`
+	Amount    float64 `json:"amount"`
+	Reference string  `json:"reference"`
+	Paid      bool    `json:"paid"`
+}
+
+var (
+	ErrInvalidSignature    = errors.New("webhook signature is invalid")
+	ErrNothingToPay        = errors.New("nothing is due on this order")
+	ErrUnknownCheckoutKind = errors.New("checkout kind must be deposit or balance")
+	ErrNoPaymentGateway    = errors.New("online payments are not set up")
+)
+
+// ====================
+// GATEWAYS
+// ====================
+
+// PaymentGateway is implemented by each payment provider. Webhook parsing
+// must verify the signature before trusting anything in the payload.
+type PaymentGateway interface {
+	Name() string
+	CreateCheckoutSession(req CheckoutRequest) (*CheckoutSession, error)
+	ParseWebhook(payload []byte, header http.Header) (*GatewayEvent, error)
+}
+
+// newPaymentGateway picks the configured gateway, or nil when there is
+// none, which leaves checkout off. The config only allows the fake gateway
+// in dev mode.
+func newPaymentGateway(cfg PaymentConfig) PaymentGateway {
+	switch cfg.Gateway {
+	case "stripe":
+		return NewStripeGateway(cfg.StripeSecretKey, cfg.StripeWebhookSecret, cfg.StripeAPIBase)
+	case "fake":
+		return NewFakeGateway(cfg.FakeGatewaySecret)
+	default:
+		return nil
+	}
+}
+
+// stripeGateway talks to the Stripe Checkout API, or any provider that
+// mirrors it when apiBase points elsewhere.
+type stripeGateway struct {
+	secretKey     string
+	webhookSecret string
+	apiBase       string
+	client        *http.Client
+}
+
+const stripeSignatureTolerance = 5 * time.Minute
+
+func NewStripeGateway(secretKey, webhookSecret, apiBase string) PaymentGateway {
+	if apiBase == "" {
+		apiBase = "https://api.stripe.com"
+	}
+	return &stripeGateway{
+		secretKey:     secretKey,
+		webhookSecret: webhookSecret,
+		apiBase:       strings.TrimRight(apiBase, "/"),
+		client:        &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (g *stripeGateway) Name() string {
+	return "stripe"
+}
+
+func (g *stripeGateway) CreateCheckoutSession(req CheckoutRequest) (*CheckoutSession, error) {
+	form := url.Values{}
+	form.Set("mode", "payment")
+	form.Set("success_url", req.SuccessURL)
+	form.Set("cancel_url", req.CancelURL)
+	form.Set("client_reference_id", req.OrderID)
+	if req.CustomerEmail != "" {
+		form.Set("customer_email", req.CustomerEmail)
+	}
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("line_items[0][price_data][currency]", strings.ToLower(req.Currency))
+	form.Set("line_items[0][price_data][unit_amount]", strconv.FormatInt(toMinorUnits(req.Amount), 10))
+	form.Set("line_items[0][price_data][product_data][name]", req.Description)
+	form.Set("metadata[order_id]", req.OrderID)
+	form.Set("metadata[kind]", req.Kind)
+
+	httpReq, err := http.NewRequest(http.MethodPost, g.apiBase+"/v1/checkout/sessions",
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.SetBasicAuth(g.secretKey, "")
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := g.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		ID    string `json:"id"`
+		URL   string `json:"url"`
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("stripe: %s", resp.Status)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("stripe: %s", body.Error.Message)
+	}
+
+	return &CheckoutSession{
+		ID:       body.ID,
+		URL:      body.URL,
+		Provider: g.Name(),
+		OrderID:  req.OrderID,
+		Kind:     req.Kind,
+		Amount:   req.Amount,
+		Currency: req.Currency,
+	}, nil
+}
+
+// ParseWebhook verifies the Stripe-Signature header ("t=<unix>,v1=<hex>")
+// against HMAC-SHA256 of "<t>.<payload>" and rejects stale timestamps.
+func (g *stripeGateway) ParseWebhook(payload []byte, header http.Header) (*GatewayEvent, error) {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header.Get("Stripe-Signature"), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return nil, ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > stripeSignatureTolerance || age < -stripeSignatureTolerance {
+		return nil, ErrInvalidSignature
+	}
+	expected := signPayload(g.webhookSecret, []byte(timestamp+"."+string(payload)))
+	valid := false
+	for _, sig := range signatures {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			valid = true
+		}
+	}
+	if !valid {
+		return nil, ErrInvalidSignature
+	}
+
+	var event struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object struct {
+				ID            string            `json:"id"`
+				AmountTotal   int64             `json:"amount_total"`
+				PaymentStatus string            `json:"payment_status"`
+				PaymentIntent string            `json:"payment_intent"`
+				Metadata      map[string]string `json:"metadata"`
+			} `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+
+	session := event.Data.Object
+	reference := session.PaymentIntent
+	if reference == "" {
+		reference = session.ID
+	}
+	paid := (event.Type == "checkout.session.completed" && session.PaymentStatus == "paid") ||
+		event.Type == "checkout.session.async_payment_succeeded"
+
+	return &GatewayEvent{
+		ID:        event.ID,
+		Type:      event.Type,
+		SessionID: session.ID,
+		OrderID:   session.Metadata["order_id"],
+		Kind:      session.Metadata["kind"],
+		Amount:    fromMinorUnits(session.AmountTotal),
+		Reference: reference,
+		Paid:      paid,
+	}, nil
+}
+
+// fakeGateway never leaves the process. Sessions point straight at the
+// success URL and webhooks are GatewayEvent JSON signed with
+// X-Fake-Signature, the hex HMAC-SHA256 of the body.
+type fakeGateway struct {
+	secret string
+}
+
+func NewFakeGateway(secret string) PaymentGateway {
+	return &fakeGateway{secret: secret}
+}
+
+func (g *fakeGateway) Name() string {
+	return "fake"
+}
+
+func (g *fakeGateway) CreateCheckoutSession(req CheckoutRequest) (*CheckoutSession, error) {
+	id := fmt.Sprintf("cs_fake_%d", nextIDNano())
+	return &CheckoutSession{
+		ID:       id,
+		URL:      req.SuccessURL + "?session_id=" + id,
+		Provider: g.Name(),
+		OrderID:  req.OrderID,
+		Kind:     req.Kind,
+		Amount:   req.Amount,
+		Currency: req.Currency,
+	}, nil
+}
+
+func (g *fakeGateway) ParseWebhook(payload []byte, header http.Header) (*GatewayEvent, error) {
+	// Without a secret anyone could sign; the config never allows that
+	if g.secret == "" || !hmac.Equal([]byte(header.Get("X-Fake-Signature")), []byte(signPayload(g.secret, payload))) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event GatewayEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	if event.Reference == "" {
+		event.Reference = event.SessionID
+	}
+	return &event, nil
+}
+
+func signPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func toMinorUnits(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func fromMinorUnits(amount int64) float64 {
+	return float64(amount) / 100
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type CheckoutService interface {
+	CreateCheckout(orderID, kind string) (*CheckoutSession, error)
+	HandleWebhook(payload []byte, header http.Header) (*GatewayEvent, bool, error)
+}
+
+type checkoutService struct {
+	db         *sql.DB
+	gateway    PaymentGateway
+	successURL string
+	cancelURL  string
+}
+
+func NewCheckoutService(db *sql.DB, gateway PaymentGateway, successURL, cancelURL string) CheckoutService {
+	return &checkoutService{db: db, gateway: gateway, successURL: successURL, cancelURL: cancelURL}
+}
+
+// CreateCheckout opens a session for the outstanding deposit or, once that
+// is covered, the remaining balance. kind forces one or the other.
+func (s *checkoutService) CreateCheckout(orderID, kind string) (*CheckoutSession, error) {
+	if s.gateway == nil {
+		return nil, ErrNoPaymentGateway
+	}
+	order, err := NewOrderRepository(s.db).GetByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.FinalPrice <= 0 {
+		return nil, ErrOrderNotPriced
+	}
+
+	if kind == "" {
+		kind = "balance"
+		if order.DepositRequired && !depositPaid(order) {
+			kind = "deposit"
+		}
+	}
+
+	var amount float64
+	switch kind {
+	case "deposit":
+		amount = roundMoney(depositAmount(order) - order.AmountPaid)
+	case "balance":
+		amount = balanceDue(order)
+	default:
+		return nil, ErrUnknownCheckoutKind
+	}
+	if amount <= 0 {
+		return nil, ErrNothingToPay
+	}
+
+	description := fmt.Sprintf("%s - %s", invoiceBrandName, order.ProjectTitle)
+	if kind == "deposit" {
+		description += " (deposit)"
+	}
+
+	return s.gateway.CreateCheckoutSession(CheckoutRequest{
+		OrderID:       order.ID,
+		Kind:          kind,
+		Description:   description,
+		CustomerEmail: order.Email,
+		Amount:        amount,
+		Currency:      invoiceCurrency,
+		SuccessURL:    s.successURL,
+		CancelURL:     s.cancelURL,
+	})
+}
+
+// HandleWebhook records a paid event exactly once. Provider retries hit the
+// gateway_events primary key and are reported as duplicates; a pending order
+// moves to "in-progress" once its deposit is covered.
+func (s *checkoutService) HandleWebhook(payload []byte, header http.Header) (*GatewayEvent, bool, error) {
+	if s.gateway == nil {
+		return nil, false, ErrNoPaymentGateway
+	}
+	event, err := s.gateway.ParseWebhook(payload, header)
+	if err != nil {
+		return nil, false, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT OR IGNORE INTO gateway_events (id, provider, type, order_id, received_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, event.ID, s.gateway.Name(), event.Type, event.OrderID, time.Now())
+	if err != nil {
+		return nil, false, err
+	}
+	if inserted, _ := result.RowsAffected(); inserted == 0 {
+		return event, true, nil
+	}
+
+	if event.Paid {
+		// Different events for the same session (completed, then
+		// async_payment_succeeded) must not record the money twice.
+		_, err := NewPaymentRepository(tx).GetByReference(event.Reference)
+		if err == sql.ErrNoRows {
+			if err := s.recordEvent(tx, event); err != nil {
+				return nil, false, err
+			}
+		} else if err != nil {
+			return nil, false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+
+	return event, false, nil
+}
+
+func (s *checkoutService) recordEvent(tx *sql.Tx, event *GatewayEvent) error {
+	kind := "payment"
+	if event.Kind == "deposit" {
+		kind = "deposit"
+	}
+
+	_, err := recordPayment(tx, event.OrderID, PaymentRequest{
+		Kind:      kind,
+		Amount:    event.Amount,
+		Method:    s.gateway.Name(),
+		Reference: event.Reference,
+		Notes:     "Checkout session " + event.SessionID,
+	})
+	if err != nil {
+		return err
+	}
+
+	orders := NewOrderRepository(tx)
+	order, err := orders.GetByID(event.OrderID)
+	if err != nil {
+		return err
+	}
+	if order.Status == "pending" && depositPaid(order) {
+		return orders.UpdateStatus(order.ID, "in-progress")
+	}
+
+	return nil
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type CheckoutHandler struct {
+	service CheckoutService
+}
+
+func NewCheckoutHandler(service CheckoutService) *CheckoutHandler {
+	return &CheckoutHandler{service: service}
+}
+
+func (h *CheckoutHandler) CreateCheckout(c *gin.Context) {
+	var req struct {
+		Kind string `json:"kind"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+	}
+
+	session, err := h.service.CreateCheckout(c.Param("id"), req.Kind)
+	if err == ErrNoPaymentGateway {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Order not found",
+		})
+		return
+	}
+	if err == ErrUnknownCheckoutKind {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err == ErrOrderNotPriced || err == ErrNothingToPay {
+		c.JSON(http.StatusUnprocessableEntity, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, APIResponse{
+		Success: true,
+		Message: "Checkout session created",
+		Data:    session,
+	})
+}
+
+// Webhook answers 2xx for anything it has stored so the provider stops
+// retrying; only bad signatures and payloads are rejected.
+func (h *CheckoutHandler) Webhook(c *gin.Context) {
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	event, duplicate, err := h.service.HandleWebhook(payload, c.Request.Header)
+	if err == ErrNoPaymentGateway {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err == ErrInvalidSignature {
+		c.JSON(http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnprocessableEntity, APIResponse{
+			Success: false,
+			Message: "Order not found",
+		})
+		return
+	}
+	if _, ok := err.(*json.SyntaxError); ok || err == ErrInvalidAmount || err == ErrInvalidPaymentKind {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	message := "Event processed"
+	if duplicate {
+		message = "Event already processed"
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    event,
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFakeGatewayWebhookSignature(t *testing.T) {
+	payload := []byte(`{"id":"evt_1","type":"checkout.completed","sessionId":"cs_fake_1","orderId":"ORD-1","kind":"deposit","amount":150,"paid":true}`)
+
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+		wantErr   error
+	}{
+		{"valid", "whsec", signPayload("whsec", payload), nil},
+		{"missing signature", "whsec", "", ErrInvalidSignature},
+		{"wrong secret", "whsec", signPayload("other", payload), ErrInvalidSignature},
+		{"tampered body", "whsec", signPayload("whsec", append(payload, ' ')), ErrInvalidSignature},
+		{"no secret configured", "", signPayload("", payload), ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("X-Fake-Signature", tt.signature)
+
+			event, err := NewFakeGateway(tt.secret).ParseWebhook(payload, header)
+			if err != tt.wantErr {
+				t.Fatalf("ParseWebhook() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if event.OrderID != "ORD-1" || event.Amount != 150 || !event.Paid {
+				t.Errorf("ParseWebhook() = %+v", event)
+			}
+			if event.Reference != "cs_fake_1" {
+				t.Errorf("Reference = %q, want the session ID", event.Reference)
+			}
+		})
+	}
+}
+
+func TestStripeWebhookSignature(t *testing.T) {
+	payload := []byte(`{"id":"evt_1","type":"checkout.session.completed","data":{"object":{` +
+		`"id":"cs_1","amount_total":15000,"payment_status":"paid","payment_intent":"pi_1",` +
+		`"metadata":{"order_id":"ORD-1","kind":"deposit"}}}}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-stripeSignatureTolerance-time.Minute).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(stripeSignatureTolerance+time.Minute).Unix(), 10)
+	sign := func(secret, timestamp string) string {
+		return signPayload(secret, []byte(timestamp+"."+string(payload)))
+	}
+
+	tests := []struct {
+		name    string
+		header  string
+		wantErr bool
+	}{
+		{"valid", "t=" + now + ",v1=" + sign("whsec", now), false},
+		{"one of several signatures", "t=" + now + ",v1=deadbeef,v1=" + sign("whsec", now), false},
+		{"missing header", "", true},
+		{"no timestamp", "v1=" + sign("whsec", now), true},
+		{"no signature", "t=" + now, true},
+		{"wrong secret", "t=" + now + ",v1=" + sign("other", now), true},
+		{"signed for another timestamp", "t=" + now + ",v1=" + sign("whsec", stale), true},
+		{"stale", "t=" + stale + ",v1=" + sign("whsec", stale), true},
+		{"from the future", "t=" + future + ",v1=" + sign("whsec", future), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("Stripe-Signature", tt.header)
+
+			event, err := NewStripeGateway("sk_test", "whsec", "").ParseWebhook(payload, header)
+			if tt.wantErr {
+				if err != ErrInvalidSignature {
+					t.Fatalf("ParseWebhook() error = %v, want %v", err, ErrInvalidSignature)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseWebhook() error = %v", err)
+			}
+			if event.OrderID != "ORD-1" || event.Amount != 150 || !event.Paid || event.Reference != "pi_1" {
+				t.Errorf("ParseWebhook() = %+v", event)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestDB opens a fresh, migrated database that is removed after the test.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db := initDB(filepath.Join(t.TempDir(), "test.db"))
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// newTestOrder stores a pending order for client@example.com, with some
+// contact details and free text filled in.
+func newTestOrder(t *testing.T, db *sql.DB, finalPrice float64) *Order {
+	t.Helper()
+	token, err := generateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	order := &Order{
+		ID:              generateOrderID(),
+		ClientName:      "Test Client",
+		Email:           "client@example.com",
+		Phone:           "+62 812 0000 0000",
+		Company:         "Test Company",
+		ProjectType:     "logo",
+		Services:        "Logo Design",
+		ProjectTitle:    "Test Project",
+		Description:     "A logo for our bakery",
+		Budget:          "500-1000",
+		Status:          "pending",
+		AdditionalNotes: "Call me after five",
+		FinalPrice:      finalPrice,
+		TrackingToken:   token,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if err := NewOrderRepository(db).Create(order); err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
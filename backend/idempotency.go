@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// MODELS
+// ====================
+
+// IdempotentResponse is the stored answer to the first request made with an
+// Idempotency-Key. Status is 0 while that request is still running.
+type IdempotentResponse struct {
+	Key         string
+	Fingerprint string
+	Status      int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+const (
+	idempotencyHeader = "Idempotency-Key"
+
+	// Keys are remembered this long after their first use
+	idempotencyKeyTTL = 24 * time.Hour
+	// A key still running after this long belongs to a request that died
+	// with the server, and may be taken over
+	idempotencyLockTimeout = 5 * time.Minute
+
+	idempotencySweepInterval = time.Hour
+	maxIdempotencyKeyLength  = 255
+	maxIdempotentBodySize    = maxUploadSize + 1<<20
+)
+
+var (
+	ErrIdempotencyConflict   = errors.New("Idempotency-Key was already used for a different request")
+	ErrIdempotencyInProgress = errors.New("a request with this Idempotency-Key is still being processed")
+)
+
+// ====================
+// REPOSITORIES
+// ====================
+
+type IdempotencyRepository interface {
+	// Reserve claims key for a new request; false means it is taken.
+	Reserve(key, fingerprint string, at time.Time) (bool, error)
+	Get(key string) (*IdempotentResponse, error)
+	Complete(key string, status int, contentType string, body []byte) error
+	Delete(key string) error
+	DeleteBefore(cutoff time.Time) error
+}
+
+type idempotencyRepository struct {
+	db DBTX
+}
+
+func NewIdempotencyRepository(db DBTX) IdempotencyRepository {
+	return &idempotencyRepository{db: db}
+}
+
+func (r *idempotencyRepository) Reserve(key, fingerprint string, at time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		INSERT OR IGNORE INTO idempotency_keys (key, fingerprint, status, content_type, body, created_at)
+		VALUES (?, ?, 0, '', '', ?)
+	`, key, fingerprint, at)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func (r *idempotencyRepository) Get(key string) (*IdempotentResponse, error) {
+	var resp IdempotentResponse
+	err := r.db.QueryRow(`
+		SELECT key, fingerprint, status, content_type, body, created_at
+		FROM idempotency_keys WHERE key = ?
+	`, key).Scan(&resp.Key, &resp.Fingerprint, &resp.Status, &resp.ContentType, &resp.Body, &resp.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (r *idempotencyRepository) Complete(key string, status int, contentType string, body []byte) error {
+	_, err := r.db.Exec("UPDATE idempotency_keys SET status = ?, content_type = ?, body = ? WHERE key = ?",
+		status, contentType, body, key)
+	return err
+}
+
+func (r *idempotencyRepository) Delete(key string) error {
+	_, err := r.db.Exec("DELETE FROM idempotency_keys WHERE key = ?", key)
+	return err
+}
+
+func (r *idempotencyRepository) DeleteBefore(cutoff time.Time) error {
+	_, err := r.db.Exec("DELETE FROM idempotency_keys WHERE created_at < ?", cutoff)
+	return err
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type IdempotencyService interface {
+	// Begin reserves key for the request and returns nil, or returns the
+	// stored response to replay. A key used for another request is
+	// ErrIdempotencyConflict; one whose first request is still running is
+	// ErrIdempotencyInProgress.
+	Begin(key, fingerprint string) (*IdempotentResponse, error)
+	Complete(key string, status int, contentType string, body []byte) error
+	// Release forgets key so the request can be retried.
+	Release(key string) error
+	Sweep(now time.Time) error
+}
+
+type idempotencyService struct {
+	db *sql.DB
+}
+
+func NewIdempotencyService(db *sql.DB) IdempotencyService {
+	return &idempotencyService{db: db}
+}
+
+func (s *idempotencyService) Begin(key, fingerprint string) (*IdempotentResponse, error) {
+	repo := NewIdempotencyRepository(s.db)
+
+	// The second pass runs after clearing an expired or abandoned entry
+	for attempt := 0; attempt < 2; attempt++ {
+		now := time.Now()
+		reserved, err := repo.Reserve(key, fingerprint, now)
+		if err != nil {
+			return nil, err
+		}
+		if reserved {
+			return nil, nil
+		}
+
+		existing, err := repo.Get(key)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		expired := now.Sub(existing.CreatedAt) > idempotencyKeyTTL
+		abandoned := existing.Status == 0 && now.Sub(existing.CreatedAt) > idempotencyLockTimeout
+		if expired || abandoned {
+			if err := repo.Delete(key); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if existing.Fingerprint != fingerprint {
+			return nil, ErrIdempotencyConflict
+		}
+		if existing.Status == 0 {
+			return nil, ErrIdempotencyInProgress
+		}
+		return existing, nil
+	}
+
+	return nil, ErrIdempotencyInProgress
+}
+
+func (s *idempotencyService) Complete(key string, status int, contentType string, body []byte) error {
+	return NewIdempotencyRepository(s.db).Complete(key, status, contentType, body)
+}
+
+func (s *idempotencyService) Release(key string) error {
+	return NewIdempotencyRepository(s.db).Delete(key)
+}
+
+func (s *idempotencyService) Sweep(now time.Time) error {
+	return NewIdempotencyRepository(s.db).DeleteBefore(now.Add(-idempotencyKeyTTL))
+}
+
+// requestFingerprint identifies what a request asks for, so a reused key
+// can be told apart from a retry. The Authorization header is part of it,
+// so one caller's key never replays another caller's response.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	io.WriteString(h, r.Header.Get("Authorization")+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type IdempotencyHandler struct {
+	service IdempotencyService
+}
+
+func NewIdempotencyHandler(service IdempotencyService) *IdempotencyHandler {
+	return &IdempotencyHandler{service: service}
+}
+
+// recordingWriter keeps a copy of the response body as it is written.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Handle makes mutating requests that carry an Idempotency-Key safe to
+// retry: the first response is stored and replayed for repeats of the same
+// request. Server errors are not stored, so those can be retried for real.
+func (h *IdempotencyHandler) Handle(c *gin.Context) {
+	key := c.GetHeader(idempotencyHeader)
+	method := c.Request.Method
+	if key == "" || method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions {
+		c.Next()
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		c.AbortWithStatusJSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Idempotency-Key must be at most 255 characters",
+		})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxIdempotentBodySize+1))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if len(body) > maxIdempotentBodySize {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, APIResponse{
+			Success: false,
+			Message: ErrUploadTooLarge.Error(),
+		})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	stored, err := h.service.Begin(key, requestFingerprint(c.Request, body))
+	if err == ErrIdempotencyConflict {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err == ErrIdempotencyInProgress {
+		c.AbortWithStatusJSON(http.StatusConflict, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if stored != nil {
+		c.Header("Idempotent-Replayed", "true")
+		c.Data(stored.Status, stored.ContentType, stored.Body)
+		c.Abort()
+		return
+	}
+
+	recorder := &recordingWriter{ResponseWriter: c.Writer}
+	c.Writer = recorder
+	c.Next()
+
+	// Rate-limited requests never ran, so they are not the answer either
+	status := recorder.Status()
+	if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+		err = h.service.Release(key)
+	} else {
+		err = h.service.Complete(key, status, recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+	}
+	if err != nil {
+		log.Printf("idempotency: store response for %s: %v", key, err)
+	}
+}
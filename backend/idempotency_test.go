@@ -0,0 +1,134 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestIdempotencyService(t *testing.T) (IdempotencyService, IdempotencyRepository) {
+	t.Helper()
+	db := newTestDB(t)
+	return NewIdempotencyService(db), NewIdempotencyRepository(db)
+}
+
+func TestIdempotencyBegin(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup runs against a fresh store before Begin("key", "fp")
+		setup      func(t *testing.T, s IdempotencyService, repo IdempotencyRepository)
+		wantErr    error
+		wantReplay bool
+	}{
+		{
+			name:  "new key",
+			setup: func(*testing.T, IdempotencyService, IdempotencyRepository) {},
+		},
+		{
+			name: "replay of a finished request",
+			setup: func(t *testing.T, s IdempotencyService, _ IdempotencyRepository) {
+				mustBegin(t, s, "fp")
+				if err := s.Complete("key", 201, "application/json", []byte(`{"success":true}`)); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantReplay: true,
+		},
+		{
+			name: "same key, different request",
+			setup: func(t *testing.T, s IdempotencyService, _ IdempotencyRepository) {
+				mustBegin(t, s, "other")
+				if err := s.Complete("key", 201, "application/json", nil); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: ErrIdempotencyConflict,
+		},
+		{
+			name: "first request still running",
+			setup: func(t *testing.T, s IdempotencyService, _ IdempotencyRepository) {
+				mustBegin(t, s, "fp")
+			},
+			wantErr: ErrIdempotencyInProgress,
+		},
+		{
+			name: "different request while the first is running",
+			setup: func(t *testing.T, s IdempotencyService, _ IdempotencyRepository) {
+				mustBegin(t, s, "other")
+			},
+			wantErr: ErrIdempotencyConflict,
+		},
+		{
+			name: "released after a server error",
+			setup: func(t *testing.T, s IdempotencyService, _ IdempotencyRepository) {
+				mustBegin(t, s, "fp")
+				if err := s.Release("key"); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "abandoned by a request that died",
+			setup: func(t *testing.T, _ IdempotencyService, repo IdempotencyRepository) {
+				if _, err := repo.Reserve("key", "fp", time.Now().Add(-idempotencyLockTimeout-time.Minute)); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "expired",
+			setup: func(t *testing.T, _ IdempotencyService, repo IdempotencyRepository) {
+				if _, err := repo.Reserve("key", "other", time.Now().Add(-idempotencyKeyTTL-time.Minute)); err != nil {
+					t.Fatal(err)
+				}
+				if err := repo.Complete("key", 200, "application/json", nil); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, repo := newTestIdempotencyService(t)
+			tt.setup(t, s, repo)
+
+			stored, err := s.Begin("key", "fp")
+			if err != tt.wantErr {
+				t.Fatalf("Begin() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := stored != nil; got != tt.wantReplay {
+				t.Fatalf("Begin() replay = %v, want %v", got, tt.wantReplay)
+			}
+			if tt.wantReplay && (stored.Status != 201 || string(stored.Body) != `{"success":true}`) {
+				t.Errorf("replayed %d %q", stored.Status, stored.Body)
+			}
+		})
+	}
+}
+
+func TestIdempotencySweep(t *testing.T) {
+	s, repo := newTestIdempotencyService(t)
+	now := time.Now()
+	if _, err := repo.Reserve("old", "fp", now.Add(-idempotencyKeyTTL-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Reserve("new", "fp", now); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Sweep(now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Get("old"); err == nil {
+		t.Error("an expired key survived the sweep")
+	}
+	if _, err := repo.Get("new"); err != nil {
+		t.Errorf("a live key was swept: %v", err)
+	}
+}
+
+func mustBegin(t *testing.T, s IdempotencyService, fingerprint string) {
+	t.Helper()
+	if stored, err := s.Begin("key", fingerprint); err != nil || stored != nil {
+		t.Fatalf("Begin() = %v, %v; want a fresh reservation", stored, err)
+	}
+}
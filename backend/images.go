@@ -0,0 +1,715 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ====================
+// MODELS
+// ====================
+
+// Upload is a stored file. Images are queued for the pipeline, which fills
+// in the dimensions and variants; other files are ready as soon as they are
+// stored. Paths are relative to the upload directory.
+type Upload struct {
+	ID           int            `json:"id" db:"id"`
+	OwnerType    string         `json:"ownerType" db:"owner_type"` // gallery, order
+	OwnerID      string         `json:"ownerId" db:"owner_id"`
+	Filename     string         `json:"filename" db:"filename"`
+	ContentType  string         `json:"contentType" db:"content_type"`
+	Size         int64          `json:"size" db:"size"`
+	OriginalPath string         `json:"-" db:"original_path"`
+	Width        int            `json:"width" db:"width"`
+	Height       int            `json:"height" db:"height"`
+	Status       string         `json:"status" db:"status"` // pending, processing, ready, failed
+	Error        string         `json:"error,omitempty" db:"error"`
+	Variants     []ImageVariant `json:"variants" db:"variants"` // stored as a JSON string
+	CreatedAt    time.Time      `json:"createdAt" db:"created_at"`
+	ProcessedAt  *time.Time     `json:"processedAt" db:"processed_at"`
+}
+
+type ImageVariant struct {
+	Name   string `json:"name"` // thumb, medium, large
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Format string `json:"format"` // jpeg or png
+	Size   int    `json:"size"`
+	Path   string `json:"-"`
+}
+
+// imageSizes are the variants made of every image, by longest edge. Images
+// are never upscaled, so small originals get identical variants.
+var imageSizes = []struct {
+	name string
+	edge int
+}{
+	{"thumb", 320},
+	{"medium", 960},
+	{"large", 1920},
+}
+
+const (
+	maxUploadSize = 20 << 20
+	// maxImagePixels guards against decompression bombs: a small file that
+	// decodes to an enormous bitmap.
+	maxImagePixels = 50_000_000
+	jpegQuality    = 85
+
+	imageWorkers       = 2
+	imageQueueSize     = 64
+	imageSweepInterval = time.Minute
+)
+
+// imageTypes maps the sniffed content types the pipeline can decode to the
+// file extension originals are stored under.
+var imageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+var (
+	ErrUploadTooLarge   = errors.New("file is larger than 20 MB")
+	ErrUnsupportedImage = errors.New("image must be a JPEG, PNG, GIF or WebP file")
+	ErrImageTooBig      = errors.New("image dimensions are too large")
+)
+
+// ====================
+// REPOSITORIES
+// ====================
+
+type UploadRepository interface {
+	Create(u *Upload) error
+	GetByID(id int) (*Upload, error)
+	GetByOwner(ownerType, ownerID string) ([]Upload, error)
+	GetPendingIDs() ([]int, error)
+	Claim(id int) (bool, error)
+	MarkReady(u *Upload) error
+	MarkFailed(id int, reason string) error
+	ResetProcessing() error
+	Delete(id int) error
+}
+
+type uploadRepository struct {
+	db DBTX
+}
+
+func NewUploadRepository(db DBTX) UploadRepository {
+	return &uploadRepository{db: db}
+}
+
+const uploadColumns = `id, owner_type, owner_id, filename, content_type, size, original_path, width, height,
+	status, error, variants, created_at, processed_at`
+
+func scanUpload(row rowScanner) (*Upload, error) {
+	var u Upload
+	var variants string
+	var processedAt sql.NullTime
+
+	err := row.Scan(&u.ID, &u.OwnerType, &u.OwnerID, &u.Filename, &u.ContentType, &u.Size,
+		&u.OriginalPath, &u.Width, &u.Height, &u.Status, &u.Error, &variants, &u.CreatedAt, &processedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Variants = parseVariants(variants)
+	if processedAt.Valid {
+		u.ProcessedAt = &processedAt.Time
+	}
+
+	return &u, nil
+}
+
+// parseVariants reads the stored variant list. Paths are kept in the JSON
+// but hidden from API responses, so they are decoded separately.
+func parseVariants(s string) []ImageVariant {
+	var stored []struct {
+		ImageVariant
+		Path string `json:"path"`
+	}
+	json.Unmarshal([]byte(s), &stored)
+
+	variants := []ImageVariant{}
+	for _, v := range stored {
+		v.ImageVariant.Path = v.Path
+		variants = append(variants, v.ImageVariant)
+	}
+	return variants
+}
+
+func formatVariants(variants []ImageVariant) string {
+	type stored struct {
+		ImageVariant
+		Path string `json:"path"`
+	}
+	list := []stored{}
+	for _, v := range variants {
+		list = append(list, stored{ImageVariant: v, Path: v.Path})
+	}
+	data, _ := json.Marshal(list)
+	return string(data)
+}
+
+func (r *uploadRepository) Create(u *Upload) error {
+	result, err := r.db.Exec(`
+		INSERT INTO uploads (owner_type, owner_id, filename, content_type, size, original_path, width, height,
+		status, error, variants, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, u.OwnerType, u.OwnerID, u.Filename, u.ContentType, u.Size, u.OriginalPath, u.Width, u.Height,
+		u.Status, u.Error, formatVariants(u.Variants), u.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	u.ID = int(id)
+
+	return nil
+}
+
+func (r *uploadRepository) GetByID(id int) (*Upload, error) {
+	return scanUpload(r.db.QueryRow("SELECT "+uploadColumns+" FROM uploads WHERE id = ?", id))
+}
+
+func (r *uploadRepository) GetByOwner(ownerType, ownerID string) ([]Upload, error) {
+	rows, err := r.db.Query("SELECT "+uploadColumns+" FROM uploads WHERE owner_type = ? AND owner_id = ? ORDER BY id",
+		ownerType, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []Upload{}
+	for rows.Next() {
+		u, err := scanUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, *u)
+	}
+
+	return uploads, rows.Err()
+}
+
+func (r *uploadRepository) GetPendingIDs() ([]int, error) {
+	rows, err := r.db.Query("SELECT id FROM uploads WHERE status = 'pending' ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// Claim moves a pending upload to processing. It reports false when another
+// worker got there first, so each upload is processed once.
+func (r *uploadRepository) Claim(id int) (bool, error) {
+	result, err := r.db.Exec("UPDATE uploads SET status = 'processing' WHERE id = ? AND status = 'pending'", id)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected == 1, nil
+}
+
+func (r *uploadRepository) MarkReady(u *Upload) error {
+	_, err := r.db.Exec(`
+		UPDATE uploads SET status = 'ready', error = '', width = ?, height = ?, variants = ?, processed_at = ?
+		WHERE id = ?
+	`, u.Width, u.Height, formatVariants(u.Variants), time.Now(), u.ID)
+	return err
+}
+
+func (r *uploadRepository) MarkFailed(id int, reason string) error {
+	_, err := r.db.Exec("UPDATE uploads SET status = 'failed', error = ?, processed_at = ? WHERE id = ?",
+		reason, time.Now(), id)
+	return err
+}
+
+// ResetProcessing requeues uploads whose worker died with the previous
+// process.
+func (r *uploadRepository) ResetProcessing() error {
+	_, err := r.db.Exec("UPDATE uploads SET status = 'pending' WHERE status = 'processing'")
+	return err
+}
+
+func (r *uploadRepository) Delete(id int) error {
+	result, err := r.db.Exec("DELETE FROM uploads WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// ====================
+// STORAGE
+// ====================
+
+// variantDir is where an owner's variants go. Gallery variants are served
+// as static files; everything else is only reachable through handlers.
+func variantDir(ownerType string) string {
+	if ownerType == "gallery" {
+		return "gallery"
+	}
+	return filepath.Join("private", ownerType)
+}
+
+// storeUpload saves the original under a random name and records it. Image
+// types are left pending for the pipeline; with imagesOnly set anything
+// else is rejected.
+func storeUpload(db DBTX, root, ownerType, ownerID, filename string, data []byte, imagesOnly bool) (*Upload, error) {
+	if len(data) > maxUploadSize {
+		return nil, ErrUploadTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, isImage := imageTypes[contentType]
+	if !isImage {
+		if imagesOnly {
+			return nil, ErrUnsupportedImage
+		}
+		ext = strings.ToLower(filepath.Ext(filename))
+	}
+
+	if isImage {
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err == nil && config.Width*config.Height > maxImagePixels {
+			return nil, ErrImageTooBig
+		}
+		if err != nil && imagesOnly {
+			return nil, ErrUnsupportedImage
+		}
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	original := filepath.Join("originals", token+ext)
+	if err := os.MkdirAll(filepath.Join(root, "originals"), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(root, original), data, 0o644); err != nil {
+		return nil, err
+	}
+
+	u := &Upload{
+		OwnerType:    ownerType,
+		OwnerID:      ownerID,
+		Filename:     filepath.Base(filename),
+		ContentType:  contentType,
+		Size:         int64(len(data)),
+		OriginalPath: original,
+		Status:       "ready",
+		Variants:     []ImageVariant{},
+		CreatedAt:    time.Now(),
+	}
+	if isImage {
+		u.Status = "pending"
+	}
+	if err := NewUploadRepository(db).Create(u); err != nil {
+		os.Remove(filepath.Join(root, original))
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// removeUploadFiles deletes the original and every variant of an upload.
+func removeUploadFiles(root string, u *Upload) {
+	os.Remove(filepath.Join(root, u.OriginalPath))
+	for _, v := range u.Variants {
+		os.Remove(filepath.Join(root, v.Path))
+	}
+}
+
+// deleteUploads removes every upload an owner has, with its files; the
+// files go only once the rows are gone.
+func deleteUploads(db DBTX, root, ownerType, ownerID string) error {
+	repo := NewUploadRepository(db)
+	uploads, err := repo.GetByOwner(ownerType, ownerID)
+	if err != nil {
+		return err
+	}
+	for i := range uploads {
+		if err := repo.Delete(uploads[i].ID); err != nil {
+			return err
+		}
+		removeUploadFiles(root, &uploads[i])
+	}
+	return nil
+}
+
+// variantFile picks the stored file for a requested size: a named variant
+// once processing is done, otherwise the original.
+func variantFile(u *Upload, size string) (path, contentType string) {
+	for _, v := range u.Variants {
+		if v.Name == size {
+			return v.Path, "image/" + v.Format
+		}
+	}
+	return u.OriginalPath, u.ContentType
+}
+
+// ====================
+// PIPELINE
+// ====================
+
+// ImagePipeline turns uploaded originals into re-encoded variants on a pool
+// of background workers, so uploads return as soon as the file is stored.
+// Re-encoding also drops EXIF and GPS metadata. Work lives in the uploads
+// table, so anything still queued at shutdown is picked up on restart.
+type ImagePipeline struct {
+	db      *sql.DB
+	root    string
+	workers int
+	queue   chan int
+	once    sync.Once
+}
+
+func NewImagePipeline(db *sql.DB, root string, workers int) *ImagePipeline {
+	return &ImagePipeline{db: db, root: root, workers: workers, queue: make(chan int, imageQueueSize)}
+}
+
+func (p *ImagePipeline) Start(ctx context.Context) {
+	p.once.Do(func() {
+		if err := NewUploadRepository(p.db).ResetProcessing(); err != nil {
+			log.Printf("images: %v", err)
+		}
+		for i := 0; i < p.workers; i++ {
+			go p.work(ctx)
+		}
+	})
+}
+
+// Enqueue hands an upload to the workers without blocking. When the queue
+// is full the upload stays pending until the next Sweep.
+func (p *ImagePipeline) Enqueue(id int) {
+	select {
+	case p.queue <- id:
+	default:
+	}
+}
+
+// Sweep queues every pending upload; it runs on the scheduler to catch
+// uploads that did not fit in the queue or survived a restart.
+func (p *ImagePipeline) Sweep(now time.Time) error {
+	ids, err := NewUploadRepository(p.db).GetPendingIDs()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		p.Enqueue(id)
+	}
+	return nil
+}
+
+func (p *ImagePipeline) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-p.queue:
+			if err := p.process(id); err != nil {
+				log.Printf("images: upload %d: %v", id, err)
+			}
+		}
+	}
+}
+
+func (p *ImagePipeline) process(id int) error {
+	repo := NewUploadRepository(p.db)
+	claimed, err := repo.Claim(id)
+	if err != nil || !claimed {
+		return err
+	}
+
+	u, err := repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	variants, err := p.render(u)
+	if err != nil {
+		return repo.MarkFailed(id, err.Error())
+	}
+	u.Variants = variants
+
+	if err := repo.MarkReady(u); err != nil {
+		return err
+	}
+
+	// The owner may have been deleted or replaced the image while we worked
+	if _, err := repo.GetByID(id); err == sql.ErrNoRows {
+		removeUploadFiles(p.root, u)
+	}
+	return nil
+}
+
+// render decodes the original and writes one file per entry in imageSizes.
+// It fills in the upload's dimensions, after applying EXIF orientation.
+func (p *ImagePipeline) render(u *Upload) ([]ImageVariant, error) {
+	data, err := os.ReadFile(filepath.Join(p.root, u.OriginalPath))
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := decodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	u.Width, u.Height = bounds.Dx(), bounds.Dy()
+
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	dir := variantDir(u.OwnerType)
+	if err := os.MkdirAll(filepath.Join(p.root, dir), 0o755); err != nil {
+		return nil, err
+	}
+
+	var variants []ImageVariant
+	for _, size := range imageSizes {
+		scaled := scaleToFit(img, size.edge)
+		encoded, format, err := encodeImage(scaled)
+		if err != nil {
+			return nil, err
+		}
+
+		ext := ".jpg"
+		if format == "png" {
+			ext = ".png"
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%d-%s-%s%s", u.ID, token[:8], size.name, ext))
+		if err := os.WriteFile(filepath.Join(p.root, path), encoded, 0o644); err != nil {
+			return nil, err
+		}
+
+		b := scaled.Bounds()
+		variants = append(variants, ImageVariant{
+			Name:   size.name,
+			Width:  b.Dx(),
+			Height: b.Dy(),
+			Format: format,
+			Size:   len(encoded),
+			Path:   path,
+		})
+	}
+
+	return variants, nil
+}
+
+// ====================
+// IMAGE HELPERS
+// ====================
+
+func decodeImage(data []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, ErrImageTooBig
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return applyOrientation(img, jpegOrientation(data)), nil
+}
+
+// scaleToFit shrinks img so its longest edge is at most edge pixels.
+func scaleToFit(img image.Image, edge int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= edge && h <= edge {
+		return img
+	}
+
+	if w >= h {
+		h = max(1, h*edge/w)
+		w = edge
+	} else {
+		w = max(1, w*edge/h)
+		h = edge
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// encodeImage writes opaque images as JPEG and keeps PNG for anything with
+// transparency. Only pixel data is written, so metadata never survives.
+func encodeImage(img image.Image) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if isOpaque(img) {
+		err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+		return buf.Bytes(), "jpeg", err
+	}
+
+	err := (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+	return buf.Bytes(), "png", err
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// jpegOrientation reads the EXIF Orientation tag (1-8) from a JPEG's APP1
+// segment. It returns 1, upright, when there is none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			return 1 // start of scan: no more metadata
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < entries; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if v := int(order.Uint16(tiff[entry+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// applyOrientation rotates and mirrors img so it displays upright once the
+// EXIF tag that described its orientation is gone.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	swap := orientation >= 5
+	dw, dh := w, h
+	if swap {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90 counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, color.RGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// MODELS
+// ====================
+
+type ImportOptions struct {
+	DryRun    bool
+	BatchSize int
+}
+
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+type ImportReport struct {
+	DryRun         bool             `json:"dryRun"`
+	TotalRows      int              `json:"totalRows"`
+	Imported       int              `json:"imported"`
+	Failed         int              `json:"failed"`
+	IgnoredColumns []string         `json:"ignoredColumns,omitempty"`
+	Errors         []ImportRowError `json:"errors,omitempty"`
+}
+
+const defaultImportBatchSize = 500
+
+// importRow is one parsed CSV line. ID and CreatedAt are optional columns
+// used to keep the original identifiers and dates of historical orders.
+type importRow struct {
+	line      int
+	req       OrderRequest
+	id        string
+	createdAt time.Time
+}
+
+// importColumns maps normalized CSV headers (lowercase, letters and digits
+// only) to the OrderRequest field they fill. The headers written by the
+// order export are accepted as-is.
+var importColumns = map[string]string{
+	"id":                      "id",
+	"orderid":                 "id",
+	"clientname":              "clientName",
+	"name":                    "clientName",
+	"email":                   "email",
+	"phone":                   "phone",
+	"company":                 "company",
+	"projecttype":             "projectType",
+	"services":                "services",
+	"projecttitle":            "projectTitle",
+	"title":                   "projectTitle",
+	"description":             "description",
+	"budget":                  "budget",
+	"deadline":                "deadline",
+	"priority":                "priority",
+	"status":                  "status",
+	"communicationpreference": "communicationPreference",
+	"revisionrounds":          "revisionRounds",
+	"fileformat":              "fileFormat",
+	"colorpreferences":        "colorPreferences",
+	"targetaudience":          "targetAudience",
+	"additionalnotes":         "additionalNotes",
+	"notes":                   "additionalNotes",
+	"createdat":               "createdAt",
+	"date":                    "createdAt",
+}
+
+var importDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"02/01/2006",
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type ImportService interface {
+	ImportOrders(r io.Reader, opts ImportOptions) (*ImportReport, error)
+}
+
+type importService struct {
+	db *sql.DB
+}
+
+func NewImportService(db *sql.DB) ImportService {
+	return &importService{db: db}
+}
+
+// ImportOrders reads orders from CSV and inserts them in transactions of
+// opts.BatchSize rows. A row that fails validation or insertion is reported
+// and skipped without affecting the rest of its batch. With opts.DryRun every
+// batch is rolled back, so the report shows what a real run would do.
+func (s *importService) ImportOrders(r io.Reader, opts ImportOptions) (*ImportReport, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultImportBatchSize
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("CSV file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{DryRun: opts.DryRun}
+	fields := make([]string, len(header))
+	for i, name := range header {
+		fields[i] = importColumns[normalizeHeader(name)]
+		if fields[i] == "" && strings.TrimSpace(name) != "" {
+			report.IgnoredColumns = append(report.IgnoredColumns, name)
+		}
+	}
+
+	var batch []importRow
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			report.TotalRows++
+			report.fail(line, err.Error())
+			continue
+		}
+		if isBlankRecord(record) {
+			continue
+		}
+
+		report.TotalRows++
+		row, err := parseImportRow(line, fields, record)
+		if err != nil {
+			report.fail(line, err.Error())
+			continue
+		}
+
+		batch = append(batch, row)
+		if len(batch) == opts.BatchSize {
+			if err := s.importBatch(batch, opts.DryRun, report); err != nil {
+				return report, err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		if err := s.importBatch(batch, opts.DryRun, report); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+func (s *importService) importBatch(rows []importRow, dryRun bool, report *ImportReport) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	orders := &orderService{
+		orderRepo:  NewOrderRepository(tx),
+		clientRepo: NewClientRepository(tx),
+	}
+
+	imported := 0
+	for _, row := range rows {
+		// A savepoint per row keeps a half-written row (order inserted,
+		// client upsert failed) out of the batch.
+		if _, err := tx.Exec("SAVEPOINT import_row"); err != nil {
+			return err
+		}
+
+		if err := importOrder(orders, row); err != nil {
+			if _, rbErr := tx.Exec("ROLLBACK TO import_row"); rbErr != nil {
+				return rbErr
+			}
+			report.fail(row.line, err.Error())
+		} else {
+			imported++
+		}
+
+		if _, err := tx.Exec("RELEASE import_row"); err != nil {
+			return err
+		}
+	}
+
+	if !dryRun {
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	report.Imported += imported
+	return nil
+}
+
+func importOrder(s *orderService, row importRow) error {
+	createdAt := row.createdAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	order, err := newOrderFromRequest(row.req, createdAt)
+	if err != nil {
+		return err
+	}
+	if row.id != "" {
+		if _, err := s.orderRepo.GetByID(row.id); err == nil {
+			return fmt.Errorf("order %s already exists", row.id)
+		}
+		order.ID = row.id
+	}
+
+	if err := s.orderRepo.Create(order); err != nil {
+		return err
+	}
+
+	return s.updateClientRecord(row.req.Email, row.req.ClientName, row.req.Phone, row.req.Company, createdAt)
+}
+
+func (r *ImportReport) fail(line int, message string) {
+	r.Failed++
+	r.Errors = append(r.Errors, ImportRowError{Row: line, Message: message})
+}
+
+func parseImportRow(line int, fields, record []string) (importRow, error) {
+	row := importRow{line: line}
+	req := &row.req
+
+	for i, value := range record {
+		if i >= len(fields) || fields[i] == "" {
+			continue
+		}
+		value = unescapeFormula(strings.TrimSpace(value))
+
+		switch fields[i] {
+		case "id":
+			row.id = value
+		case "clientName":
+			req.ClientName = value
+		case "email":
+			req.Email = strings.ToLower(value)
+		case "phone":
+			req.Phone = value
+		case "company":
+			req.Company = value
+		case "projectType":
+			req.ProjectType = value
+		case "services":
+			req.Services = splitImportList(value)
+		case "projectTitle":
+			req.ProjectTitle = value
+		case "description":
+			req.Description = value
+		case "budget":
+			req.Budget = value
+		case "deadline":
+			req.Deadline = value
+		case "priority":
+			req.Priority = strings.ToLower(value)
+		case "status":
+			req.Status = strings.ToLower(value)
+		case "communicationPreference":
+			req.CommunicationPreference = value
+		case "revisionRounds":
+			req.RevisionRounds = value
+		case "fileFormat":
+			req.FileFormat = splitImportList(value)
+		case "colorPreferences":
+			req.ColorPreferences = value
+		case "targetAudience":
+			req.TargetAudience = value
+		case "additionalNotes":
+			req.AdditionalNotes = value
+		case "createdAt":
+			if value == "" {
+				continue
+			}
+			createdAt, err := parseImportDate(value)
+			if err != nil {
+				return row, err
+			}
+			row.createdAt = createdAt
+		}
+	}
+
+	return row, validateOrderRequest(*req)
+}
+
+// validateOrderRequest checks the fields an order cannot be stored without
+// and that enumerated fields hold known values.
+func validateOrderRequest(req OrderRequest) error {
+	if req.ClientName == "" {
+		return errors.New("clientName is required")
+	}
+	if req.Email == "" {
+		return errors.New("email is required")
+	}
+	if _, err := mail.ParseAddress(req.Email); err != nil {
+		return fmt.Errorf("invalid email %q", req.Email)
+	}
+	if req.Status != "" && !orderStatuses[req.Status] {
+		return fmt.Errorf("unknown status %q", req.Status)
+	}
+	if req.Priority != "" && !orderPriorities[req.Priority] {
+		return fmt.Errorf("unknown priority %q", req.Priority)
+	}
+
+	return nil
+}
+
+func parseImportDate(value string) (time.Time, error) {
+	for _, layout := range importDateLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", value)
+}
+
+// splitImportList accepts both the "a; b" form written by the export and a
+// plain comma-separated list.
+func splitImportList(value string) []string {
+	sep := ","
+	if strings.Contains(value, ";") {
+		sep = ";"
+	}
+
+	items := []string{}
+	for _, item := range strings.Split(value, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func normalizeHeader(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func isBlankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type ImportHandler struct {
+	service ImportService
+}
+
+func NewImportHandler(service ImportService) *ImportHandler {
+	return &ImportHandler{service: service}
+}
+
+// ImportOrders accepts the CSV either as a multipart "file" field or as the
+// raw request body.
+func (h *ImportHandler) ImportOrders(c *gin.Context) {
+	dryRun, _ := strconv.ParseBool(c.DefaultQuery("dryRun", "false"))
+	batchSize, _ := strconv.Atoi(c.DefaultQuery("batchSize", strconv.Itoa(defaultImportBatchSize)))
+
+	var body io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+
+	report, err := h.service.ImportOrders(body, ImportOptions{DryRun: dryRun, BatchSize: batchSize})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+			Data:    report,
+		})
+		return
+	}
+
+	message := fmt.Sprintf("Imported %d of %d rows", report.Imported, report.TotalRows)
+	if dryRun {
+		message = fmt.Sprintf("Dry run: %d of %d rows would be imported", report.Imported, report.TotalRows)
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    report,
+	})
+}
+
+// ====================
+// CLI
+// ====================
+
+// runImportCommand implements `import-orders [-dry-run] [-batch N] file.csv`.
+// The report is printed as JSON; the exit status is non-zero if any row failed.
+func runImportCommand(db *sql.DB, args []string) int {
+	fs := flag.NewFlagSet("import-orders", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "validate and report without saving")
+	batchSize := fs.Int("batch", defaultImportBatchSize, "rows per transaction")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: import-orders [-dry-run] [-batch N] file.csv")
+		return 2
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer f.Close()
+
+	report, err := NewImportService(db).ImportOrders(f, ImportOptions{DryRun: *dryRun, BatchSize: *batchSize})
+	if report != nil {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if report.Failed > 0 {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+const importTestCSV = `Order ID,Client Name,Email,Project Type,Services,Project Title,Status,Created At
+ORD-IMPORT-1,Ada,ada@example.com,logo,Logo Design; Branding,Bakery logo,completed,2024-05-01
+ORD-IMPORT-2,Bad Client,bad@example.com,logo,Logo Design,Rejected,pending,2024-05-02
+ORD-IMPORT-3,No Email,,logo,Logo Design,Missing email,pending,2024-05-03
+ORD-IMPORT-4,Grace,grace@example.com,web,Web Design,Shop,in-progress,2024-05-04
+`
+
+// rejectClient makes inserting bad@example.com's client row fail, after the
+// row's order has already been written.
+func rejectClient(t *testing.T, db *sql.DB) {
+	t.Helper()
+	_, err := db.Exec(`
+		CREATE TRIGGER reject_client BEFORE INSERT ON clients
+		WHEN NEW.email = 'bad@example.com'
+		BEGIN SELECT RAISE(ABORT, 'client rejected'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func countRows(t *testing.T, db *sql.DB, query string, args ...interface{}) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestImportOrders(t *testing.T) {
+	for _, batchSize := range []int{1, 2, 100} {
+		db := newTestDB(t)
+		rejectClient(t, db)
+
+		report, err := NewImportService(db).ImportOrders(strings.NewReader(importTestCSV), ImportOptions{BatchSize: batchSize})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.TotalRows != 4 || report.Imported != 2 || report.Failed != 2 {
+			t.Errorf("batch size %d: report = %+v, want 2 of 4 imported", batchSize, report)
+		}
+		// Rows that fail validation are reported before their batch runs
+		failed := map[int]bool{}
+		for _, e := range report.Errors {
+			failed[e.Row] = true
+		}
+		if len(report.Errors) != 2 || !failed[3] || !failed[4] {
+			t.Errorf("batch size %d: errors = %+v, want rows 3 and 4", batchSize, report.Errors)
+		}
+
+		// The failed row's order was written before its client; the
+		// savepoint takes it back out without touching its neighbours
+		if n := countRows(t, db, "SELECT COUNT(*) FROM orders WHERE id = 'ORD-IMPORT-2'"); n != 0 {
+			t.Errorf("batch size %d: the half-imported order was kept", batchSize)
+		}
+		if n := countRows(t, db, "SELECT COUNT(*) FROM orders WHERE id IN ('ORD-IMPORT-1', 'ORD-IMPORT-4')"); n != 2 {
+			t.Errorf("batch size %d: %d of the good orders imported, want 2", batchSize, n)
+		}
+		if n := countRows(t, db, "SELECT COUNT(*) FROM clients"); n != 2 {
+			t.Errorf("batch size %d: %d clients, want 2", batchSize, n)
+		}
+	}
+}
+
+func TestImportOrdersDryRun(t *testing.T) {
+	db := newTestDB(t)
+	rejectClient(t, db)
+
+	report, err := NewImportService(db).ImportOrders(strings.NewReader(importTestCSV), ImportOptions{DryRun: true, BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.DryRun || report.Imported != 2 || report.Failed != 2 {
+		t.Errorf("report = %+v, want a dry run with 2 of 4 importable", report)
+	}
+	if n := countRows(t, db, "SELECT COUNT(*) FROM orders"); n != 0 {
+		t.Errorf("dry run left %d orders", n)
+	}
+	if n := countRows(t, db, "SELECT COUNT(*) FROM clients"); n != 0 {
+		t.Errorf("dry run left %d clients", n)
+	}
+
+	// Running it again for real imports the same rows
+	report, err = NewImportService(db).ImportOrders(strings.NewReader(importTestCSV), ImportOptions{BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != 2 {
+		t.Errorf("real run imported %d, want 2", report.Imported)
+	}
+}
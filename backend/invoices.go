@@ -0,0 +1,811 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// MODELS
+// ====================
+
+type Invoice struct {
+	ID        int     `json:"id" db:"id"`
+	Number    string  `json:"number" db:"number"`
+	OrderID   string  `json:"orderId" db:"order_id"`
+	ClientID  string  `json:"clientId" db:"client_id"`
+	Status    string  `json:"status" db:"status"`
+	Currency  string  `json:"currency" db:"currency"`
+	Subtotal  float64 `json:"subtotal" db:"subtotal"`
+	TaxRate   float64 `json:"taxRate" db:"tax_rate"` // percent
+	TaxAmount float64 `json:"taxAmount" db:"tax_amount"`
+	Total     float64 `json:"total" db:"total"`
+	Notes     string  `json:"notes" db:"notes"`
+	// Who the invoice was made out to, as it stood when it was created
+	BillToName    string        `json:"billToName" db:"bill_to_name"`
+	BillToEmail   string        `json:"billToEmail" db:"bill_to_email"`
+	BillToPhone   string        `json:"billToPhone" db:"bill_to_phone"`
+	BillToCompany string        `json:"billToCompany" db:"bill_to_company"`
+	IssueDate     time.Time     `json:"issueDate" db:"issue_date"`
+	DueDate       time.Time     `json:"dueDate" db:"due_date"`
+	CreatedAt     time.Time     `json:"createdAt" db:"created_at"`
+	UpdatedAt     time.Time     `json:"updatedAt" db:"updated_at"`
+	Items         []InvoiceItem `json:"items"`
+}
+
+type InvoiceItem struct {
+	ID          int     `json:"id" db:"id"`
+	InvoiceID   int     `json:"invoiceId" db:"invoice_id"`
+	Description string  `json:"description" db:"description"`
+	Quantity    float64 `json:"quantity" db:"quantity"`
+	UnitPrice   float64 `json:"unitPrice" db:"unit_price"`
+	Amount      float64 `json:"amount" db:"amount"`
+}
+
+// ====================
+// DTOs
+// ====================
+
+// InvoiceRequest creates an invoice for an order. Without Items the order's
+// final price is split across its Services.
+type InvoiceRequest struct {
+	OrderID   string               `json:"orderId"`
+	TaxRate   *float64             `json:"taxRate"`
+	DueInDays int                  `json:"dueInDays"`
+	Notes     string               `json:"notes"`
+	Items     []InvoiceItemRequest `json:"items"`
+}
+
+type InvoiceItemRequest struct {
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	UnitPrice   float64 `json:"unitPrice"`
+}
+
+type InvoiceStatusRequest struct {
+	Status string `json:"status"`
+}
+
+const (
+	invoiceBrandName      = "Alle"
+	invoiceCurrency       = "USD"
+	defaultInvoiceDueDays = 14
+	defaultInvoiceTaxRate = 0
+)
+
+// invoiceTransitions lists the statuses each invoice status may move to.
+var invoiceTransitions = map[string][]string{
+	"draft": {"sent", "void"},
+	"sent":  {"paid", "void"},
+	"paid":  {},
+	"void":  {},
+}
+
+var (
+	ErrOrderNotPriced           = errors.New("order has no final price")
+	ErrInvalidInvoiceItems      = errors.New("invoice items need a description, a positive quantity and a non-negative price")
+	ErrInvalidInvoiceTransition = errors.New("invoice status change not allowed")
+	ErrInvalidTaxRate           = errors.New("tax rate must be between 0 and 100")
+)
+
+// ====================
+// REPOSITORIES
+// ====================
+
+type InvoiceRepository interface {
+	NextNumber(year int) (string, error)
+	Create(invoice *Invoice) error
+	GetAll(orderID string) ([]Invoice, error)
+	GetByID(id int) (*Invoice, error)
+	UpdateStatus(id int, status string) error
+}
+
+type invoiceRepository struct {
+	db DBTX
+}
+
+func NewInvoiceRepository(db DBTX) InvoiceRepository {
+	return &invoiceRepository{db: db}
+}
+
+// NextNumber advances the per-year sequence and formats it as INV-YYYY-NNNN.
+// Call it inside the transaction that creates the invoice so numbers are
+// never skipped.
+func (r *invoiceRepository) NextNumber(year int) (string, error) {
+	_, err := r.db.Exec(`
+		INSERT INTO invoice_sequences (year, last_value) VALUES (?, 1)
+		ON CONFLICT(year) DO UPDATE SET last_value = last_value + 1
+	`, year)
+	if err != nil {
+		return "", err
+	}
+
+	var value int
+	err = r.db.QueryRow("SELECT last_value FROM invoice_sequences WHERE year = ?", year).Scan(&value)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("INV-%d-%04d", year, value), nil
+}
+
+func (r *invoiceRepository) Create(invoice *Invoice) error {
+	result, err := r.db.Exec(`
+		INSERT INTO invoices (number, order_id, client_id, status, currency, subtotal, tax_rate,
+		tax_amount, total, notes, bill_to_name, bill_to_email, bill_to_phone, bill_to_company,
+		issue_date, due_date, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, invoice.Number, invoice.OrderID, invoice.ClientID, invoice.Status, invoice.Currency,
+		invoice.Subtotal, invoice.TaxRate, invoice.TaxAmount, invoice.Total, invoice.Notes,
+		invoice.BillToName, invoice.BillToEmail, invoice.BillToPhone, invoice.BillToCompany,
+		invoice.IssueDate, invoice.DueDate, invoice.CreatedAt, invoice.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	invoice.ID = int(id)
+
+	for i := range invoice.Items {
+		item := &invoice.Items[i]
+		item.InvoiceID = invoice.ID
+		result, err := r.db.Exec(`
+			INSERT INTO invoice_items (invoice_id, description, quantity, unit_price, amount)
+			VALUES (?, ?, ?, ?, ?)
+		`, item.InvoiceID, item.Description, item.Quantity, item.UnitPrice, item.Amount)
+		if err != nil {
+			return err
+		}
+		itemID, _ := result.LastInsertId()
+		item.ID = int(itemID)
+	}
+
+	return nil
+}
+
+const invoiceColumns = `id, number, order_id, client_id, status, currency, subtotal, tax_rate,
+	tax_amount, total, notes, bill_to_name, bill_to_email, bill_to_phone, bill_to_company,
+	issue_date, due_date, created_at, updated_at`
+
+func scanInvoice(row rowScanner) (*Invoice, error) {
+	var inv Invoice
+	err := row.Scan(&inv.ID, &inv.Number, &inv.OrderID, &inv.ClientID, &inv.Status, &inv.Currency,
+		&inv.Subtotal, &inv.TaxRate, &inv.TaxAmount, &inv.Total, &inv.Notes,
+		&inv.BillToName, &inv.BillToEmail, &inv.BillToPhone, &inv.BillToCompany,
+		&inv.IssueDate, &inv.DueDate, &inv.CreatedAt, &inv.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &inv, nil
+}
+
+func (r *invoiceRepository) GetAll(orderID string) ([]Invoice, error) {
+	query := "SELECT " + invoiceColumns + " FROM invoices"
+	var args []interface{}
+	if orderID != "" {
+		query += " WHERE order_id = ?"
+		args = append(args, orderID)
+	}
+	query += " ORDER BY id DESC"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invoices []Invoice
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, *inv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range invoices {
+		if invoices[i].Items, err = r.getItems(invoices[i].ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return invoices, nil
+}
+
+func (r *invoiceRepository) GetByID(id int) (*Invoice, error) {
+	inv, err := scanInvoice(r.db.QueryRow("SELECT "+invoiceColumns+" FROM invoices WHERE id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	inv.Items, err = r.getItems(inv.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return inv, nil
+}
+
+func (r *invoiceRepository) getItems(invoiceID int) ([]InvoiceItem, error) {
+	rows, err := r.db.Query(`
+		SELECT id, invoice_id, description, quantity, unit_price, amount
+		FROM invoice_items WHERE invoice_id = ? ORDER BY id
+	`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []InvoiceItem{}
+	for rows.Next() {
+		var item InvoiceItem
+		err := rows.Scan(&item.ID, &item.InvoiceID, &item.Description, &item.Quantity,
+			&item.UnitPrice, &item.Amount)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+func (r *invoiceRepository) UpdateStatus(id int, status string) error {
+	result, err := r.db.Exec("UPDATE invoices SET status = ?, updated_at = ? WHERE id = ?",
+		status, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type InvoiceService interface {
+	CreateInvoice(req InvoiceRequest) (*Invoice, error)
+	GetInvoices(orderID string) ([]Invoice, error)
+	GetInvoice(id int) (*Invoice, error)
+	UpdateInvoiceStatus(id int, status string) (*Invoice, error)
+	RenderInvoicePDF(id int, w io.Writer) error
+}
+
+type invoiceService struct {
+	db *sql.DB
+}
+
+func NewInvoiceService(db *sql.DB) InvoiceService {
+	return &invoiceService{db: db}
+}
+
+func (s *invoiceService) CreateInvoice(req InvoiceRequest) (*Invoice, error) {
+	taxRate := float64(defaultInvoiceTaxRate)
+	if req.TaxRate != nil {
+		taxRate = *req.TaxRate
+	}
+	// The invoice gets a number that can't be reused, so check before that
+	if taxRate < 0 || taxRate > 100 {
+		return nil, ErrInvalidTaxRate
+	}
+
+	order, err := NewOrderRepository(s.db).GetByID(req.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := invoiceItems(order, req.Items)
+	if err != nil {
+		return nil, err
+	}
+	dueInDays := req.DueInDays
+	if dueInDays <= 0 {
+		dueInDays = defaultInvoiceDueDays
+	}
+
+	now := time.Now()
+	invoice := &Invoice{
+		OrderID:   order.ID,
+		Status:    "draft",
+		Currency:  invoiceCurrency,
+		TaxRate:   taxRate,
+		Notes:     req.Notes,
+		IssueDate: now,
+		DueDate:   now.AddDate(0, 0, dueInDays),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Items:     items,
+	}
+	for _, item := range items {
+		invoice.Subtotal += item.Amount
+	}
+	invoice.Subtotal = roundMoney(invoice.Subtotal)
+	invoice.TaxAmount = roundMoney(invoice.Subtotal * taxRate / 100)
+	invoice.Total = roundMoney(invoice.Subtotal + invoice.TaxAmount)
+
+	// Bill-to details come from the client record when there is one and
+	// fall back to what was captured on the order. They are copied so the
+	// invoice keeps showing who it was issued to when the client changes.
+	billTo := PersonalData{Name: order.ClientName, Email: order.Email, Phone: order.Phone, Company: order.Company}
+	if client, err := NewClientRepository(s.db).GetByEmail(order.Email); err == nil {
+		invoice.ClientID = client.ID
+		billTo = PersonalData{Name: client.Name, Email: client.Email, Phone: client.Phone, Company: client.Company}
+	}
+	invoice.BillToName = billTo.Name
+	invoice.BillToEmail = billTo.Email
+	invoice.BillToPhone = billTo.Phone
+	invoice.BillToCompany = billTo.Company
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	repo := NewInvoiceRepository(tx)
+	invoice.Number, err = repo.NextNumber(now.Year())
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.Create(invoice); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return invoice, nil
+}
+
+// invoiceItems uses the requested line items when given; otherwise it bills
+// the order's final price as one line per service, putting any rounding
+// remainder on the last line.
+func invoiceItems(order *Order, requested []InvoiceItemRequest) ([]InvoiceItem, error) {
+	var items []InvoiceItem
+
+	if len(requested) > 0 {
+		for _, r := range requested {
+			if strings.TrimSpace(r.Description) == "" || r.Quantity <= 0 || r.UnitPrice < 0 {
+				return nil, ErrInvalidInvoiceItems
+			}
+			unitPrice := roundMoney(r.UnitPrice)
+			items = append(items, InvoiceItem{
+				Description: r.Description,
+				Quantity:    r.Quantity,
+				UnitPrice:   unitPrice,
+				Amount:      roundMoney(r.Quantity * unitPrice),
+			})
+		}
+		return items, nil
+	}
+
+	if order.FinalPrice <= 0 {
+		return nil, ErrOrderNotPriced
+	}
+
+	services := strings.Split(flattenJSONList(order.Services), "; ")
+	if len(services) == 1 && services[0] == "" {
+		title := order.ProjectTitle
+		if title == "" {
+			title = "Design services"
+		}
+		services = []string{title}
+	}
+
+	share := math.Floor(order.FinalPrice/float64(len(services))*100) / 100
+	remaining := order.FinalPrice
+	for i, service := range services {
+		amount := share
+		if i == len(services)-1 {
+			amount = roundMoney(remaining)
+		}
+		remaining -= amount
+		items = append(items, InvoiceItem{
+			Description: service,
+			Quantity:    1,
+			UnitPrice:   amount,
+			Amount:      amount,
+		})
+	}
+
+	return items, nil
+}
+
+func (s *invoiceService) GetInvoices(orderID string) ([]Invoice, error) {
+	return NewInvoiceRepository(s.db).GetAll(orderID)
+}
+
+func (s *invoiceService) GetInvoice(id int) (*Invoice, error) {
+	return NewInvoiceRepository(s.db).GetByID(id)
+}
+
+func (s *invoiceService) UpdateInvoiceStatus(id int, status string) (*Invoice, error) {
+	repo := NewInvoiceRepository(s.db)
+	invoice, err := repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := false
+	for _, next := range invoiceTransitions[invoice.Status] {
+		if next == status {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return nil, ErrInvalidInvoiceTransition
+	}
+
+	if err := repo.UpdateStatus(id, status); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(id)
+}
+
+func (s *invoiceService) RenderInvoicePDF(id int, w io.Writer) error {
+	invoice, err := NewInvoiceRepository(s.db).GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	order, err := NewOrderRepository(s.db).GetByID(invoice.OrderID)
+	if err != nil {
+		return err
+	}
+
+	billTo := PersonalData{
+		Name:    invoice.BillToName,
+		Email:   invoice.BillToEmail,
+		Phone:   invoice.BillToPhone,
+		Company: invoice.BillToCompany,
+	}
+	// Invoices from before bill-to details were copied use the client record
+	// when it still exists, or what was captured on the order.
+	if billTo.Name == "" && billTo.Email == "" {
+		billTo = PersonalData{Name: order.ClientName, Email: order.Email, Phone: order.Phone, Company: order.Company}
+		if invoice.ClientID != "" {
+			if client, err := NewClientRepository(s.db).GetByID(invoice.ClientID); err == nil {
+				billTo = PersonalData{Name: client.Name, Email: client.Email, Phone: client.Phone, Company: client.Company}
+			}
+		}
+	}
+
+	_, err = renderInvoice(invoice, order, billTo).WriteTo(w)
+	return err
+}
+
+func renderInvoice(invoice *Invoice, order *Order, billTo PersonalData) *pdfDocument {
+	const (
+		left  = 50.0
+		right = pdfPageWidth - 50
+	)
+
+	doc := newPDFDocument()
+
+	// Brand header
+	doc.SetFillColor(24, 24, 32)
+	doc.Rect(0, 0, pdfPageWidth, 90)
+	doc.SetFillColor(255, 255, 255)
+	doc.Text(left, 55, 26, true, invoiceBrandName)
+	doc.TextRight(right, 52, 20, true, "INVOICE")
+	doc.TextRight(right, 70, 10, false, invoice.Number)
+
+	// Invoice meta
+	doc.SetFillColor(40, 40, 40)
+	y := 130.0
+	meta := [][2]string{
+		{"Issue date", invoice.IssueDate.Format("02 Jan 2006")},
+		{"Due date", invoice.DueDate.Format("02 Jan 2006")},
+		{"Status", strings.ToUpper(invoice.Status)},
+		{"Order", order.ID},
+	}
+	for _, m := range meta {
+		doc.Text(350, y, 10, true, m[0])
+		doc.TextRight(right, y, 10, false, m[1])
+		y += 16
+	}
+
+	// Bill to
+	y = 130
+	doc.Text(left, y, 10, true, "BILL TO")
+	for _, line := range []string{billTo.Name, billTo.Company, billTo.Email, billTo.Phone} {
+		if line == "" {
+			continue
+		}
+		y += 16
+		doc.Text(left, y, 10, false, line)
+	}
+	if order.ProjectTitle != "" {
+		y += 24
+		doc.Text(left, y, 10, true, "PROJECT")
+		y += 16
+		doc.Text(left, y, 10, false, order.ProjectTitle)
+	}
+
+	// Line items
+	y = math.Max(y, 194) + 40
+	tableHeader := func() {
+		doc.SetFillColor(236, 236, 242)
+		doc.Rect(left, y-14, right-left, 22)
+		doc.SetFillColor(40, 40, 40)
+		doc.Text(left+8, y+2, 10, true, "Description")
+		doc.TextRight(340, y+2, 10, true, "Qty")
+		doc.TextRight(440, y+2, 10, true, "Unit price")
+		doc.TextRight(right-8, y+2, 10, true, "Amount")
+		y += 28
+	}
+	tableHeader()
+
+	doc.SetStrokeColor(210, 210, 218)
+	for _, item := range invoice.Items {
+		lines := pdfWrapText(item.Description, 10, 250, false)
+		if y+float64(len(lines))*14 > pdfPageHeight-140 {
+			doc.AddPage()
+			y = 60
+			tableHeader()
+			doc.SetStrokeColor(210, 210, 218)
+		}
+		doc.TextRight(340, y, 10, false, strconv.FormatFloat(item.Quantity, 'f', -1, 64))
+		doc.TextRight(440, y, 10, false, formatMoney(item.UnitPrice, invoice.Currency))
+		doc.TextRight(right-8, y, 10, false, formatMoney(item.Amount, invoice.Currency))
+		for _, line := range lines {
+			doc.Text(left+8, y, 10, false, line)
+			y += 14
+		}
+		y += 4
+		doc.Line(left, y-8, right, y-8)
+	}
+
+	// Totals
+	y += 12
+	totals := [][2]string{
+		{"Subtotal", formatMoney(invoice.Subtotal, invoice.Currency)},
+		{fmt.Sprintf("Tax (%s%%)", strconv.FormatFloat(invoice.TaxRate, 'f', -1, 64)), formatMoney(invoice.TaxAmount, invoice.Currency)},
+	}
+	for _, t := range totals {
+		doc.Text(350, y, 10, false, t[0])
+		doc.TextRight(right-8, y, 10, false, t[1])
+		y += 16
+	}
+	doc.SetFillColor(24, 24, 32)
+	doc.Rect(340, y-6, right-340, 26)
+	doc.SetFillColor(255, 255, 255)
+	doc.Text(350, y+11, 12, true, "Total")
+	doc.TextRight(right-8, y+11, 12, true, formatMoney(invoice.Total, invoice.Currency))
+	y += 50
+
+	// Notes and footer
+	doc.SetFillColor(40, 40, 40)
+	if invoice.Notes != "" {
+		doc.Text(left, y, 10, true, "Notes")
+		for _, line := range pdfWrapText(invoice.Notes, 10, right-left, false) {
+			y += 14
+			doc.Text(left, y, 10, false, line)
+		}
+	}
+	doc.SetFillColor(120, 120, 130)
+	doc.Text(left, pdfPageHeight-40, 9, false, "Thank you for your business. Please include "+invoice.Number+" with your payment.")
+
+	return doc
+}
+
+// formatMoney renders an amount as e.g. "$1,250.00" (or "EUR 1,250.00" for
+// currencies without a symbol here).
+func formatMoney(amount float64, currency string) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	cents := int64(math.Round(amount * 100))
+	whole := strconv.FormatInt(cents/100, 10)
+	for i := len(whole) - 3; i > 0; i -= 3 {
+		whole = whole[:i] + "," + whole[i:]
+	}
+
+	prefix := currency + " "
+	if currency == "USD" {
+		prefix = "$"
+	}
+	return fmt.Sprintf("%s%s%s.%02d", sign, prefix, whole, cents%100)
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type InvoiceHandler struct {
+	service InvoiceService
+}
+
+func NewInvoiceHandler(service InvoiceService) *InvoiceHandler {
+	return &InvoiceHandler{service: service}
+}
+
+func (h *InvoiceHandler) CreateInvoice(c *gin.Context) {
+	var req InvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	invoice, err := h.service.CreateInvoice(req)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Order not found",
+		})
+		return
+	}
+	if err == ErrInvalidTaxRate {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err == ErrOrderNotPriced || err == ErrInvalidInvoiceItems {
+		c.JSON(http.StatusUnprocessableEntity, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, APIResponse{
+		Success: true,
+		Message: "Invoice created successfully",
+		Data:    invoice,
+	})
+}
+
+func (h *InvoiceHandler) GetInvoices(c *gin.Context) {
+	invoices, err := h.service.GetInvoices(c.Query("orderId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    invoices,
+	})
+}
+
+func (h *InvoiceHandler) GetInvoice(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	invoice, err := h.service.GetInvoice(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Invoice not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    invoice,
+	})
+}
+
+func (h *InvoiceHandler) UpdateInvoice(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req InvoiceStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	invoice, err := h.service.UpdateInvoiceStatus(id, req.Status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Invoice not found",
+		})
+		return
+	}
+	if err == ErrInvalidInvoiceTransition {
+		c.JSON(http.StatusConflict, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Invoice updated successfully",
+		Data:    invoice,
+	})
+}
+
+func (h *InvoiceHandler) GetInvoicePDF(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	invoice, err := h.service.GetInvoice(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Invoice not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	var pdf bytes.Buffer
+	if err := h.service.RenderInvoicePDF(id, &pdf); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", `inline; filename="`+invoice.Number+`.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", pdf.Bytes())
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInvoiceNumbers(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewInvoiceRepository(db)
+
+	// Each year has its own sequence
+	for _, want := range []struct {
+		year   int
+		number string
+	}{
+		{2001, "INV-2001-0001"},
+		{2001, "INV-2001-0002"},
+		{2002, "INV-2002-0001"},
+		{2001, "INV-2001-0003"},
+	} {
+		got, err := repo.NextNumber(want.year)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want.number {
+			t.Errorf("NextNumber(%d) = %s, want %s", want.year, got, want.number)
+		}
+	}
+
+	// A rejected invoice does not use up a number
+	service := NewInvoiceService(db)
+	unpriced := newTestOrder(t, db, 0)
+	if _, err := service.CreateInvoice(InvoiceRequest{OrderID: unpriced.ID}); err != ErrOrderNotPriced {
+		t.Fatalf("err = %v, want ErrOrderNotPriced", err)
+	}
+	order := newTestOrder(t, db, 1000)
+	badRate := 150.0
+	if _, err := service.CreateInvoice(InvoiceRequest{OrderID: order.ID, TaxRate: &badRate}); err != ErrInvalidTaxRate {
+		t.Fatalf("err = %v, want ErrInvalidTaxRate", err)
+	}
+	year := time.Now().Year()
+	for i := 1; i <= 2; i++ {
+		invoice, err := service.CreateInvoice(InvoiceRequest{OrderID: order.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("INV-%d-%04d", year, i); invoice.Number != want {
+			t.Errorf("invoice %d number = %s, want %s", i, invoice.Number, want)
+		}
+	}
+}
+
+func TestInvoiceKeepsBillTo(t *testing.T) {
+	db := newTestDB(t)
+	clients := NewClientRepository(db)
+	client := &Client{
+		ID:        generateClientID(),
+		Name:      "Ada Lovelace",
+		Email:     "client@example.com",
+		Company:   "Analytical Engines",
+		CreatedAt: time.Now(),
+	}
+	if err := clients.Create(client); err != nil {
+		t.Fatal(err)
+	}
+	order := newTestOrder(t, db, 1000)
+
+	service := NewInvoiceService(db)
+	invoice, err := service.CreateInvoice(InvoiceRequest{OrderID: order.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.Name = "Ada King"
+	client.Company = "Countess of Lovelace"
+	if err := clients.Update(client); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := service.GetInvoice(invoice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.BillToName != "Ada Lovelace" || got.BillToEmail != "client@example.com" || got.BillToCompany != "Analytical Engines" {
+		t.Errorf("bill-to = %q, %q, %q; want the details from when the invoice was made",
+			got.BillToName, got.BillToEmail, got.BillToCompany)
+	}
+
+	var pdf bytes.Buffer
+	if err := service.RenderInvoicePDF(invoice.ID, &pdf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(pdf.String(), "(Ada Lovelace)") || strings.Contains(pdf.String(), "Ada King") {
+		t.Error("PDF does not bill the name from when the invoice was made")
+	}
+
+	// Erasing the client wipes the copy along with everything else
+	if _, err := NewPrivacyService(db, t.TempDir()).EraseClient(client.ID); err != nil {
+		t.Fatal(err)
+	}
+	got, err = service.GetInvoice(invoice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.BillToName != "Erased Client" || got.BillToCompany != "" || strings.Contains(got.BillToEmail, "example.com") {
+		t.Errorf("bill-to after erasure = %q, %q, %q", got.BillToName, got.BillToEmail, got.BillToCompany)
+	}
+	if got.Number != invoice.Number || got.Total != invoice.Total {
+		t.Errorf("erasure changed the invoice: %s %v, want %s %v", got.Number, got.Total, invoice.Number, invoice.Total)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// ====================
+// MAILER
+// ====================
+
+type Mail struct {
+	To      string
+	Subject string
+	Body    string // plain text
+}
+
+type Mailer interface {
+	Send(mail Mail) error
+}
+
+// newMailer sends through the SMTP host when one is configured and
+// otherwise prints mail to stdout, which is enough for local development.
+func newMailer(cfg SMTPConfig) Mailer {
+	if cfg.Host == "" {
+		return NewLogMailer(os.Stdout)
+	}
+	return NewSMTPMailer(cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.From)
+}
+
+type smtpMailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+func NewSMTPMailer(host, port, username, password, from string) Mailer {
+	return &smtpMailer{addr: host + ":" + port, host: host, username: username, password: password, from: from}
+}
+
+func (m *smtpMailer) Send(mail Mail) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+	return smtp.SendMail(m.addr, auth, m.from, []string{mail.To}, formatMail(m.from, mail))
+}
+
+type logMailer struct {
+	w io.Writer
+}
+
+func NewLogMailer(w io.Writer) Mailer {
+	return &logMailer{w: w}
+}
+
+func (m *logMailer) Send(mail Mail) error {
+	_, err := fmt.Fprintf(m.w, "---- mail to %s ----\nSubject: %s\n\n%s\n----\n", mail.To, mail.Subject, mail.Body)
+	return err
+}
+
+func formatMail(from string, mail Mail) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", mail.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", mail.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(mail.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// studioEmail is where internal notifications go.
+func studioEmail() string {
+	return appConfig.StudioEmail
+}
+
+// publicLink builds a link into the client-facing site.
+func publicLink(path string) string {
+	return appConfig.PublicBaseURL + path
+}
@@ -1,10 +1,21 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,42 +27,61 @@ import (
 // ====================
 
 type Project struct {
-	ID              int    `json:"id" db:"id"`
-	ClientName      string `json:"clientName" db:"client_name"`
-	Email           string `json:"email" db:"email"`
-	Phone           string `json:"phone" db:"phone"`
-	ProjectType     string `json:"projectType" db:"project_type"`
-	Services        string `json:"services" db:"services"` // JSON string
-	ProjectTitle    string `json:"projectTitle" db:"project_title"`
-	Description     string `json:"description" db:"description"`
-	Budget          string `json:"budget" db:"budget"`
-	Deadline        string `json:"deadline" db:"deadline"`
-	ReferenceFiles  string `json:"referenceFiles" db:"reference_files"`
-	AdditionalNotes string `json:"additionalNotes" db:"additional_notes"`
+	ID              int        `json:"id" db:"id"`
+	ClientName      string     `json:"clientName" db:"client_name"`
+	Email           string     `json:"email" db:"email"`
+	Phone           string     `json:"phone" db:"phone"`
+	ProjectType     string     `json:"projectType" db:"project_type"`
+	Services        string     `json:"services" db:"services"` // JSON string
+	ProjectTitle    string     `json:"projectTitle" db:"project_title"`
+	Description     string     `json:"description" db:"description"`
+	Budget          string     `json:"budget" db:"budget"`
+	Deadline        string     `json:"deadline" db:"deadline"`
+	DeadlineAt      *time.Time `json:"deadlineAt" db:"deadline_at"` // parsed from Deadline
+	ReferenceFiles  string     `json:"referenceFiles" db:"reference_files"`
+	AdditionalNotes string     `json:"additionalNotes" db:"additional_notes"`
+	AssigneeID      string     `json:"assigneeId" db:"assignee_id"` // users.id, empty when unassigned
 }
 
 type Order struct {
-	ID                      string    `json:"id" db:"id"`
-	ClientName              string    `json:"clientName" db:"client_name"`
-	Email                   string    `json:"email" db:"email"`
-	Phone                   string    `json:"phone" db:"phone"`
-	Company                 string    `json:"company" db:"company"`
-	ProjectType             string    `json:"projectType" db:"project_type"`
-	Services                string    `json:"services" db:"services"` // JSON string
-	ProjectTitle            string    `json:"projectTitle" db:"project_title"`
-	Description             string    `json:"description" db:"description"`
-	Budget                  string    `json:"budget" db:"budget"`
-	Deadline                string    `json:"deadline" db:"deadline"`
-	Priority                string    `json:"priority" db:"priority"`
-	Status                  string    `json:"status" db:"status"`
-	CommunicationPreference string    `json:"communicationPreference" db:"communication_preference"`
-	RevisionRounds          string    `json:"revisionRounds" db:"revision_rounds"`
-	FileFormat              string    `json:"fileFormat" db:"file_format"` // JSON string
-	ColorPreferences        string    `json:"colorPreferences" db:"color_preferences"`
-	TargetAudience          string    `json:"targetAudience" db:"target_audience"`
-	AdditionalNotes         string    `json:"additionalNotes" db:"additional_notes"`
-	CreatedAt               time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt               time.Time `json:"updatedAt" db:"updated_at"`
+	ID                      string     `json:"id" db:"id"`
+	ClientName              string     `json:"clientName" db:"client_name"`
+	Email                   string     `json:"email" db:"email"`
+	Phone                   string     `json:"phone" db:"phone"`
+	Company                 string     `json:"company" db:"company"`
+	ProjectType             string     `json:"projectType" db:"project_type"`
+	Services                string     `json:"services" db:"services"` // JSON string
+	ProjectTitle            string     `json:"projectTitle" db:"project_title"`
+	Description             string     `json:"description" db:"description"`
+	Budget                  string     `json:"budget" db:"budget"`
+	Deadline                string     `json:"deadline" db:"deadline"`
+	DeadlineAt              *time.Time `json:"deadlineAt" db:"deadline_at"` // parsed from Deadline
+	DeadlineStatus          string     `json:"deadlineStatus" db:"deadline_status"`
+	Priority                string     `json:"priority" db:"priority"`
+	Status                  string     `json:"status" db:"status"`
+	CommunicationPreference string     `json:"communicationPreference" db:"communication_preference"`
+	RevisionRounds          string     `json:"revisionRounds" db:"revision_rounds"`
+	FileFormat              string     `json:"fileFormat" db:"file_format"` // JSON string
+	ColorPreferences        string     `json:"colorPreferences" db:"color_preferences"`
+	TargetAudience          string     `json:"targetAudience" db:"target_audience"`
+	AdditionalNotes         string     `json:"additionalNotes" db:"additional_notes"`
+	FinalPrice              float64    `json:"finalPrice" db:"final_price"`
+	DepositRequired         bool       `json:"depositRequired" db:"deposit_required"`
+	AmountPaid              float64    `json:"amountPaid" db:"amount_paid"` // derived from payments
+	EstimatedPrice          float64    `json:"estimatedPrice" db:"estimated_price"`
+	Estimate                string     `json:"estimate" db:"estimate"` // JSON string
+	EstimatedHours          float64    `json:"estimatedHours" db:"estimated_hours"`
+	CompletedAt             *time.Time `json:"completedAt" db:"completed_at"` // set while status is completed
+	AssigneeID              string     `json:"assigneeId" db:"assignee_id"`   // users.id, empty when unassigned
+	TrackingToken           string     `json:"trackingToken" db:"tracking_token"`
+	CreatedAt               time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt               time.Time  `json:"updatedAt" db:"updated_at"`
+}
+
+// OrderStatusChange is one entry in an order's status history.
+type OrderStatusChange struct {
+	Status    string    `json:"status" db:"status"`
+	ChangedAt time.Time `json:"changedAt" db:"changed_at"`
 }
 
 type Client struct {
@@ -82,6 +112,7 @@ type ProjectRequest struct {
 	Deadline        string   `json:"deadline"`
 	ReferenceFiles  string   `json:"referenceFiles"`
 	AdditionalNotes string   `json:"additionalNotes"`
+	AssigneeID      string   `json:"assigneeId"`
 }
 
 type OrderRequest struct {
@@ -103,10 +134,32 @@ type OrderRequest struct {
 	ColorPreferences        string   `json:"colorPreferences"`
 	TargetAudience          string   `json:"targetAudience"`
 	AdditionalNotes         string   `json:"additionalNotes"`
+
+	// Only read on the public order form
+	Website      string `json:"website"` // honeypot, hidden from people
+	CaptchaToken string `json:"captchaToken"`
+}
+
+// OrderFilter narrows the order list. Zero values are ignored.
+type OrderFilter struct {
+	Status      string
+	Priority    string
+	ProjectType string
+	Email       string
+	Assignee    string // a user ID, or "unassigned"
+	Search      string
+	From        time.Time
+	To          time.Time
 }
 
+// OrderUpdateRequest changes whichever of its fields are set.
 type OrderUpdateRequest struct {
-	Status string `json:"status"`
+	Status          string   `json:"status"`
+	FinalPrice      *float64 `json:"finalPrice"`
+	DepositRequired *bool    `json:"depositRequired"`
+	Deadline        *string  `json:"deadline"`
+	AssigneeID      *string  `json:"assigneeId"` // "" unassigns
+	EstimatedHours  *float64 `json:"estimatedHours"`
 }
 
 type PaginationResponse struct {
@@ -127,36 +180,63 @@ type APIResponse struct {
 // REPOSITORIES
 // ====================
 
+// DBTX is satisfied by both *sql.DB and *sql.Tx so repositories can run
+// inside a transaction when a service needs several writes to succeed together.
+type DBTX interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 type ProjectRepository interface {
 	Create(req ProjectRequest) (int64, error)
 	GetAll() ([]Project, error)
 	GetByID(id int) (*Project, error)
+	GetByEmail(email string) ([]Project, error)
 	Update(id int, req ProjectRequest) error
 	Delete(id int) error
+	AnonymizeByEmail(email string, pii PersonalData) error
 }
 
 type OrderRepository interface {
 	Create(order *Order) error
-	GetAll(page, limit int) ([]Order, int, error)
+	GetAll(filter OrderFilter, page, limit int) ([]Order, int, error)
+	Each(filter OrderFilter, fn func(Order) error) error
 	GetByID(id string) (*Order, error)
+	GetByEmail(email string) ([]Order, error)
+	GetByTrackingToken(token string) (*Order, error)
 	UpdateStatus(id, status string) error
+	GetStatusHistory(id string) ([]OrderStatusChange, error)
+	SetFinalPrice(id string, price float64) error
+	SetDepositRequired(id string, required bool) error
+	SetDeadline(id, deadline string, deadlineAt *time.Time, status string) error
+	SetAssignee(id, assigneeID string) error
+	SetEstimatedHours(id string, hours float64) error
+	SetDeadlineStatus(id, status string) error
+	GetOpenWithDeadline() ([]Order, error)
+	GetOpen() ([]Order, error)
 	Delete(id string) error
+	AnonymizeByEmail(email string, pii PersonalData) error
 }
 
 type ClientRepository interface {
 	GetAll() ([]Client, error)
+	Each(fn func(Client) error) error
+	GetByID(id string) (*Client, error)
 	GetByEmail(email string) (*Client, error)
 	Create(client *Client) error
 	Update(client *Client) error
 	IncrementOrderCount(email string) error
+	Anonymize(id string, pii PersonalData) error
+	RecalculateTotalSpent(email string) error
 }
 
 // Project Repository Implementation
 type projectRepository struct {
-	db *sql.DB
+	db DBTX
 }
 
-func NewProjectRepository(db *sql.DB) ProjectRepository {
+func NewProjectRepository(db DBTX) ProjectRepository {
 	return &projectRepository{db: db}
 }
 
@@ -165,12 +245,14 @@ func (r *projectRepository) Create(req ProjectRequest) (int64, error) {
 
 	query := `
 		INSERT INTO projects (client_name, email, phone, project_type, services, 
-		project_title, description, budget, deadline, reference_files, additional_notes)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		project_title, description, budget, deadline, deadline_at, reference_files, additional_notes,
+		assignee_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	result, err := r.db.Exec(query, req.ClientName, req.Email, req.Phone, req.ProjectType,
 		string(servicesJSON), req.ProjectTitle, req.Description, req.Budget,
-		req.Deadline, req.ReferenceFiles, req.AdditionalNotes)
+		req.Deadline, parseDeadline(req.Deadline), req.ReferenceFiles, req.AdditionalNotes,
+		req.AssigneeID)
 	if err != nil {
 		return 0, err
 	}
@@ -178,8 +260,29 @@ func (r *projectRepository) Create(req ProjectRequest) (int64, error) {
 	return result.LastInsertId()
 }
 
+// projectColumns lists the projects columns in the order scanProject expects
+// them. Columns are named because later migrations append to the table.
+const projectColumns = `id, client_name, email, phone, project_type, services, project_title,
+	description, budget, deadline, deadline_at, reference_files, additional_notes, assignee_id`
+
+func scanProject(row rowScanner) (*Project, error) {
+	var p Project
+	var deadlineAt sql.NullTime
+	err := row.Scan(&p.ID, &p.ClientName, &p.Email, &p.Phone, &p.ProjectType,
+		&p.Services, &p.ProjectTitle, &p.Description, &p.Budget,
+		&p.Deadline, &deadlineAt, &p.ReferenceFiles, &p.AdditionalNotes, &p.AssigneeID)
+	if err != nil {
+		return nil, err
+	}
+	if deadlineAt.Valid {
+		p.DeadlineAt = &deadlineAt.Time
+	}
+
+	return &p, nil
+}
+
 func (r *projectRepository) GetAll() ([]Project, error) {
-	rows, err := r.db.Query("SELECT * FROM projects")
+	rows, err := r.db.Query("SELECT " + projectColumns + " FROM projects")
 	if err != nil {
 		return nil, err
 	}
@@ -187,30 +290,37 @@ func (r *projectRepository) GetAll() ([]Project, error) {
 
 	var projects []Project
 	for rows.Next() {
-		var p Project
-		err := rows.Scan(&p.ID, &p.ClientName, &p.Email, &p.Phone, &p.ProjectType,
-			&p.Services, &p.ProjectTitle, &p.Description, &p.Budget,
-			&p.Deadline, &p.ReferenceFiles, &p.AdditionalNotes)
+		p, err := scanProject(rows)
 		if err != nil {
 			return nil, err
 		}
-		projects = append(projects, p)
+		projects = append(projects, *p)
 	}
 
 	return projects, nil
 }
 
 func (r *projectRepository) GetByID(id int) (*Project, error) {
-	var p Project
-	err := r.db.QueryRow("SELECT * FROM projects WHERE id = ?", id).Scan(
-		&p.ID, &p.ClientName, &p.Email, &p.Phone, &p.ProjectType,
-		&p.Services, &p.ProjectTitle, &p.Description, &p.Budget,
-		&p.Deadline, &p.ReferenceFiles, &p.AdditionalNotes)
+	return scanProject(r.db.QueryRow("SELECT "+projectColumns+" FROM projects WHERE id = ?", id))
+}
+
+func (r *projectRepository) GetByEmail(email string) ([]Project, error) {
+	rows, err := r.db.Query("SELECT "+projectColumns+" FROM projects WHERE email = ? ORDER BY id", email)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return &p, nil
+	var projects []Project
+	for rows.Next() {
+		p, err := scanProject(rows)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, *p)
+	}
+
+	return projects, rows.Err()
 }
 
 func (r *projectRepository) Update(id int, req ProjectRequest) error {
@@ -218,12 +328,14 @@ func (r *projectRepository) Update(id int, req ProjectRequest) error {
 
 	query := `
 		UPDATE projects SET client_name=?, email=?, phone=?, project_type=?, services=?,
-		project_title=?, description=?, budget=?, deadline=?, reference_files=?, additional_notes=?
+		project_title=?, description=?, budget=?, deadline=?, deadline_at=?, reference_files=?,
+		additional_notes=?, assignee_id=?
 		WHERE id=?`
 
 	result, err := r.db.Exec(query, req.ClientName, req.Email, req.Phone, req.ProjectType,
 		string(servicesJSON), req.ProjectTitle, req.Description, req.Budget,
-		req.Deadline, req.ReferenceFiles, req.AdditionalNotes, id)
+		req.Deadline, parseDeadline(req.Deadline), req.ReferenceFiles, req.AdditionalNotes,
+		req.AssigneeID, id)
 	if err != nil {
 		return err
 	}
@@ -237,6 +349,16 @@ func (r *projectRepository) Update(id int, req ProjectRequest) error {
 }
 
 func (r *projectRepository) Delete(id int) error {
+	if err := NewMilestoneRepository(r.db).DeleteByProject(id); err != nil {
+		return err
+	}
+	if err := NewTimeEntryRepository(r.db).DeleteByProject(id); err != nil {
+		return err
+	}
+	if err := NewGalleryRepository(r.db).ClearProject(id); err != nil {
+		return err
+	}
+
 	result, err := r.db.Exec("DELETE FROM projects WHERE id = ?", id)
 	if err != nil {
 		return err
@@ -250,12 +372,23 @@ func (r *projectRepository) Delete(id int) error {
 	return nil
 }
 
+func (r *projectRepository) AnonymizeByEmail(email string, pii PersonalData) error {
+	_, err := r.db.Exec(`
+		UPDATE projects
+		SET client_name = ?, email = ?, phone = ?, project_title = ?, description = '', reference_files = '',
+		additional_notes = ''
+		WHERE email = ?
+	`, pii.Name, pii.Email, pii.Phone, erasedProjectTitle, email)
+
+	return err
+}
+
 // Order Repository Implementation
 type orderRepository struct {
-	db *sql.DB
+	db DBTX
 }
 
-func NewOrderRepository(db *sql.DB) OrderRepository {
+func NewOrderRepository(db DBTX) OrderRepository {
 	return &orderRepository{db: db}
 }
 
@@ -264,30 +397,73 @@ func (r *orderRepository) Create(order *Order) error {
 		INSERT INTO orders (id, client_name, email, phone, company, project_type, services, 
 		project_title, description, budget, deadline, priority, status, communication_preference,
 		revision_rounds, file_format, color_preferences, target_audience, additional_notes,
-		created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		final_price, deposit_required, estimated_price, estimate, deadline_at, deadline_status,
+		estimated_hours, assignee_id, completed_at, tracking_token, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	_, err := r.db.Exec(query, order.ID, order.ClientName, order.Email, order.Phone,
 		order.Company, order.ProjectType, order.Services, order.ProjectTitle,
 		order.Description, order.Budget, order.Deadline, order.Priority, order.Status,
 		order.CommunicationPreference, order.RevisionRounds, order.FileFormat,
 		order.ColorPreferences, order.TargetAudience, order.AdditionalNotes,
-		order.CreatedAt, order.UpdatedAt)
+		order.FinalPrice, order.DepositRequired, order.EstimatedPrice, order.Estimate,
+		order.DeadlineAt, order.DeadlineStatus, order.EstimatedHours, order.AssigneeID,
+		order.CompletedAt, order.TrackingToken, order.CreatedAt, order.UpdatedAt)
+	if err != nil {
+		return err
+	}
 
-	return err
+	return r.recordStatus(order.ID, order.Status, order.CreatedAt)
+}
+
+// orderColumns lists the orders columns in the order scanOrder expects them.
+const orderColumns = `id, client_name, email, phone, company, project_type, services,
+	project_title, description, budget, deadline, priority, status, communication_preference,
+	revision_rounds, file_format, color_preferences, target_audience, additional_notes,
+	final_price, deposit_required, ` + netPaidSQL + ` AS amount_paid, estimated_price, estimate,
+	deadline_at, deadline_status, estimated_hours, assignee_id, completed_at, tracking_token, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanOrder(row rowScanner) (*Order, error) {
+	var o Order
+	var deadlineAt, completedAt sql.NullTime
+	err := row.Scan(&o.ID, &o.ClientName, &o.Email, &o.Phone, &o.Company, &o.ProjectType,
+		&o.Services, &o.ProjectTitle, &o.Description, &o.Budget, &o.Deadline, &o.Priority,
+		&o.Status, &o.CommunicationPreference, &o.RevisionRounds, &o.FileFormat,
+		&o.ColorPreferences, &o.TargetAudience, &o.AdditionalNotes, &o.FinalPrice,
+		&o.DepositRequired, &o.AmountPaid, &o.EstimatedPrice, &o.Estimate, &deadlineAt,
+		&o.DeadlineStatus, &o.EstimatedHours, &o.AssigneeID, &completedAt, &o.TrackingToken,
+		&o.CreatedAt, &o.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if deadlineAt.Valid {
+		o.DeadlineAt = &deadlineAt.Time
+	}
+	if completedAt.Valid {
+		o.CompletedAt = &completedAt.Time
+	}
+
+	return &o, nil
 }
 
-func (r *orderRepository) GetAll(page, limit int) ([]Order, int, error) {
+func (r *orderRepository) GetAll(filter OrderFilter, page, limit int) ([]Order, int, error) {
+	where, args := filter.where()
+
 	// Get total count
 	var total int
-	err := r.db.QueryRow("SELECT COUNT(*) FROM orders").Scan(&total)
+	err := r.db.QueryRow("SELECT COUNT(*) FROM orders"+where, args...).Scan(&total)
 	if err != nil {
 		return nil, 0, err
 	}
 
 	// Get orders with pagination
 	offset := (page - 1) * limit
-	rows, err := r.db.Query("SELECT * FROM orders ORDER BY created_at DESC LIMIT ? OFFSET ?", limit, offset)
+	rows, err := r.db.Query("SELECT "+orderColumns+" FROM orders"+where+" ORDER BY created_at DESC LIMIT ? OFFSET ?",
+		append(args, limit, offset)...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -295,51 +471,77 @@ func (r *orderRepository) GetAll(page, limit int) ([]Order, int, error) {
 
 	var orders []Order
 	for rows.Next() {
-		var o Order
-		err := rows.Scan(&o.ID, &o.ClientName, &o.Email, &o.Phone, &o.Company, &o.ProjectType,
-			&o.Services, &o.ProjectTitle, &o.Description, &o.Budget, &o.Deadline, &o.Priority,
-			&o.Status, &o.CommunicationPreference, &o.RevisionRounds, &o.FileFormat,
-			&o.ColorPreferences, &o.TargetAudience, &o.AdditionalNotes, &o.CreatedAt, &o.UpdatedAt)
+		o, err := scanOrder(rows)
 		if err != nil {
 			return nil, 0, err
 		}
-		orders = append(orders, o)
+		orders = append(orders, *o)
 	}
 
-	return orders, total, nil
+	return orders, total, rows.Err()
 }
 
-func (r *orderRepository) GetByID(id string) (*Order, error) {
-	var o Order
-	err := r.db.QueryRow("SELECT * FROM orders WHERE id = ?", id).Scan(
-		&o.ID, &o.ClientName, &o.Email, &o.Phone, &o.Company, &o.ProjectType,
-		&o.Services, &o.ProjectTitle, &o.Description, &o.Budget, &o.Deadline, &o.Priority,
-		&o.Status, &o.CommunicationPreference, &o.RevisionRounds, &o.FileFormat,
-		&o.ColorPreferences, &o.TargetAudience, &o.AdditionalNotes, &o.CreatedAt, &o.UpdatedAt)
+// Each streams every order matching filter to fn without buffering the
+// result set, stopping at the first error fn returns.
+func (r *orderRepository) Each(filter OrderFilter, fn func(Order) error) error {
+	where, args := filter.where()
+
+	rows, err := r.db.Query("SELECT "+orderColumns+" FROM orders"+where+" ORDER BY created_at DESC", args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer rows.Close()
 
-	return &o, nil
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(*o); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
 }
 
-func (r *orderRepository) UpdateStatus(id, status string) error {
-	result, err := r.db.Exec("UPDATE orders SET status = ?, updated_at = ? WHERE id = ?",
-		status, time.Now(), id)
+func (r *orderRepository) GetByID(id string) (*Order, error) {
+	return scanOrder(r.db.QueryRow("SELECT "+orderColumns+" FROM orders WHERE id = ?", id))
+}
+
+func (r *orderRepository) GetByTrackingToken(token string) (*Order, error) {
+	return scanOrder(r.db.QueryRow("SELECT "+orderColumns+" FROM orders WHERE tracking_token = ?", token))
+}
+
+func (r *orderRepository) GetByEmail(email string) ([]Order, error) {
+	rows, err := r.db.Query("SELECT "+orderColumns+" FROM orders WHERE email = ? ORDER BY created_at DESC", email)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	var orders []Order
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, *o)
 	}
 
-	return nil
+	return orders, rows.Err()
 }
 
-func (r *orderRepository) Delete(id string) error {
-	result, err := r.db.Exec("DELETE FROM orders WHERE id = ?", id)
+// UpdateStatus also records the change in the order's status history and
+// stamps completed_at when an order is completed and
+// clears it if the order is reopened.
+func (r *orderRepository) UpdateStatus(id, status string) error {
+	now := time.Now()
+	result, err := r.db.Exec(`
+		UPDATE orders SET status = ?, updated_at = ?,
+		completed_at = CASE WHEN ? = 'completed' THEN COALESCE(completed_at, ?) ELSE NULL END
+		WHERE id = ?
+	`, status, now, status, now, id)
 	if err != nil {
 		return err
 	}
@@ -349,300 +551,533 @@ func (r *orderRepository) Delete(id string) error {
 		return sql.ErrNoRows
 	}
 
-	return nil
-}
-
-// Client Repository Implementation
-type clientRepository struct {
-	db *sql.DB
+	return r.recordStatus(id, status, now)
 }
 
-func NewClientRepository(db *sql.DB) ClientRepository {
-	return &clientRepository{db: db}
+func (r *orderRepository) recordStatus(id, status string, at time.Time) error {
+	_, err := r.db.Exec("INSERT INTO order_status_history (order_id, status, changed_at) VALUES (?, ?, ?)",
+		id, status, at)
+	return err
 }
 
-func (r *clientRepository) GetAll() ([]Client, error) {
+// GetStatusHistory lists the statuses an order has been through, oldest
+// first. Orders created before the history existed start at their first
+// change.
+func (r *orderRepository) GetStatusHistory(id string) ([]OrderStatusChange, error) {
 	rows, err := r.db.Query(`
-		SELECT id, name, email, phone, company, total_orders, total_spent, 
-		       last_order_date, created_at
-		FROM clients ORDER BY created_at DESC
-	`)
+		SELECT status, changed_at FROM order_status_history WHERE order_id = ? ORDER BY id
+	`, id)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var clients []Client
+	history := []OrderStatusChange{}
 	for rows.Next() {
-		var client Client
-		var lastOrderDate sql.NullTime
-
-		err := rows.Scan(&client.ID, &client.Name, &client.Email, &client.Phone,
-			&client.Company, &client.TotalOrders, &client.TotalSpent,
-			&lastOrderDate, &client.CreatedAt)
-		if err != nil {
+		var change OrderStatusChange
+		if err := rows.Scan(&change.Status, &change.ChangedAt); err != nil {
 			return nil, err
 		}
-
-		if lastOrderDate.Valid {
-			client.LastOrderDate = lastOrderDate.Time
-		}
-
-		clients = append(clients, client)
+		history = append(history, change)
 	}
 
-	return clients, nil
+	return history, rows.Err()
 }
 
-func (r *clientRepository) GetByEmail(email string) (*Client, error) {
-	var client Client
-	var lastOrderDate sql.NullTime
-
-	err := r.db.QueryRow(`
-		SELECT id, name, email, phone, company, total_orders, total_spent, 
-		       last_order_date, created_at
-		FROM clients WHERE email = ?
-	`, email).Scan(&client.ID, &client.Name, &client.Email, &client.Phone,
-		&client.Company, &client.TotalOrders, &client.TotalSpent,
-		&lastOrderDate, &client.CreatedAt)
+func (r *orderRepository) SetFinalPrice(id string, price float64) error {
+	result, err := r.db.Exec("UPDATE orders SET final_price = ?, updated_at = ? WHERE id = ?",
+		price, time.Now(), id)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if lastOrderDate.Valid {
-		client.LastOrderDate = lastOrderDate.Time
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
 	}
 
-	return &client, nil
+	return nil
 }
 
-func (r *clientRepository) Create(client *Client) error {
-	_, err := r.db.Exec(`
-		INSERT INTO clients (id, name, email, phone, company, total_orders, total_spent, last_order_date, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, client.ID, client.Name, client.Email, client.Phone, client.Company,
-		client.TotalOrders, client.TotalSpent, client.LastOrderDate, client.CreatedAt)
-
-	return err
-}
+func (r *orderRepository) SetDepositRequired(id string, required bool) error {
+	result, err := r.db.Exec("UPDATE orders SET deposit_required = ?, updated_at = ? WHERE id = ?",
+		required, time.Now(), id)
+	if err != nil {
+		return err
+	}
 
-func (r *clientRepository) Update(client *Client) error {
-	_, err := r.db.Exec(`
-		UPDATE clients 
-		SET name = ?, phone = ?, company = ?, total_orders = ?, last_order_date = ?
-		WHERE email = ?
-	`, client.Name, client.Phone, client.Company, client.TotalOrders, client.LastOrderDate, client.Email)
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
 
-	return err
+	return nil
 }
 
-func (r *clientRepository) IncrementOrderCount(email string) error {
-	_, err := r.db.Exec(`
-		UPDATE clients 
-		SET total_orders = total_orders + 1, last_order_date = ?
-		WHERE email = ?
-	`, time.Now(), email)
+func (r *orderRepository) SetDeadline(id, deadline string, deadlineAt *time.Time, status string) error {
+	result, err := r.db.Exec(`
+		UPDATE orders SET deadline = ?, deadline_at = ?, deadline_status = ?, updated_at = ?
+		WHERE id = ?
+	`, deadline, deadlineAt, status, time.Now(), id)
+	if err != nil {
+		return err
+	}
 
-	return err
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
 }
 
-// ====================
-// SERVICES
-// ====================
+// SetAssignee sets the assigned user; an empty ID unassigns the order.
+func (r *orderRepository) SetAssignee(id, assigneeID string) error {
+	result, err := r.db.Exec("UPDATE orders SET assignee_id = ?, updated_at = ? WHERE id = ?",
+		assigneeID, time.Now(), id)
+	if err != nil {
+		return err
+	}
 
-type ProjectService interface {
-	CreateProject(req ProjectRequest) (int64, error)
-	GetAllProjects() ([]map[string]interface{}, error)
-	GetProjectByID(id int) (map[string]interface{}, error)
-	UpdateProject(id int, req ProjectRequest) error
-	DeleteProject(id int) error
-}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
 
-type OrderService interface {
-	CreateOrder(req OrderRequest) (string, error)
-	GetAllOrders(page, limit int) ([]map[string]interface{}, PaginationResponse, error)
-	UpdateOrderStatus(id, status string) (map[string]interface{}, error)
-	DeleteOrder(id string) error
+	return nil
 }
 
-type ClientService interface {
-	GetAllClients() ([]Client, error)
-}
+func (r *orderRepository) SetEstimatedHours(id string, hours float64) error {
+	result, err := r.db.Exec("UPDATE orders SET estimated_hours = ?, updated_at = ? WHERE id = ?",
+		hours, time.Now(), id)
+	if err != nil {
+		return err
+	}
 
-// Project Service Implementation
-type projectService struct {
-	repo ProjectRepository
-}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
 
-func NewProjectService(repo ProjectRepository) ProjectService {
-	return &projectService{repo: repo}
+	return nil
 }
 
-func (s *projectService) CreateProject(req ProjectRequest) (int64, error) {
-	return s.repo.Create(req)
+// SetDeadlineStatus leaves updated_at alone; the status is derived, not an
+// edit to the order.
+func (r *orderRepository) SetDeadlineStatus(id, status string) error {
+	_, err := r.db.Exec("UPDATE orders SET deadline_status = ? WHERE id = ?", status, id)
+	return err
 }
 
-func (s *projectService) GetAllProjects() ([]map[string]interface{}, error) {
-	projects, err := s.repo.GetAll()
+// GetOpenWithDeadline returns orders still being worked on that have a
+// parsed deadline, soonest first.
+func (r *orderRepository) GetOpenWithDeadline() ([]Order, error) {
+	rows, err := r.db.Query("SELECT " + orderColumns + ` FROM orders
+		WHERE deadline_at IS NOT NULL AND status IN ('pending', 'in-progress', 'on-hold')
+		ORDER BY deadline_at`)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	var result []map[string]interface{}
-	for _, p := range projects {
-		var services []string
-		json.Unmarshal([]byte(p.Services), &services)
-
-		project := map[string]interface{}{
-			"id":              p.ID,
-			"clientName":      p.ClientName,
-			"email":           p.Email,
-			"phone":           p.Phone,
-			"projectType":     p.ProjectType,
-			"services":        services,
-			"projectTitle":    p.ProjectTitle,
-			"description":     p.Description,
-			"budget":          p.Budget,
-			"deadline":        p.Deadline,
-			"referenceFiles":  p.ReferenceFiles,
-			"additionalNotes": p.AdditionalNotes,
+	var orders []Order
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
 		}
-		result = append(result, project)
+		orders = append(orders, *o)
 	}
 
-	return result, nil
+	return orders, rows.Err()
 }
 
-func (s *projectService) GetProjectByID(id int) (map[string]interface{}, error) {
-	p, err := s.repo.GetByID(id)
+// GetOpen returns every order still being worked on, with or without a
+// deadline.
+func (r *orderRepository) GetOpen() ([]Order, error) {
+	rows, err := r.db.Query("SELECT " + orderColumns + ` FROM orders
+		WHERE status IN ('pending', 'in-progress', 'on-hold')
+		ORDER BY created_at`)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	var services []string
-	json.Unmarshal([]byte(p.Services), &services)
-
-	project := map[string]interface{}{
-		"id":              p.ID,
-		"clientName":      p.ClientName,
-		"email":           p.Email,
-		"phone":           p.Phone,
-		"projectType":     p.ProjectType,
-		"services":        services,
-		"projectTitle":    p.ProjectTitle,
-		"description":     p.Description,
-		"budget":          p.Budget,
-		"deadline":        p.Deadline,
-		"referenceFiles":  p.ReferenceFiles,
-		"additionalNotes": p.AdditionalNotes,
+	var orders []Order
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, *o)
 	}
 
-	return project, nil
+	return orders, rows.Err()
 }
 
-func (s *projectService) UpdateProject(id int, req ProjectRequest) error {
-	return s.repo.Update(id, req)
-}
-
-func (s *projectService) DeleteProject(id int) error {
-	return s.repo.Delete(id)
-}
-
-// Order Service Implementation
-type orderService struct {
-	orderRepo  OrderRepository
-	clientRepo ClientRepository
-}
-
-func NewOrderService(orderRepo OrderRepository, clientRepo ClientRepository) OrderService {
-	return &orderService{
-		orderRepo:  orderRepo,
-		clientRepo: clientRepo,
+func (r *orderRepository) Delete(id string) error {
+	if err := NewTimeEntryRepository(r.db).DeleteByOrder(id); err != nil {
+		return err
+	}
+	if err := deleteUploads(r.db, uploadDir(), "order", id); err != nil {
+		return err
+	}
+	if err := deleteOrderDeliverables(r.db, uploadDir(), id); err != nil {
+		return err
+	}
+	if err := NewMessageRepository(r.db).DeleteByOrder(id); err != nil {
+		return err
+	}
+	if _, err := r.db.Exec("DELETE FROM order_status_history WHERE order_id = ?", id); err != nil {
+		return err
+	}
+	if err := NewQuarantineRepository(r.db).Delete(id); err != nil {
+		return err
+	}
+	if _, err := r.db.Exec("DELETE FROM order_sync_ids WHERE order_id = ?", id); err != nil {
+		return err
 	}
+
+	result, err := r.db.Exec("DELETE FROM orders WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
 }
 
-func (s *orderService) CreateOrder(req OrderRequest) (string, error) {
-	orderID := generateOrderID()
-	servicesJSON, _ := json.Marshal(req.Services)
-	fileFormatJSON, _ := json.Marshal(req.FileFormat)
-	now := time.Now()
+func (r *orderRepository) AnonymizeByEmail(email string, pii PersonalData) error {
+	_, err := r.db.Exec(`
+		UPDATE order_quarantine SET ip = ''
+		WHERE order_id IN (SELECT id FROM orders WHERE email = ?)
+	`, email)
+	if err != nil {
+		return err
+	}
+	if _, err := r.db.Exec("DELETE FROM order_sync_ids WHERE email = ?", email); err != nil {
+		return err
+	}
+	// A declined quote's reason is the client's own words
+	_, err = r.db.Exec(`
+		UPDATE quotes SET decline_reason = ''
+		WHERE order_id IN (SELECT id FROM orders WHERE email = ?)
+	`, email)
+	if err != nil {
+		return err
+	}
+	// Invoices keep their numbers and amounts but not who they were made out to
+	_, err = r.db.Exec(`
+		UPDATE invoices SET bill_to_name = ?, bill_to_email = ?, bill_to_phone = ?, bill_to_company = ?
+		WHERE order_id IN (SELECT id FROM orders WHERE email = ?)
+	`, pii.Name, pii.Email, pii.Phone, pii.Company, email)
+	if err != nil {
+		return err
+	}
 
-	if req.Status == "" {
-		req.Status = "pending"
+	// The free-text fields can hold anything the client wrote about
+	// themselves, so they go along with the contact details
+	_, err = r.db.Exec(`
+		UPDATE orders
+		SET client_name = ?, email = ?, phone = ?, company = ?, project_title = ?, description = '',
+		color_preferences = '', target_audience = '', additional_notes = '', tracking_token = '',
+		updated_at = ?
+		WHERE email = ?
+	`, pii.Name, pii.Email, pii.Phone, pii.Company, erasedOrderTitle, time.Now(), email)
+
+	return err
+}
+
+// Client Repository Implementation
+type clientRepository struct {
+	db DBTX
+}
+
+func NewClientRepository(db DBTX) ClientRepository {
+	return &clientRepository{db: db}
+}
+
+const clientColumns = `id, name, email, phone, company, total_orders, total_spent,
+	last_order_date, created_at`
+
+func scanClient(row rowScanner) (*Client, error) {
+	var client Client
+	var lastOrderDate sql.NullTime
+
+	err := row.Scan(&client.ID, &client.Name, &client.Email, &client.Phone,
+		&client.Company, &client.TotalOrders, &client.TotalSpent,
+		&lastOrderDate, &client.CreatedAt)
+	if err != nil {
+		return nil, err
 	}
 
-	order := &Order{
-		ID:                      orderID,
-		ClientName:              req.ClientName,
-		Email:                   req.Email,
-		Phone:                   req.Phone,
-		Company:                 req.Company,
-		ProjectType:             req.ProjectType,
-		Services:                string(servicesJSON),
-		ProjectTitle:            req.ProjectTitle,
-		Description:             req.Description,
-		Budget:                  req.Budget,
-		Deadline:                req.Deadline,
-		Priority:                req.Priority,
-		Status:                  req.Status,
-		CommunicationPreference: req.CommunicationPreference,
-		RevisionRounds:          req.RevisionRounds,
-		FileFormat:              string(fileFormatJSON),
-		ColorPreferences:        req.ColorPreferences,
-		TargetAudience:          req.TargetAudience,
-		AdditionalNotes:         req.AdditionalNotes,
-		CreatedAt:               now,
-		UpdatedAt:               now,
+	if lastOrderDate.Valid {
+		client.LastOrderDate = lastOrderDate.Time
+	}
+
+	return &client, nil
+}
+
+func (r *clientRepository) GetAll() ([]Client, error) {
+	var clients []Client
+	err := r.Each(func(client Client) error {
+		clients = append(clients, client)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	err := s.orderRepo.Create(order)
+	return clients, nil
+}
+
+// Each streams every client, newest first, to fn.
+func (r *clientRepository) Each(fn func(Client) error) error {
+	rows, err := r.db.Query("SELECT " + clientColumns + " FROM clients ORDER BY created_at DESC")
 	if err != nil {
-		return "", err
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		client, err := scanClient(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(*client); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (r *clientRepository) GetByID(id string) (*Client, error) {
+	return scanClient(r.db.QueryRow("SELECT "+clientColumns+" FROM clients WHERE id = ?", id))
+}
+
+func (r *clientRepository) GetByEmail(email string) (*Client, error) {
+	return scanClient(r.db.QueryRow("SELECT "+clientColumns+" FROM clients WHERE email = ?", email))
+}
+
+func (r *clientRepository) Create(client *Client) error {
+	_, err := r.db.Exec(`
+		INSERT INTO clients (id, name, email, phone, company, total_orders, total_spent, last_order_date, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, client.ID, client.Name, client.Email, client.Phone, client.Company,
+		client.TotalOrders, client.TotalSpent, client.LastOrderDate, client.CreatedAt)
+
+	return err
+}
+
+func (r *clientRepository) Update(client *Client) error {
+	_, err := r.db.Exec(`
+		UPDATE clients 
+		SET name = ?, phone = ?, company = ?, total_orders = ?, last_order_date = ?
+		WHERE email = ?
+	`, client.Name, client.Phone, client.Company, client.TotalOrders, client.LastOrderDate, client.Email)
+
+	return err
+}
+
+func (r *clientRepository) IncrementOrderCount(email string) error {
+	_, err := r.db.Exec(`
+		UPDATE clients 
+		SET total_orders = total_orders + 1, last_order_date = ?
+		WHERE email = ?
+	`, time.Now(), email)
+
+	return err
+}
+
+// RecalculateTotalSpent sets total_spent to the net of all payments recorded
+// against the client's orders.
+func (r *clientRepository) RecalculateTotalSpent(email string) error {
+	_, err := r.db.Exec(`
+		UPDATE clients
+		SET total_spent = (
+			SELECT COALESCE(SUM(CASE WHEN p.kind = 'refund' THEN -p.amount ELSE p.amount END), 0)
+			FROM payments p JOIN orders o ON o.id = p.order_id
+			WHERE o.email = clients.email
+		)
+		WHERE email = ?
+	`, email)
+
+	return err
+}
+
+// Anonymize overwrites the contact details of a client while leaving
+// total_orders, total_spent and the order dates untouched.
+func (r *clientRepository) Anonymize(id string, pii PersonalData) error {
+	result, err := r.db.Exec(`
+		UPDATE clients 
+		SET name = ?, email = ?, phone = ?, company = ?
+		WHERE id = ?
+	`, pii.Name, pii.Email, pii.Phone, pii.Company, id)
+	if err != nil {
+		return err
 	}
 
-	// Update client record
-	s.updateClientRecord(req.Email, req.ClientName, req.Phone, req.Company)
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type ProjectService interface {
+	CreateProject(req ProjectRequest) (int64, error)
+	GetAllProjects() ([]map[string]interface{}, error)
+	GetProjectByID(id int) (map[string]interface{}, error)
+	UpdateProject(id int, req ProjectRequest) error
+	DeleteProject(id int) error
+}
 
-	return orderID, nil
+type OrderService interface {
+	CreateOrder(req OrderRequest) (*Order, error)
+	GetAllOrders(filter OrderFilter, page, limit int) ([]map[string]interface{}, PaginationResponse, error)
+	UpdateOrder(id string, req OrderUpdateRequest) (map[string]interface{}, error)
+	DeleteOrder(id string) error
+	EstimateOrder(req OrderRequest) *PriceEstimate
 }
 
-func (s *orderService) GetAllOrders(page, limit int) ([]map[string]interface{}, PaginationResponse, error) {
-	orders, total, err := s.orderRepo.GetAll(page, limit)
+type ClientService interface {
+	GetAllClients() ([]Client, error)
+}
+
+// Project Service Implementation
+type projectService struct {
+	repo     ProjectRepository
+	userRepo UserRepository
+}
+
+func NewProjectService(repo ProjectRepository, userRepo UserRepository) ProjectService {
+	return &projectService{repo: repo, userRepo: userRepo}
+}
+
+func (s *projectService) CreateProject(req ProjectRequest) (int64, error) {
+	if err := checkAssignee(s.userRepo, req.AssigneeID); err != nil {
+		return 0, err
+	}
+	return s.repo.Create(req)
+}
+
+func (s *projectService) GetAllProjects() ([]map[string]interface{}, error) {
+	projects, err := s.repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []map[string]interface{}
+	for _, p := range projects {
+		result = append(result, projectToMap(p))
+	}
+
+	return result, nil
+}
+
+func (s *projectService) GetProjectByID(id int) (map[string]interface{}, error) {
+	p, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return projectToMap(*p), nil
+}
+
+func (s *projectService) UpdateProject(id int, req ProjectRequest) error {
+	if err := checkAssignee(s.userRepo, req.AssigneeID); err != nil {
+		return err
+	}
+	return s.repo.Update(id, req)
+}
+
+func (s *projectService) DeleteProject(id int) error {
+	return s.repo.Delete(id)
+}
+
+// Order Service Implementation
+type orderService struct {
+	db         *sql.DB
+	orderRepo  OrderRepository
+	clientRepo ClientRepository
+	userRepo   UserRepository
+	pricing    *PricingEngine
+}
+
+func NewOrderService(db *sql.DB, orderRepo OrderRepository, clientRepo ClientRepository, userRepo UserRepository,
+	pricing *PricingEngine) OrderService {
+	return &orderService{
+		db:         db,
+		orderRepo:  orderRepo,
+		clientRepo: clientRepo,
+		userRepo:   userRepo,
+		pricing:    pricing,
+	}
+}
+
+func (s *orderService) CreateOrder(req OrderRequest) (*Order, error) {
+	order, err := newOrderFromRequest(req, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the estimate the client saw when the order came in
+	estimate := s.EstimateOrder(req)
+	estimateJSON, _ := json.Marshal(estimate)
+	order.EstimatedPrice = estimate.Total
+	order.Estimate = string(estimateJSON)
+	order.EstimatedHours = estimate.Hours
+
+	// The order and its client record are saved together, as in imports
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	txService := &orderService{orderRepo: NewOrderRepository(tx), clientRepo: NewClientRepository(tx)}
+	if err := txService.orderRepo.Create(order); err != nil {
+		return nil, err
+	}
+
+	// Update client record; quarantined orders only count once approved
+	if order.Status != orderQuarantined {
+		err := txService.updateClientRecord(req.Email, req.ClientName, req.Phone, req.Company, order.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func (s *orderService) EstimateOrder(req OrderRequest) *PriceEstimate {
+	return s.pricing.Estimate(req, time.Now())
+}
+
+func (s *orderService) GetAllOrders(filter OrderFilter, page, limit int) ([]map[string]interface{}, PaginationResponse, error) {
+	orders, total, err := s.orderRepo.GetAll(filter, page, limit)
 	if err != nil {
 		return nil, PaginationResponse{}, err
 	}
 
 	var result []map[string]interface{}
 	for _, o := range orders {
-		var services []string
-		var fileFormat []string
-		json.Unmarshal([]byte(o.Services), &services)
-		json.Unmarshal([]byte(o.FileFormat), &fileFormat)
-
-		order := map[string]interface{}{
-			"id":                      o.ID,
-			"clientName":              o.ClientName,
-			"email":                   o.Email,
-			"phone":                   o.Phone,
-			"company":                 o.Company,
-			"projectType":             o.ProjectType,
-			"services":                services,
-			"projectTitle":            o.ProjectTitle,
-			"description":             o.Description,
-			"budget":                  o.Budget,
-			"deadline":                o.Deadline,
-			"priority":                o.Priority,
-			"status":                  o.Status,
-			"communicationPreference": o.CommunicationPreference,
-			"revisionRounds":          o.RevisionRounds,
-			"fileFormat":              fileFormat,
-			"colorPreferences":        o.ColorPreferences,
-			"targetAudience":          o.TargetAudience,
-			"additionalNotes":         o.AdditionalNotes,
-			"createdAt":               o.CreatedAt.Format(time.RFC3339),
-			"updatedAt":               o.UpdatedAt.Format(time.RFC3339),
-		}
-		result = append(result, order)
+		result = append(result, orderToMap(o))
 	}
 
 	totalPages := (total + limit - 1) / limit
@@ -656,55 +1091,121 @@ func (s *orderService) GetAllOrders(page, limit int) ([]map[string]interface{},
 	return result, pagination, nil
 }
 
-func (s *orderService) UpdateOrderStatus(id, status string) (map[string]interface{}, error) {
-	err := s.orderRepo.UpdateStatus(id, status)
+func (s *orderService) UpdateOrder(id string, req OrderUpdateRequest) (map[string]interface{}, error) {
+	if req.Status == "" && req.FinalPrice == nil && req.DepositRequired == nil && req.Deadline == nil &&
+		req.AssigneeID == nil && req.EstimatedHours == nil {
+		return nil, ErrNothingToUpdate
+	}
+	if req.Status != "" && !orderStatuses[req.Status] {
+		return nil, ErrUnknownStatus
+	}
+	if req.FinalPrice != nil && *req.FinalPrice < 0 {
+		return nil, ErrNegativePrice
+	}
+	if req.Deadline != nil && *req.Deadline != "" && parseDeadline(*req.Deadline) == nil {
+		return nil, ErrInvalidDeadline
+	}
+	if req.EstimatedHours != nil && *req.EstimatedHours < 0 {
+		return nil, ErrNegativeHours
+	}
+	if req.AssigneeID != nil {
+		if err := checkAssignee(s.userRepo, *req.AssigneeID); err != nil {
+			return nil, err
+		}
+	}
+
+	// The fields are written one by one, so together they go in one
+	// transaction
+	tx, err := s.db.Begin()
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
+	repo := NewOrderRepository(tx)
+
+	// Check the deposit rule against the order as it will be after this
+	// update, before anything is written.
+	current, err := repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if current.Status == orderQuarantined {
+		return nil, ErrOrderQuarantined
+	}
+	if req.FinalPrice != nil {
+		current.FinalPrice = roundMoney(*req.FinalPrice)
+	}
+	if req.DepositRequired != nil {
+		current.DepositRequired = *req.DepositRequired
+	}
+	if req.Status == "in-progress" && current.Status != "in-progress" &&
+		current.DepositRequired && !depositPaid(current) {
+		return nil, ErrDepositRequired
+	}
+
+	if req.FinalPrice != nil {
+		if err := repo.SetFinalPrice(id, current.FinalPrice); err != nil {
+			return nil, err
+		}
+	}
+	if req.DepositRequired != nil {
+		if err := repo.SetDepositRequired(id, current.DepositRequired); err != nil {
+			return nil, err
+		}
+	}
+	if req.AssigneeID != nil {
+		if err := repo.SetAssignee(id, *req.AssigneeID); err != nil {
+			return nil, err
+		}
+	}
+	if req.EstimatedHours != nil {
+		if err := repo.SetEstimatedHours(id, *req.EstimatedHours); err != nil {
+			return nil, err
+		}
+	}
+	if req.Status != "" {
+		if err := repo.UpdateStatus(id, req.Status); err != nil {
+			return nil, err
+		}
+	}
 
 	// Get updated order
-	o, err := s.orderRepo.GetByID(id)
+	o, err := repo.GetByID(id)
 	if err != nil {
 		return nil, err
 	}
 
-	var services []string
-	var fileFormat []string
-	json.Unmarshal([]byte(o.Services), &services)
-	json.Unmarshal([]byte(o.FileFormat), &fileFormat)
+	// A new deadline or a status change can move the deadline status
+	if req.Deadline != nil {
+		o.Deadline = *req.Deadline
+		o.DeadlineAt = parseDeadline(o.Deadline)
+	}
+	state := deadlineState(o, time.Now())
+	if req.Deadline != nil {
+		err = repo.SetDeadline(id, o.Deadline, o.DeadlineAt, state)
+	} else if state != o.DeadlineStatus {
+		err = repo.SetDeadlineStatus(id, state)
+	}
+	if err != nil {
+		return nil, err
+	}
+	o.DeadlineStatus = state
 
-	updatedOrder := map[string]interface{}{
-		"id":                      o.ID,
-		"clientName":              o.ClientName,
-		"email":                   o.Email,
-		"phone":                   o.Phone,
-		"company":                 o.Company,
-		"projectType":             o.ProjectType,
-		"services":                services,
-		"projectTitle":            o.ProjectTitle,
-		"description":             o.Description,
-		"budget":                  o.Budget,
-		"deadline":                o.Deadline,
-		"priority":                o.Priority,
-		"status":                  o.Status,
-		"communicationPreference": o.CommunicationPreference,
-		"revisionRounds":          o.RevisionRounds,
-		"fileFormat":              fileFormat,
-		"colorPreferences":        o.ColorPreferences,
-		"targetAudience":          o.TargetAudience,
-		"additionalNotes":         o.AdditionalNotes,
-		"createdAt":               o.CreatedAt.Format(time.RFC3339),
-		"updatedAt":               o.UpdatedAt.Format(time.RFC3339),
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
 
-	return updatedOrder, nil
+	return orderToMap(*o), nil
 }
 
 func (s *orderService) DeleteOrder(id string) error {
 	return s.orderRepo.Delete(id)
 }
 
-func (s *orderService) updateClientRecord(email, name, phone, company string) {
+// updateClientRecord creates the client on their first order or bumps the
+// order count of an existing one. Contact details and lastOrderDate only
+// move forward, so importing older orders does not rewind them.
+func (s *orderService) updateClientRecord(email, name, phone, company string, orderedAt time.Time) error {
 	client, err := s.clientRepo.GetByEmail(email)
 
 	if err == sql.ErrNoRows {
@@ -717,19 +1218,23 @@ func (s *orderService) updateClientRecord(email, name, phone, company string) {
 			Company:       company,
 			TotalOrders:   1,
 			TotalSpent:    0,
-			LastOrderDate: time.Now(),
+			LastOrderDate: orderedAt,
 			CreatedAt:     time.Now(),
 		}
-		s.clientRepo.Create(newClient)
+		return s.clientRepo.Create(newClient)
 	} else if err == nil {
-		// Update existing client
-		client.Name = name
-		client.Phone = phone
-		client.Company = company
+		// Update existing client; contact details follow the latest order
 		client.TotalOrders++
-		client.LastOrderDate = time.Now()
-		s.clientRepo.Update(client)
+		if orderedAt.After(client.LastOrderDate) {
+			client.Name = name
+			client.Phone = phone
+			client.Company = company
+			client.LastOrderDate = orderedAt
+		}
+		return s.clientRepo.Update(client)
 	}
+
+	return err
 }
 
 // Client Service Implementation
@@ -765,6 +1270,10 @@ func (h *ProjectHandler) CreateProject(c *gin.Context) {
 	}
 
 	id, err := h.service.CreateProject(req)
+	if err == ErrUnknownAssignee {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -812,6 +1321,10 @@ func (h *ProjectHandler) UpdateProject(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
 		return
 	}
+	if err == ErrUnknownAssignee {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -837,11 +1350,13 @@ func (h *ProjectHandler) DeleteProject(c *gin.Context) {
 }
 
 type OrderHandler struct {
-	service OrderService
+	service    OrderService
+	guard      *SubmissionGuard
+	quarantine QuarantineService
 }
 
-func NewOrderHandler(service OrderService) *OrderHandler {
-	return &OrderHandler{service: service}
+func NewOrderHandler(service OrderService, guard *SubmissionGuard, quarantine QuarantineService) *OrderHandler {
+	return &OrderHandler{service: service, guard: guard, quarantine: quarantine}
 }
 
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
@@ -854,7 +1369,35 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		return
 	}
 
-	orderID, err := h.service.CreateOrder(req)
+	verdict, err := h.guard.Check(req, c.ClientIP(), time.Now())
+	if err == ErrTooManySubmissions {
+		c.JSON(http.StatusTooManyRequests, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err == ErrCaptchaFailed {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// Bots get the same answer as everyone else, so they can't tell their
+	// order went nowhere or was held
+	if verdict.Drop {
+		log.Printf("spam: dropped honeypot order from %s", c.ClientIP())
+		token, _ := generateToken()
+		h.respondCreated(c, &Order{ID: generateOrderID(), TrackingToken: token})
+		return
+	}
+	if verdict.Quarantine != "" {
+		req.Status = orderQuarantined
+	}
+
+	order, err := h.service.CreateOrder(req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, APIResponse{
 			Success: false,
@@ -862,11 +1405,42 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		})
 		return
 	}
+	if verdict.Quarantine != "" {
+		if err := h.quarantine.Quarantine(order.ID, verdict.Quarantine, c.ClientIP()); err != nil {
+			log.Printf("spam: quarantine order %s: %v", order.ID, err)
+		}
+	}
+
+	h.respondCreated(c, order)
+}
 
+func (h *OrderHandler) respondCreated(c *gin.Context, order *Order) {
+	// The tracking token is only handed out here, to whoever placed the
+	// order; order listings leave it out
 	c.JSON(http.StatusCreated, APIResponse{
 		Success: true,
 		Message: "Order created successfully",
-		Data:    map[string]string{"id": orderID},
+		Data: map[string]string{
+			"id":            order.ID,
+			"trackingToken": order.TrackingToken,
+			"trackingUrl":   publicLink(trackingPath + order.TrackingToken),
+		},
+	})
+}
+
+func (h *OrderHandler) EstimateOrder(c *gin.Context) {
+	var req OrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    h.service.EstimateOrder(req),
 	})
 }
 
@@ -874,7 +1448,7 @@ func (h *OrderHandler) GetOrders(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
 
-	orders, pagination, err := h.service.GetAllOrders(page, limit)
+	orders, pagination, err := h.service.GetAllOrders(orderFilterFromQuery(c), page, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, APIResponse{
 			Success: false,
@@ -901,7 +1475,48 @@ func (h *OrderHandler) UpdateOrder(c *gin.Context) {
 		return
 	}
 
-	updatedOrder, err := h.service.UpdateOrderStatus(id, req.Status)
+	updatedOrder, err := h.service.UpdateOrder(id, req)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Order not found",
+		})
+		return
+	}
+	if err == ErrNothingToUpdate || err == ErrUnknownStatus || err == ErrNegativePrice ||
+		err == ErrInvalidDeadline || err == ErrNegativeHours || err == ErrUnknownAssignee {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err == ErrDepositRequired || err == ErrOrderQuarantined {
+		c.JSON(http.StatusConflict, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Order updated successfully",
+		Data:    updatedOrder,
+	})
+}
+
+func (h *OrderHandler) DeleteOrder(c *gin.Context) {
+	id := c.Param("id")
+
+	err := h.service.DeleteOrder(id)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, APIResponse{
 			Success: false,
@@ -909,84 +1524,294 @@ func (h *OrderHandler) UpdateOrder(c *gin.Context) {
 		})
 		return
 	}
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, APIResponse{
-			Success: false,
-			Message: err.Error(),
-		})
-		return
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Order deleted successfully",
+	})
+}
+
+type ClientHandler struct {
+	service ClientService
+}
+
+func NewClientHandler(service ClientService) *ClientHandler {
+	return &ClientHandler{service: service}
+}
+
+func (h *ClientHandler) GetClients(c *gin.Context) {
+	clients, err := h.service.GetAllClients()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    clients,
+	})
+}
+
+// ====================
+// UTILITIES
+// ====================
+
+var (
+	ErrNothingToUpdate = errors.New("nothing to update")
+	ErrUnknownStatus   = errors.New("unknown order status")
+	ErrNegativePrice   = errors.New("price cannot be negative")
+	ErrNegativeHours   = errors.New("estimated hours cannot be negative")
+)
+
+var orderStatuses = map[string]bool{
+	"pending":     true,
+	"in-progress": true,
+	"completed":   true,
+	"cancelled":   true,
+	"on-hold":     true,
+}
+
+var orderPriorities = map[string]bool{
+	"low":    true,
+	"normal": true,
+	"high":   true,
+	"urgent": true,
+}
+
+// newOrderFromRequest builds an order with a fresh ID and tracking token,
+// encoding the list fields as JSON the way they are stored.
+func newOrderFromRequest(req OrderRequest, now time.Time) (*Order, error) {
+	trackingToken, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	servicesJSON, _ := json.Marshal(req.Services)
+	fileFormatJSON, _ := json.Marshal(req.FileFormat)
+
+	if req.Status == "" {
+		req.Status = "pending"
+	}
+
+	order := &Order{
+		ID:                      generateOrderID(),
+		ClientName:              req.ClientName,
+		Email:                   req.Email,
+		Phone:                   req.Phone,
+		Company:                 req.Company,
+		ProjectType:             req.ProjectType,
+		Services:                string(servicesJSON),
+		ProjectTitle:            req.ProjectTitle,
+		Description:             req.Description,
+		Budget:                  req.Budget,
+		Deadline:                req.Deadline,
+		Priority:                req.Priority,
+		Status:                  req.Status,
+		CommunicationPreference: req.CommunicationPreference,
+		RevisionRounds:          req.RevisionRounds,
+		FileFormat:              string(fileFormatJSON),
+		ColorPreferences:        req.ColorPreferences,
+		TargetAudience:          req.TargetAudience,
+		AdditionalNotes:         req.AdditionalNotes,
+		DepositRequired:         appConfig.Payments.RequireDeposit,
+		DeadlineAt:              parseDeadline(req.Deadline),
+		TrackingToken:           trackingToken,
+		CreatedAt:               now,
+		UpdatedAt:               now,
+	}
+	order.DeadlineStatus = deadlineState(order, now)
+	if order.Status == "completed" {
+		order.CompletedAt = &now
 	}
 
-	c.JSON(http.StatusOK, APIResponse{
-		Success: true,
-		Message: "Order updated successfully",
-		Data:    updatedOrder,
-	})
+	return order, nil
 }
 
-func (h *OrderHandler) DeleteOrder(c *gin.Context) {
-	id := c.Param("id")
+func (f OrderFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
 
-	err := h.service.DeleteOrder(id)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, APIResponse{
-			Success: false,
-			Message: "Order not found",
-		})
-		return
+	if f.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, f.Status)
+	} else {
+		conditions = append(conditions, "status != 'quarantined'")
 	}
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, APIResponse{
-			Success: false,
-			Message: err.Error(),
-		})
-		return
+	if f.Priority != "" {
+		conditions = append(conditions, "priority = ?")
+		args = append(args, f.Priority)
+	}
+	if f.ProjectType != "" {
+		conditions = append(conditions, "project_type = ?")
+		args = append(args, f.ProjectType)
+	}
+	if f.Email != "" {
+		conditions = append(conditions, "email = ?")
+		args = append(args, f.Email)
+	}
+	if f.Assignee == "unassigned" {
+		conditions = append(conditions, "assignee_id = ''")
+	} else if f.Assignee != "" {
+		conditions = append(conditions, "assignee_id = ?")
+		args = append(args, f.Assignee)
+	}
+	if f.Search != "" {
+		like := "%" + f.Search + "%"
+		conditions = append(conditions, "(client_name LIKE ? OR email LIKE ? OR project_title LIKE ? OR id LIKE ?)")
+		args = append(args, like, like, like, like)
+	}
+	if !f.From.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, f.From)
+	}
+	if !f.To.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, f.To)
 	}
 
-	c.JSON(http.StatusOK, APIResponse{
-		Success: true,
-		Message: "Order deleted successfully",
-	})
-}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// orderFilterFromQuery reads the list filters shared by GET /api/orders and
+// the export endpoint. Dates are inclusive calendar days (YYYY-MM-DD).
+func orderFilterFromQuery(c *gin.Context) OrderFilter {
+	filter := OrderFilter{
+		Status:      c.Query("status"),
+		Priority:    c.Query("priority"),
+		ProjectType: c.Query("projectType"),
+		Email:       c.Query("email"),
+		Assignee:    c.Query("assignee"),
+		Search:      c.Query("search"),
+	}
+	if from, err := time.Parse("2006-01-02", c.Query("from")); err == nil {
+		filter.From = from
+	}
+	if to, err := time.Parse("2006-01-02", c.Query("to")); err == nil {
+		filter.To = to.AddDate(0, 0, 1)
+	}
 
-type ClientHandler struct {
-	service ClientService
+	return filter
 }
 
-func NewClientHandler(service ClientService) *ClientHandler {
-	return &ClientHandler{service: service}
+func projectToMap(p Project) map[string]interface{} {
+	var services []string
+	json.Unmarshal([]byte(p.Services), &services)
+
+	return map[string]interface{}{
+		"id":              p.ID,
+		"clientName":      p.ClientName,
+		"email":           p.Email,
+		"phone":           p.Phone,
+		"projectType":     p.ProjectType,
+		"services":        services,
+		"projectTitle":    p.ProjectTitle,
+		"description":     p.Description,
+		"budget":          p.Budget,
+		"deadline":        p.Deadline,
+		"referenceFiles":  p.ReferenceFiles,
+		"additionalNotes": p.AdditionalNotes,
+		"assigneeId":      p.AssigneeID,
+	}
 }
 
-func (h *ClientHandler) GetClients(c *gin.Context) {
-	clients, err := h.service.GetAllClients()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, APIResponse{
-			Success: false,
-			Message: err.Error(),
-		})
-		return
+func orderToMap(o Order) map[string]interface{} {
+	var services []string
+	var fileFormat []string
+	var estimate *PriceEstimate
+	json.Unmarshal([]byte(o.Services), &services)
+	json.Unmarshal([]byte(o.FileFormat), &fileFormat)
+	json.Unmarshal([]byte(o.Estimate), &estimate)
+
+	return map[string]interface{}{
+		"id":                      o.ID,
+		"clientName":              o.ClientName,
+		"email":                   o.Email,
+		"phone":                   o.Phone,
+		"company":                 o.Company,
+		"projectType":             o.ProjectType,
+		"services":                services,
+		"projectTitle":            o.ProjectTitle,
+		"description":             o.Description,
+		"budget":                  o.Budget,
+		"deadline":                o.Deadline,
+		"deadlineAt":              o.DeadlineAt,
+		"deadlineStatus":          o.DeadlineStatus,
+		"priority":                o.Priority,
+		"status":                  o.Status,
+		"communicationPreference": o.CommunicationPreference,
+		"revisionRounds":          o.RevisionRounds,
+		"fileFormat":              fileFormat,
+		"colorPreferences":        o.ColorPreferences,
+		"targetAudience":          o.TargetAudience,
+		"additionalNotes":         o.AdditionalNotes,
+		"finalPrice":              o.FinalPrice,
+		"depositRequired":         o.DepositRequired,
+		"amountPaid":              o.AmountPaid,
+		"balanceDue":              balanceDue(&o),
+		"estimatedPrice":          o.EstimatedPrice,
+		"estimate":                estimate,
+		"estimatedHours":          o.EstimatedHours,
+		"completedAt":             o.CompletedAt,
+		"assigneeId":              o.AssigneeID,
+		"createdAt":               o.CreatedAt.Format(time.RFC3339),
+		"updatedAt":               o.UpdatedAt.Format(time.RFC3339),
 	}
+}
 
-	c.JSON(http.StatusOK, APIResponse{
-		Success: true,
-		Data:    clients,
-	})
+var lastIDNano int64
+
+// nextIDNano returns the current UnixNano, bumped past the previously issued
+// value so IDs generated in a tight loop (e.g. during imports) never collide.
+func nextIDNano() int64 {
+	for {
+		last := atomic.LoadInt64(&lastIDNano)
+		now := time.Now().UnixNano()
+		if now <= last {
+			now = last + 1
+		}
+		if atomic.CompareAndSwapInt64(&lastIDNano, last, now) {
+			return now
+		}
+	}
 }
 
-// ====================
-// UTILITIES
-// ====================
+// roundMoney rounds an amount to whole cents.
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
 
 func generateOrderID() string {
-	return "ORD-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	return "ORD-" + strconv.FormatInt(nextIDNano(), 10)
 }
 
 func generateClientID() string {
-	return "CLIENT-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	return "CLIENT-" + strconv.FormatInt(nextIDNano(), 10)
 }
 
-func initDB() *sql.DB {
-	db, err := sql.Open("sqlite3", "./projects.db")
+// generateToken returns an unguessable URL-safe token for links that are
+// handed out instead of a login.
+func generateToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func initDB(dsn string) *sql.DB {
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		panic(err)
 	}
@@ -1048,7 +1873,286 @@ func initDB() *sql.DB {
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);`
 
-	tables := []string{createProjectsTable, createOrdersTable, createClientsTable}
+	// Create invoices tables
+	createInvoicesTable := `
+	CREATE TABLE IF NOT EXISTS invoices (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		number TEXT UNIQUE,
+		order_id TEXT,
+		client_id TEXT,
+		status TEXT DEFAULT 'draft',
+		currency TEXT,
+		subtotal REAL DEFAULT 0,
+		tax_rate REAL DEFAULT 0,
+		tax_amount REAL DEFAULT 0,
+		total REAL DEFAULT 0,
+		notes TEXT,
+		bill_to_name TEXT DEFAULT '',
+		bill_to_email TEXT DEFAULT '',
+		bill_to_phone TEXT DEFAULT '',
+		bill_to_company TEXT DEFAULT '',
+		issue_date DATETIME,
+		due_date DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	createInvoiceItemsTable := `
+	CREATE TABLE IF NOT EXISTS invoice_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		invoice_id INTEGER REFERENCES invoices(id) ON DELETE CASCADE,
+		description TEXT,
+		quantity REAL DEFAULT 1,
+		unit_price REAL DEFAULT 0,
+		amount REAL DEFAULT 0
+	);`
+
+	createInvoiceSequencesTable := `
+	CREATE TABLE IF NOT EXISTS invoice_sequences (
+		year INTEGER PRIMARY KEY,
+		last_value INTEGER NOT NULL
+	);`
+
+	// Create payments table
+	createPaymentsTable := `
+	CREATE TABLE IF NOT EXISTS payments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id TEXT,
+		invoice_id INTEGER,
+		kind TEXT,
+		amount REAL,
+		method TEXT,
+		reference TEXT,
+		notes TEXT,
+		paid_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Create gateway_events table; the provider's event id makes webhook
+	// delivery idempotent
+	createGatewayEventsTable := `
+	CREATE TABLE IF NOT EXISTS gateway_events (
+		id TEXT PRIMARY KEY,
+		provider TEXT,
+		type TEXT,
+		order_id TEXT,
+		received_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Create quotes and quote_items tables
+	createQuotesTable := `
+	CREATE TABLE IF NOT EXISTS quotes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id TEXT,
+		token TEXT UNIQUE,
+		status TEXT DEFAULT 'draft',
+		currency TEXT,
+		total REAL,
+		notes TEXT,
+		valid_until DATETIME,
+		sent_at DATETIME,
+		responded_at DATETIME,
+		decline_reason TEXT DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	createQuoteItemsTable := `
+	CREATE TABLE IF NOT EXISTS quote_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		quote_id INTEGER,
+		description TEXT,
+		quantity REAL,
+		unit_price REAL,
+		amount REAL
+	);`
+
+	// Create deadline_reminders table; one row per reminder sent, keyed by
+	// deadline so a rescheduled order is reminded again
+	createDeadlineRemindersTable := `
+	CREATE TABLE IF NOT EXISTS deadline_reminders (
+		order_id TEXT,
+		deadline_at DATETIME,
+		sent_at DATETIME,
+		PRIMARY KEY (order_id, deadline_at)
+	);`
+
+	// Create milestones and milestone_tasks tables
+	createMilestonesTable := `
+	CREATE TABLE IF NOT EXISTS milestones (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_id INTEGER,
+		name TEXT,
+		position INTEGER DEFAULT 0,
+		due_date DATETIME,
+		completed_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	createMilestoneTasksTable := `
+	CREATE TABLE IF NOT EXISTS milestone_tasks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		milestone_id INTEGER,
+		title TEXT,
+		done INTEGER DEFAULT 0,
+		position INTEGER DEFAULT 0,
+		completed_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Create time_entries table; ended_at stays NULL while a timer runs
+	createTimeEntriesTable := `
+	CREATE TABLE IF NOT EXISTS time_entries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id TEXT,
+		order_id TEXT DEFAULT '',
+		project_id INTEGER,
+		note TEXT DEFAULT '',
+		started_at DATETIME,
+		ended_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Create gallery_items table; tags is a JSON array
+	createGalleryItemsTable := `
+	CREATE TABLE IF NOT EXISTS gallery_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		title TEXT,
+		description TEXT DEFAULT '',
+		category TEXT DEFAULT '',
+		tags TEXT DEFAULT '[]',
+		image TEXT DEFAULT '',
+		sort_order INTEGER DEFAULT 0,
+		published INTEGER DEFAULT 0,
+		project_id INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Create uploads table; variants is a JSON array of processed sizes
+	createUploadsTable := `
+	CREATE TABLE IF NOT EXISTS uploads (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		owner_type TEXT,
+		owner_id TEXT,
+		filename TEXT DEFAULT '',
+		content_type TEXT DEFAULT '',
+		size INTEGER DEFAULT 0,
+		original_path TEXT,
+		width INTEGER DEFAULT 0,
+		height INTEGER DEFAULT 0,
+		status TEXT DEFAULT 'pending',
+		error TEXT DEFAULT '',
+		variants TEXT DEFAULT '[]',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		processed_at DATETIME
+	);`
+
+	// Create deliverables table; token is the client's access link
+	createDeliverablesTable := `
+	CREATE TABLE IF NOT EXISTS deliverables (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id TEXT,
+		title TEXT DEFAULT '',
+		token TEXT UNIQUE,
+		upload_id INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Create order history and messages tables
+	createOrderStatusHistoryTable := `
+	CREATE TABLE IF NOT EXISTS order_status_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id TEXT,
+		status TEXT,
+		changed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	createOrderMessagesTable := `
+	CREATE TABLE IF NOT EXISTS order_messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id TEXT,
+		author TEXT,
+		author_name TEXT DEFAULT '',
+		body TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Create client portal tables; login tokens are single-use magic links
+	createClientLoginTokensTable := `
+	CREATE TABLE IF NOT EXISTS client_login_tokens (
+		token TEXT PRIMARY KEY,
+		client_id TEXT,
+		expires_at DATETIME,
+		used_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	createClientSessionsTable := `
+	CREATE TABLE IF NOT EXISTS client_sessions (
+		token TEXT PRIMARY KEY,
+		client_id TEXT,
+		expires_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	createOrderQuarantineTable := `
+	CREATE TABLE IF NOT EXISTS order_quarantine (
+		order_id TEXT PRIMARY KEY,
+		reason TEXT,
+		ip TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	createIdempotencyKeysTable := `
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		key TEXT PRIMARY KEY,
+		fingerprint TEXT,
+		status INTEGER,
+		content_type TEXT,
+		body BLOB,
+		created_at DATETIME
+	);`
+
+	createOrderSyncIDsTable := `
+	CREATE TABLE IF NOT EXISTS order_sync_ids (
+		local_id TEXT,
+		email TEXT,
+		order_id TEXT,
+		synced_at DATETIME,
+		PRIMARY KEY (local_id, email)
+	);`
+
+	// Create users and sessions tables
+	createUsersTable := `
+	CREATE TABLE IF NOT EXISTS users (
+		id TEXT PRIMARY KEY,
+		username TEXT UNIQUE,
+		name TEXT,
+		email TEXT,
+		role TEXT,
+		password_hash TEXT,
+		calendar_token TEXT UNIQUE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	createSessionsTable := `
+	CREATE TABLE IF NOT EXISTS sessions (
+		token TEXT PRIMARY KEY,
+		user_id TEXT,
+		expires_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	tables := []string{createProjectsTable, createOrdersTable, createClientsTable,
+		createInvoicesTable, createInvoiceItemsTable, createInvoiceSequencesTable,
+		createPaymentsTable, createGatewayEventsTable, createQuotesTable, createQuoteItemsTable,
+		createDeadlineRemindersTable, createUsersTable, createSessionsTable,
+		createMilestonesTable, createMilestoneTasksTable, createTimeEntriesTable,
+		createGalleryItemsTable, createUploadsTable, createDeliverablesTable, createOrderStatusHistoryTable,
+		createOrderMessagesTable, createClientLoginTokensTable, createClientSessionsTable,
+		createOrderQuarantineTable, createIdempotencyKeysTable, createOrderSyncIDsTable}
 	for _, table := range tables {
 		_, err = db.Exec(table)
 		if err != nil {
@@ -1056,47 +2160,218 @@ func initDB() *sql.DB {
 		}
 	}
 
+	// Columns added after the tables were first created
+	columns := []struct{ table, column, definition string }{
+		{"orders", "final_price", "REAL DEFAULT 0"},
+		// Orders from before deposits were tracked don't need one
+		{"orders", "deposit_required", "INTEGER DEFAULT 0"},
+		{"orders", "estimated_price", "REAL DEFAULT 0"},
+		{"orders", "estimate", "TEXT DEFAULT ''"},
+		{"orders", "deadline_at", "DATETIME"},
+		{"orders", "deadline_status", "TEXT DEFAULT ''"},
+		{"projects", "deadline_at", "DATETIME"},
+		{"orders", "estimated_hours", "REAL DEFAULT 0"},
+		{"orders", "assignee_id", "TEXT DEFAULT ''"},
+		{"projects", "assignee_id", "TEXT DEFAULT ''"},
+		{"orders", "completed_at", "DATETIME"},
+		{"gallery_items", "image_id", "INTEGER"},
+		{"deliverables", "review", "TEXT DEFAULT ''"},
+		{"deliverables", "review_note", "TEXT DEFAULT ''"},
+		{"deliverables", "reviewed_at", "DATETIME"},
+		{"orders", "tracking_token", "TEXT DEFAULT ''"},
+		{"invoices", "bill_to_name", "TEXT DEFAULT ''"},
+		{"invoices", "bill_to_email", "TEXT DEFAULT ''"},
+		{"invoices", "bill_to_phone", "TEXT DEFAULT ''"},
+		{"invoices", "bill_to_company", "TEXT DEFAULT ''"},
+	}
+	for _, col := range columns {
+		if err := addColumnIfMissing(db, col.table, col.column, col.definition); err != nil {
+			panic(err)
+		}
+	}
+
+	for _, table := range []string{"orders", "projects"} {
+		if err := backfillDeadlines(db, table); err != nil {
+			panic(err)
+		}
+	}
+
+	if err := backfillTrackingTokens(db); err != nil {
+		panic(err)
+	}
+
+	// Orders completed before completed_at existed: the last update is the
+	// best guess at when that happened
+	_, err = db.Exec("UPDATE orders SET completed_at = updated_at WHERE status = 'completed' AND completed_at IS NULL")
+	if err != nil {
+		panic(err)
+	}
+
 	return db
 }
 
+// addColumnIfMissing brings databases created by older versions up to date,
+// since CREATE TABLE IF NOT EXISTS leaves existing tables untouched.
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
+}
+
 // ====================
 // DEPENDENCY INJECTION & MAIN
 // ====================
 
 func main() {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	appConfig = cfg
+
 	// Initialize database
-	db := initDB()
+	db := initDB(cfg.DatabaseDSN)
 	defer db.Close()
 
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import-orders":
+			code := runImportCommand(db, os.Args[2:])
+			db.Close()
+			os.Exit(code)
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+			os.Exit(2)
+		}
+	}
+
 	// Initialize repositories
 	projectRepo := NewProjectRepository(db)
 	orderRepo := NewOrderRepository(db)
 	clientRepo := NewClientRepository(db)
+	userRepo := NewUserRepository(db)
 
 	// Initialize services
-	projectService := NewProjectService(projectRepo)
-	orderService := NewOrderService(orderRepo, clientRepo)
+	projectService := NewProjectService(projectRepo, userRepo)
+	pricingRules, err := loadPricingRules(cfg.PricingRulesFile)
+	if err != nil {
+		panic(err)
+	}
+	pricingEngine := NewPricingEngine(pricingRules)
+	orderService := NewOrderService(db, orderRepo, clientRepo, userRepo, pricingEngine)
 	clientService := NewClientService(clientRepo)
+	privacyService := NewPrivacyService(db, uploadDir())
+	exportService := NewExportService(orderRepo, clientRepo)
+	importService := NewImportService(db)
+	invoiceService := NewInvoiceService(db)
+	paymentService := NewPaymentService(db)
+	checkoutService := NewCheckoutService(db, newPaymentGateway(cfg.Payments), cfg.Payments.SuccessURL, cfg.Payments.CancelURL)
+	mailer := newMailer(cfg.SMTP)
+	authService := NewAuthService(db)
+	if err := authService.EnsureAdmin(cfg.Admin); err != nil {
+		panic(err)
+	}
+	calendarService := NewCalendarService(db)
+	quoteService := NewQuoteService(db, mailer)
+	deadlineService := NewDeadlineService(db, mailer)
+	milestoneService := NewMilestoneService(db)
+	teamService := NewTeamService(db)
+	timeTrackingService := NewTimeTrackingService(db)
+	reportService := NewReportService(db)
+	imagePipeline := NewImagePipeline(db, uploadDir(), imageWorkers)
+	galleryService := NewGalleryService(db, uploadDir(), imagePipeline)
+	attachmentService := NewAttachmentService(db, uploadDir(), imagePipeline)
+	watermark, err := loadWatermarkSettings(cfg.Watermark)
+	if err != nil {
+		panic(err)
+	}
+	deliverableService := NewDeliverableService(db, uploadDir(), imagePipeline, watermark)
+	messageService := NewMessageService(db, mailer)
+	portalService := NewPortalService(db, mailer, messageService, deliverableService)
+	trackingService := NewTrackingService(db)
+	submissionGuard := NewSubmissionGuard(newCaptchaVerifier(cfg.Captcha), cfg.OrderLimits)
+	quarantineService := NewQuarantineService(db)
+	syncService := NewSyncService(db, pricingEngine, submissionGuard)
+	rateLimiter := NewRateLimiter(cfg.RateLimits)
+	idempotencyService := NewIdempotencyService(db)
 
 	projectHandler := NewProjectHandler(projectService)
-	orderHandler := NewOrderHandler(orderService)
+	orderHandler := NewOrderHandler(orderService, submissionGuard, quarantineService)
 	clientHandler := NewClientHandler(clientService)
+	privacyHandler := NewPrivacyHandler(privacyService)
+	exportHandler := NewExportHandler(exportService)
+	importHandler := NewImportHandler(importService)
+	invoiceHandler := NewInvoiceHandler(invoiceService)
+	paymentHandler := NewPaymentHandler(paymentService)
+	checkoutHandler := NewCheckoutHandler(checkoutService)
+	quoteHandler := NewQuoteHandler(quoteService)
+	deadlineHandler := NewDeadlineHandler(deadlineService)
+	authHandler := NewAuthHandler(authService)
+	calendarHandler := NewCalendarHandler(calendarService, authService)
+	milestoneHandler := NewMilestoneHandler(milestoneService)
+	teamHandler := NewTeamHandler(teamService)
+	timeTrackingHandler := NewTimeTrackingHandler(timeTrackingService)
+	reportHandler := NewReportHandler(reportService)
+	galleryHandler := NewGalleryHandler(galleryService)
+	attachmentHandler := NewAttachmentHandler(attachmentService)
+	deliverableHandler := NewDeliverableHandler(deliverableService)
+	messageHandler := NewMessageHandler(messageService)
+	portalHandler := NewPortalHandler(portalService)
+	trackingHandler := NewTrackingHandler(trackingService)
+	quarantineHandler := NewQuarantineHandler(quarantineService)
+	syncHandler := NewSyncHandler(syncService)
+	idempotencyHandler := NewIdempotencyHandler(idempotencyService)
+
+	// Background jobs
+	scheduler := NewScheduler()
+	scheduler.Every("deadline-status", deadlineCheckInterval, deadlineService.RefreshDeadlineStatuses)
+	scheduler.Every("deadline-reminders", deadlineCheckInterval, deadlineService.SendReminders)
+	scheduler.Every("image-sweep", imageSweepInterval, imagePipeline.Sweep)
+	scheduler.Every("submission-sweep", submissionSweepInterval, submissionGuard.Sweep)
+	scheduler.Every("rate-limit-sweep", rateLimitSweepInterval, rateLimiter.Sweep)
+	scheduler.Every("idempotency-sweep", idempotencySweepInterval, idempotencyService.Sweep)
+	imagePipeline.Start(context.Background())
+	scheduler.Start(context.Background())
+
+	r, err := newRouter(cfg)
+	if err != nil {
+		panic(err)
+	}
 
-	r := gin.Default()
-
-	// CORS middleware
-	r.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type")
+	// CORS goes first so every response, errors included, carries it
+	r.Use(NewCORS(cfg.CORS).Handle)
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
+	// Rate limits; every request counts against "default" by IP, and the
+	// groups below are attached to their routes
+	r.Use(rateLimiter.Limit("default"))
+	staffLimit := rateLimiter.Limit("staff")
+	portalLimit := rateLimiter.Limit("portal")
+	publicLimit := rateLimiter.Limit("public")
+	loginLimit := rateLimiter.Limit("login")
 
-		c.Next()
-	})
+	// Mutating requests with an Idempotency-Key replay their first response,
+	// so the frontend can retry after a network failure
+	r.Use(idempotencyHandler.Handle)
 
 	// Project routes
 	r.POST("/projects", projectHandler.CreateProject)
@@ -1105,15 +2380,140 @@ func main() {
 	r.PUT("/projects/:id", projectHandler.UpdateProject)
 	r.DELETE("/projects/:id", projectHandler.DeleteProject)
 
+	// Milestone routes
+	r.GET("/api/projects/:id/milestones", milestoneHandler.GetMilestones)
+	r.POST("/api/projects/:id/milestones", authHandler.RequireAuth, staffLimit, milestoneHandler.CreateMilestone)
+	r.POST("/api/projects/:id/milestones/defaults", authHandler.RequireAuth, staffLimit, milestoneHandler.CreateDefaultMilestones)
+	r.PATCH("/api/projects/:id/milestones/:milestoneId", authHandler.RequireAuth, staffLimit, milestoneHandler.UpdateMilestone)
+	r.DELETE("/api/projects/:id/milestones/:milestoneId", authHandler.RequireAuth, staffLimit, milestoneHandler.DeleteMilestone)
+	r.POST("/api/projects/:id/milestones/:milestoneId/tasks", authHandler.RequireAuth, staffLimit, milestoneHandler.CreateTask)
+	r.PATCH("/api/projects/:id/milestones/:milestoneId/tasks/:taskId", authHandler.RequireAuth, staffLimit, milestoneHandler.UpdateTask)
+	r.DELETE("/api/projects/:id/milestones/:milestoneId/tasks/:taskId", authHandler.RequireAuth, staffLimit, milestoneHandler.DeleteTask)
+
 	// Order routes
-	r.POST("/api/orders", orderHandler.CreateOrder)
+	r.POST("/api/orders", publicLimit, orderHandler.CreateOrder)
+	r.POST("/api/orders/estimate", publicLimit, orderHandler.EstimateOrder)
+	r.POST("/api/orders/sync", publicLimit, syncHandler.SyncOrders)
+	r.GET("/api/orders/due", authHandler.RequireAuth, staffLimit, deadlineHandler.GetDueOrders)
 	r.GET("/api/orders", orderHandler.GetOrders)
-	r.PATCH("/api/orders/:id", orderHandler.UpdateOrder)
+	r.GET("/api/orders/export", authHandler.RequireAuth, staffLimit, authHandler.RequireAdmin, exportHandler.ExportOrders)
+	r.POST("/api/orders/import", authHandler.RequireAuth, staffLimit, importHandler.ImportOrders)
+	r.PATCH("/api/orders/:id", authHandler.RequireAuth, staffLimit, orderHandler.UpdateOrder)
 	r.DELETE("/api/orders/:id", orderHandler.DeleteOrder)
 
+	// Suspicious submissions from the public order form, held for review
+	r.GET("/api/quarantine", authHandler.RequireAuth, staffLimit, quarantineHandler.GetQuarantined)
+	r.POST("/api/quarantine/:id/approve", authHandler.RequireAuth, staffLimit, quarantineHandler.Approve)
+	r.POST("/api/quarantine/:id/discard", authHandler.RequireAuth, staffLimit, quarantineHandler.Discard)
+
 	// Client routes
 	r.GET("/api/clients", clientHandler.GetClients)
+	r.GET("/api/clients/export", authHandler.RequireAuth, staffLimit, authHandler.RequireAdmin, exportHandler.ExportClients)
+	r.GET("/api/clients/:id/export", authHandler.RequireAuth, staffLimit, authHandler.RequireAdmin, privacyHandler.ExportClient)
+	r.POST("/api/clients/:id/erase", authHandler.RequireAuth, staffLimit, authHandler.RequireAdmin, privacyHandler.EraseClient)
+
+	// Invoice routes
+	r.POST("/api/invoices", authHandler.RequireAuth, staffLimit, invoiceHandler.CreateInvoice)
+	r.GET("/api/invoices", authHandler.RequireAuth, staffLimit, invoiceHandler.GetInvoices)
+	r.GET("/api/invoices/:id", authHandler.RequireAuth, staffLimit, invoiceHandler.GetInvoice)
+	r.PATCH("/api/invoices/:id", authHandler.RequireAuth, staffLimit, invoiceHandler.UpdateInvoice)
+	r.GET("/api/invoices/:id/pdf", authHandler.RequireAuth, staffLimit, invoiceHandler.GetInvoicePDF)
+
+	// Payment routes
+	r.POST("/api/orders/:id/payments", authHandler.RequireAuth, staffLimit, paymentHandler.CreatePayment)
+	r.GET("/api/orders/:id/payments", authHandler.RequireAuth, staffLimit, paymentHandler.GetPayments)
+	r.DELETE("/api/payments/:id", authHandler.RequireAuth, staffLimit, paymentHandler.DeletePayment)
+	r.POST("/api/orders/:id/checkout", checkoutHandler.CreateCheckout)
+	r.POST("/api/payments/webhook", checkoutHandler.Webhook)
+
+	// Quote routes; the /api/public ones are reached through the link mailed
+	// to the client
+	r.POST("/api/orders/:id/quotes", authHandler.RequireAuth, staffLimit, quoteHandler.CreateQuote)
+	r.GET("/api/orders/:id/quotes", authHandler.RequireAuth, staffLimit, quoteHandler.GetQuotes)
+	r.GET("/api/quotes/:id", authHandler.RequireAuth, staffLimit, quoteHandler.GetQuote)
+	r.POST("/api/quotes/:id/send", authHandler.RequireAuth, staffLimit, quoteHandler.SendQuote)
+	r.GET("/api/public/quotes/:token", publicLimit, quoteHandler.GetPublicQuote)
+	r.POST("/api/public/quotes/:token/accept", publicLimit, quoteHandler.AcceptQuote)
+	r.POST("/api/public/quotes/:token/decline", publicLimit, quoteHandler.DeclineQuote)
+
+	// Auth routes
+	r.POST("/api/auth/login", loginLimit, authHandler.Login)
+	r.GET("/api/auth/me", authHandler.RequireAuth, staffLimit, authHandler.Me)
+	r.GET("/api/auth/calendar", authHandler.RequireAuth, staffLimit, authHandler.GetCalendarLink)
+	r.POST("/api/auth/calendar/rotate", authHandler.RequireAuth, staffLimit, authHandler.RotateCalendarToken)
+
+	// Team routes
+	r.GET("/api/team", authHandler.RequireAuth, staffLimit, teamHandler.GetMembers)
+	r.POST("/api/team", authHandler.RequireAuth, staffLimit, authHandler.RequireAdmin, teamHandler.CreateMember)
+	r.GET("/api/team/workload", authHandler.RequireAuth, staffLimit, teamHandler.GetWorkload)
+
+	// Time tracking routes; entries belong to the signed-in user
+	r.POST("/api/time/start", authHandler.RequireAuth, staffLimit, timeTrackingHandler.StartTimer)
+	r.POST("/api/time/stop", authHandler.RequireAuth, staffLimit, timeTrackingHandler.StopTimer)
+	r.GET("/api/time/entries", authHandler.RequireAuth, staffLimit, timeTrackingHandler.GetEntries)
+	r.POST("/api/time/entries", authHandler.RequireAuth, staffLimit, timeTrackingHandler.LogTime)
+	r.DELETE("/api/time/entries/:id", authHandler.RequireAuth, staffLimit, timeTrackingHandler.DeleteEntry)
+	r.GET("/api/orders/:id/profitability", authHandler.RequireAuth, staffLimit, timeTrackingHandler.GetOrderProfitability)
+
+	// Report routes; all take optional from and to dates
+	r.GET("/api/reports/revenue", authHandler.RequireAuth, staffLimit, authHandler.RequireAdmin, reportHandler.Revenue)
+	r.GET("/api/reports/orders", authHandler.RequireAuth, staffLimit, authHandler.RequireAdmin, reportHandler.Orders)
+	r.GET("/api/reports/turnaround", authHandler.RequireAuth, staffLimit, authHandler.RequireAdmin, reportHandler.Turnaround)
+	r.GET("/api/reports/conversion", authHandler.RequireAuth, staffLimit, authHandler.RequireAdmin, reportHandler.Conversion)
+	r.GET("/api/reports/top-clients", authHandler.RequireAuth, staffLimit, authHandler.RequireAdmin, reportHandler.TopClients)
+
+	// Gallery routes; the public ones only show published items
+	r.GET("/api/gallery", galleryHandler.GetPublishedItems)
+	r.GET("/api/gallery/:id", galleryHandler.GetPublishedItem)
+	galleryAdmin := r.Group("/api/admin/gallery", authHandler.RequireAuth, staffLimit)
+	galleryAdmin.GET("", galleryHandler.GetAllItems)
+	galleryAdmin.POST("", galleryHandler.CreateItem)
+	galleryAdmin.GET("/:id", galleryHandler.GetItem)
+	galleryAdmin.PATCH("/:id", galleryHandler.UpdateItem)
+	galleryAdmin.DELETE("/:id", galleryHandler.DeleteItem)
+	galleryAdmin.POST("/:id/image", galleryHandler.UploadImage)
+	r.Static(galleryUploadPath, filepath.Join(uploadDir(), "gallery"))
+
+	// Order attachments; image variants are made in the background
+	r.POST("/api/orders/:id/attachments", authHandler.RequireAuth, staffLimit, attachmentHandler.AddAttachment)
+	r.GET("/api/orders/:id/attachments", authHandler.RequireAuth, staffLimit, attachmentHandler.GetAttachments)
+	r.GET("/api/attachments/:id", authHandler.RequireAuth, staffLimit, attachmentHandler.DownloadAttachment)
+	r.DELETE("/api/attachments/:id", authHandler.RequireAuth, staffLimit, attachmentHandler.DeleteAttachment)
+
+	// Deliverables; clients get a watermarked preview through the token link
+	// and the original once the order is paid
+	r.POST("/api/orders/:id/deliverables", authHandler.RequireAuth, staffLimit, deliverableHandler.AddDeliverable)
+	r.GET("/api/orders/:id/deliverables", authHandler.RequireAuth, staffLimit, deliverableHandler.GetDeliverables)
+	r.GET("/api/deliverables/:id/original", authHandler.RequireAuth, staffLimit, deliverableHandler.DownloadOriginal)
+	r.DELETE("/api/deliverables/:id", authHandler.RequireAuth, staffLimit, deliverableHandler.DeleteDeliverable)
+	r.GET("/api/public/deliverables/:token", publicLimit, deliverableHandler.GetPublicDeliverable)
+	r.GET("/api/public/deliverables/:token/preview", publicLimit, deliverableHandler.GetPublicPreview)
+	r.GET("/api/public/deliverables/:token/original", publicLimit, deliverableHandler.GetPublicOriginal)
+
+	// Order messages between the studio and the client
+	r.GET("/api/orders/:id/messages", authHandler.RequireAuth, staffLimit, messageHandler.GetMessages)
+	r.POST("/api/orders/:id/messages", authHandler.RequireAuth, staffLimit, messageHandler.PostMessage)
+
+	// Client portal; clients sign in with an emailed link and only see
+	// orders filed under their own email
+	r.POST("/api/portal/login", loginLimit, portalHandler.RequestLoginLink)
+	r.POST("/api/portal/session", loginLimit, portalHandler.Login)
+	portal := r.Group("/api/portal", portalHandler.RequireClient, portalLimit)
+	portal.POST("/logout", portalHandler.Logout)
+	portal.GET("/me", portalHandler.Me)
+	portal.GET("/orders", portalHandler.GetOrders)
+	portal.GET("/orders/:id", portalHandler.GetOrder)
+	portal.GET("/orders/:id/messages", portalHandler.GetMessages)
+	portal.POST("/orders/:id/messages", portalHandler.PostMessage)
+	portal.GET("/orders/:id/deliverables", portalHandler.GetDeliverables)
+	portal.POST("/deliverables/:id/review", portalHandler.ReviewDeliverable)
+
+	// Order tracking for clients without a portal login
+	r.GET("/api/track/:token", publicLimit, trackingHandler.GetTrackedOrder)
+
+	// Calendar feed, authenticated by the per-user token in the URL
+	r.GET("/api/calendar.ics", publicLimit, calendarHandler.GetFeed)
 
 	// Start server
-	r.Run(":8080")
+	r.Run(cfg.ListenAddr)
 }
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// MODELS
+// ====================
+
+// OrderMessage is one message in the conversation between the studio and
+// the client about an order.
+type OrderMessage struct {
+	ID         int       `json:"id" db:"id"`
+	OrderID    string    `json:"orderId" db:"order_id"`
+	Author     string    `json:"author" db:"author"` // client or studio
+	AuthorName string    `json:"authorName" db:"author_name"`
+	Body       string    `json:"body" db:"body"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+}
+
+const (
+	messageFromClient = "client"
+	messageFromStudio = "studio"
+
+	maxMessageLength = 5000
+)
+
+// ====================
+// DTOs
+// ====================
+
+type MessageRequest struct {
+	Body string `json:"body"`
+}
+
+var ErrInvalidMessage = errors.New("message must be between 1 and 5000 characters")
+
+// ====================
+// REPOSITORIES
+// ====================
+
+type MessageRepository interface {
+	Create(m *OrderMessage) error
+	GetByOrder(orderID string) ([]OrderMessage, error)
+	DeleteByOrder(orderID string) error
+}
+
+type messageRepository struct {
+	db DBTX
+}
+
+func NewMessageRepository(db DBTX) MessageRepository {
+	return &messageRepository{db: db}
+}
+
+func (r *messageRepository) Create(m *OrderMessage) error {
+	result, err := r.db.Exec(`
+		INSERT INTO order_messages (order_id, author, author_name, body, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, m.OrderID, m.Author, m.AuthorName, m.Body, m.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	m.ID = int(id)
+
+	return nil
+}
+
+func (r *messageRepository) GetByOrder(orderID string) ([]OrderMessage, error) {
+	rows, err := r.db.Query(`
+		SELECT id, order_id, author, author_name, body, created_at
+		FROM order_messages WHERE order_id = ? ORDER BY id
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []OrderMessage{}
+	for rows.Next() {
+		var m OrderMessage
+		if err := rows.Scan(&m.ID, &m.OrderID, &m.Author, &m.AuthorName, &m.Body, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+func (r *messageRepository) DeleteByOrder(orderID string) error {
+	_, err := r.db.Exec("DELETE FROM order_messages WHERE order_id = ?", orderID)
+	return err
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type MessageService interface {
+	GetMessages(orderID string) ([]OrderMessage, error)
+	// PostMessage stores the message and emails the other side: the client
+	// for studio messages, the studio inbox for client messages.
+	PostMessage(orderID, author, authorName string, req MessageRequest) (*OrderMessage, error)
+}
+
+type messageService struct {
+	db     *sql.DB
+	mailer Mailer
+}
+
+func NewMessageService(db *sql.DB, mailer Mailer) MessageService {
+	return &messageService{db: db, mailer: mailer}
+}
+
+func (s *messageService) GetMessages(orderID string) ([]OrderMessage, error) {
+	if _, err := NewOrderRepository(s.db).GetByID(orderID); err != nil {
+		return nil, err
+	}
+	return NewMessageRepository(s.db).GetByOrder(orderID)
+}
+
+func (s *messageService) PostMessage(orderID, author, authorName string, req MessageRequest) (*OrderMessage, error) {
+	order, err := NewOrderRepository(s.db).GetByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	body := strings.TrimSpace(req.Body)
+	if body == "" || len([]rune(body)) > maxMessageLength {
+		return nil, ErrInvalidMessage
+	}
+
+	m := &OrderMessage{
+		OrderID:    order.ID,
+		Author:     author,
+		AuthorName: authorName,
+		Body:       body,
+		CreatedAt:  time.Now(),
+	}
+	if err := NewMessageRepository(s.db).Create(m); err != nil {
+		return nil, err
+	}
+
+	// The message is saved either way; a failed notification is only logged
+	if err := s.mailer.Send(messageMail(m, order)); err != nil {
+		log.Printf("messages: notify order %s: %v", order.ID, err)
+	}
+	return m, nil
+}
+
+func messageMail(m *OrderMessage, order *Order) Mail {
+	if m.Author == messageFromClient {
+		return Mail{
+			To:      studioEmail(),
+			Subject: fmt.Sprintf("New message from %s: %s", order.ClientName, order.ProjectTitle),
+			Body:    fmt.Sprintf("%s wrote about order %s:\n\n%s\n", m.AuthorName, order.ID, m.Body),
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Hi %s,\n\n", order.ClientName)
+	fmt.Fprintf(&b, "%s sent you a message about %q:\n\n%s\n\n", m.AuthorName, order.ProjectTitle, m.Body)
+	fmt.Fprintf(&b, "You can reply from your client portal:\n%s\n\n", publicLink("/portal"))
+	fmt.Fprintf(&b, "Thanks,\n%s\n", invoiceBrandName)
+
+	return Mail{
+		To:      order.Email,
+		Subject: fmt.Sprintf("New message from %s: %s", invoiceBrandName, order.ProjectTitle),
+		Body:    b.String(),
+	}
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type MessageHandler struct {
+	service MessageService
+}
+
+func NewMessageHandler(service MessageService) *MessageHandler {
+	return &MessageHandler{service: service}
+}
+
+func (h *MessageHandler) GetMessages(c *gin.Context) {
+	messages, err := h.service.GetMessages(c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Order not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    messages,
+	})
+}
+
+// PostMessage sends a message to the client as the signed-in user.
+func (h *MessageHandler) PostMessage(c *gin.Context) {
+	var req MessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	message, err := h.service.PostMessage(c.Param("id"), messageFromStudio, currentUser(c).Name, req)
+	respondMessage(c, message, err)
+}
+
+// respondMessage is shared with the client portal, which posts the same
+// messages from the other side.
+func respondMessage(c *gin.Context, message *OrderMessage, err error) {
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Order not found",
+		})
+		return
+	}
+	if err == ErrInvalidMessage {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, APIResponse{
+		Success: true,
+		Message: "Message sent successfully",
+		Data:    message,
+	})
+}
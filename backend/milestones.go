@@ -0,0 +1,842 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// MODELS
+// ====================
+
+type Milestone struct {
+	ID          int             `json:"id" db:"id"`
+	ProjectID   int             `json:"projectId" db:"project_id"`
+	Name        string          `json:"name" db:"name"`
+	Position    int             `json:"position" db:"position"`
+	DueDate     *time.Time      `json:"dueDate" db:"due_date"`
+	CompletedAt *time.Time      `json:"completedAt" db:"completed_at"`
+	Completed   bool            `json:"completed"`
+	CreatedAt   time.Time       `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time       `json:"updatedAt" db:"updated_at"`
+	Tasks       []MilestoneTask `json:"tasks"`
+}
+
+type MilestoneTask struct {
+	ID          int        `json:"id" db:"id"`
+	MilestoneID int        `json:"milestoneId" db:"milestone_id"`
+	Title       string     `json:"title" db:"title"`
+	Done        bool       `json:"done" db:"done"`
+	Position    int        `json:"position" db:"position"`
+	CompletedAt *time.Time `json:"completedAt" db:"completed_at"`
+	CreatedAt   time.Time  `json:"createdAt" db:"created_at"`
+}
+
+type ProjectMilestones struct {
+	ProjectID  int         `json:"projectId"`
+	Progress   int         `json:"progress"` // percent
+	Milestones []Milestone `json:"milestones"`
+}
+
+// ====================
+// DTOs
+// ====================
+
+type MilestoneRequest struct {
+	Name    string   `json:"name"`
+	DueDate string   `json:"dueDate"`
+	Tasks   []string `json:"tasks"`
+}
+
+// MilestoneUpdateRequest changes whichever of its fields are set. Completed
+// only applies to milestones without tasks; the rest follow their tasks.
+type MilestoneUpdateRequest struct {
+	Name      *string `json:"name"`
+	DueDate   *string `json:"dueDate"`
+	Position  *int    `json:"position"`
+	Completed *bool   `json:"completed"`
+}
+
+type TaskRequest struct {
+	Title string `json:"title"`
+}
+
+type TaskUpdateRequest struct {
+	Title    *string `json:"title"`
+	Done     *bool   `json:"done"`
+	Position *int    `json:"position"`
+}
+
+// defaultMilestones are the usual stages of an illustration or branding job.
+var defaultMilestones = []string{"Sketch", "Linework", "Color", "Final"}
+
+var (
+	ErrMilestoneNameRequired = errors.New("milestone name is required")
+	ErrTaskTitleRequired     = errors.New("task title is required")
+	ErrMilestoneHasTasks     = errors.New("milestones with tasks are completed by finishing their tasks")
+)
+
+// projectProgress is the share of completed tasks. Projects without tasks
+// fall back to the share of completed milestones.
+func projectProgress(milestones []Milestone) int {
+	var tasks, done, completed int
+	for _, m := range milestones {
+		for _, t := range m.Tasks {
+			tasks++
+			if t.Done {
+				done++
+			}
+		}
+		if m.Completed {
+			completed++
+		}
+	}
+
+	switch {
+	case tasks > 0:
+		return int(math.Round(float64(done) * 100 / float64(tasks)))
+	case len(milestones) > 0:
+		return int(math.Round(float64(completed) * 100 / float64(len(milestones))))
+	default:
+		return 0
+	}
+}
+
+// ====================
+// REPOSITORIES
+// ====================
+
+type MilestoneRepository interface {
+	GetByProject(projectID int) ([]Milestone, error)
+	GetByID(id int) (*Milestone, error)
+	GetOpenWithDueDate() ([]Milestone, error)
+	Create(m *Milestone) error
+	Update(m *Milestone) error
+	Delete(id int) error
+	DeleteByProject(projectID int) error
+	NextPosition(projectID int) (int, error)
+	GetTask(id int) (*MilestoneTask, error)
+	CreateTask(t *MilestoneTask) error
+	UpdateTask(t *MilestoneTask) error
+	DeleteTask(id int) error
+}
+
+type milestoneRepository struct {
+	db DBTX
+}
+
+func NewMilestoneRepository(db DBTX) MilestoneRepository {
+	return &milestoneRepository{db: db}
+}
+
+const milestoneColumns = `id, project_id, name, position, due_date, completed_at, created_at, updated_at`
+
+func scanMilestone(row rowScanner) (*Milestone, error) {
+	var m Milestone
+	var dueDate, completedAt sql.NullTime
+
+	err := row.Scan(&m.ID, &m.ProjectID, &m.Name, &m.Position, &dueDate, &completedAt,
+		&m.CreatedAt, &m.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if dueDate.Valid {
+		m.DueDate = &dueDate.Time
+	}
+	if completedAt.Valid {
+		m.CompletedAt = &completedAt.Time
+		m.Completed = true
+	}
+
+	return &m, nil
+}
+
+func (r *milestoneRepository) list(query string, args ...interface{}) ([]Milestone, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	milestones := []Milestone{}
+	for rows.Next() {
+		m, err := scanMilestone(rows)
+		if err != nil {
+			return nil, err
+		}
+		milestones = append(milestones, *m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range milestones {
+		if milestones[i].Tasks, err = r.getTasks(milestones[i].ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return milestones, nil
+}
+
+func (r *milestoneRepository) GetByProject(projectID int) ([]Milestone, error) {
+	return r.list("SELECT "+milestoneColumns+" FROM milestones WHERE project_id = ? ORDER BY position, id", projectID)
+}
+
+// GetOpenWithDueDate returns unfinished milestones that have a due date.
+func (r *milestoneRepository) GetOpenWithDueDate() ([]Milestone, error) {
+	return r.list("SELECT " + milestoneColumns + ` FROM milestones
+		WHERE due_date IS NOT NULL AND completed_at IS NULL ORDER BY due_date`)
+}
+
+func (r *milestoneRepository) GetByID(id int) (*Milestone, error) {
+	m, err := scanMilestone(r.db.QueryRow("SELECT "+milestoneColumns+" FROM milestones WHERE id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	m.Tasks, err = r.getTasks(m.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (r *milestoneRepository) Create(m *Milestone) error {
+	result, err := r.db.Exec(`
+		INSERT INTO milestones (project_id, name, position, due_date, completed_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, m.ProjectID, m.Name, m.Position, m.DueDate, m.CompletedAt, m.CreatedAt, m.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	m.ID = int(id)
+
+	return nil
+}
+
+func (r *milestoneRepository) Update(m *Milestone) error {
+	result, err := r.db.Exec(`
+		UPDATE milestones SET name = ?, position = ?, due_date = ?, completed_at = ?, updated_at = ?
+		WHERE id = ?
+	`, m.Name, m.Position, m.DueDate, m.CompletedAt, m.UpdatedAt, m.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *milestoneRepository) Delete(id int) error {
+	if _, err := r.db.Exec("DELETE FROM milestone_tasks WHERE milestone_id = ?", id); err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec("DELETE FROM milestones WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *milestoneRepository) DeleteByProject(projectID int) error {
+	_, err := r.db.Exec(`
+		DELETE FROM milestone_tasks
+		WHERE milestone_id IN (SELECT id FROM milestones WHERE project_id = ?)
+	`, projectID)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec("DELETE FROM milestones WHERE project_id = ?", projectID)
+	return err
+}
+
+func (r *milestoneRepository) NextPosition(projectID int) (int, error) {
+	var next int
+	err := r.db.QueryRow("SELECT COALESCE(MAX(position), 0) + 1 FROM milestones WHERE project_id = ?",
+		projectID).Scan(&next)
+	return next, err
+}
+
+const taskColumns = `id, milestone_id, title, done, position, completed_at, created_at`
+
+func scanTask(row rowScanner) (*MilestoneTask, error) {
+	var t MilestoneTask
+	var completedAt sql.NullTime
+
+	err := row.Scan(&t.ID, &t.MilestoneID, &t.Title, &t.Done, &t.Position, &completedAt, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if completedAt.Valid {
+		t.CompletedAt = &completedAt.Time
+	}
+
+	return &t, nil
+}
+
+func (r *milestoneRepository) getTasks(milestoneID int) ([]MilestoneTask, error) {
+	rows, err := r.db.Query("SELECT "+taskColumns+" FROM milestone_tasks WHERE milestone_id = ? ORDER BY position, id",
+		milestoneID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []MilestoneTask{}
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, *t)
+	}
+
+	return tasks, rows.Err()
+}
+
+func (r *milestoneRepository) GetTask(id int) (*MilestoneTask, error) {
+	return scanTask(r.db.QueryRow("SELECT "+taskColumns+" FROM milestone_tasks WHERE id = ?", id))
+}
+
+func (r *milestoneRepository) CreateTask(t *MilestoneTask) error {
+	result, err := r.db.Exec(`
+		INSERT INTO milestone_tasks (milestone_id, title, done, position, completed_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, t.MilestoneID, t.Title, t.Done, t.Position, t.CompletedAt, t.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	t.ID = int(id)
+
+	return nil
+}
+
+func (r *milestoneRepository) UpdateTask(t *MilestoneTask) error {
+	result, err := r.db.Exec(`
+		UPDATE milestone_tasks SET title = ?, done = ?, position = ?, completed_at = ? WHERE id = ?
+	`, t.Title, t.Done, t.Position, t.CompletedAt, t.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *milestoneRepository) DeleteTask(id int) error {
+	result, err := r.db.Exec("DELETE FROM milestone_tasks WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type MilestoneService interface {
+	GetMilestones(projectID int) (*ProjectMilestones, error)
+	CreateMilestone(projectID int, req MilestoneRequest) (*Milestone, error)
+	CreateDefaultMilestones(projectID int) (*ProjectMilestones, error)
+	UpdateMilestone(projectID, id int, req MilestoneUpdateRequest) (*Milestone, error)
+	DeleteMilestone(projectID, id int) error
+	CreateTask(projectID, milestoneID int, req TaskRequest) (*Milestone, error)
+	UpdateTask(projectID, milestoneID, taskID int, req TaskUpdateRequest) (*Milestone, error)
+	DeleteTask(projectID, milestoneID, taskID int) (*Milestone, error)
+}
+
+type milestoneService struct {
+	db *sql.DB
+}
+
+func NewMilestoneService(db *sql.DB) MilestoneService {
+	return &milestoneService{db: db}
+}
+
+func (s *milestoneService) GetMilestones(projectID int) (*ProjectMilestones, error) {
+	if _, err := NewProjectRepository(s.db).GetByID(projectID); err != nil {
+		return nil, err
+	}
+
+	milestones, err := NewMilestoneRepository(s.db).GetByProject(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProjectMilestones{
+		ProjectID:  projectID,
+		Progress:   projectProgress(milestones),
+		Milestones: milestones,
+	}, nil
+}
+
+func (s *milestoneService) CreateMilestone(projectID int, req MilestoneRequest) (*Milestone, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, ErrMilestoneNameRequired
+	}
+	dueDate := parseDeadline(req.DueDate)
+	if req.DueDate != "" && dueDate == nil {
+		return nil, ErrInvalidDeadline
+	}
+	for _, title := range req.Tasks {
+		if strings.TrimSpace(title) == "" {
+			return nil, ErrTaskTitleRequired
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	m, err := s.createMilestone(tx, projectID, name, dueDate, req.Tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (s *milestoneService) createMilestone(tx DBTX, projectID int, name string, dueDate *time.Time,
+	tasks []string) (*Milestone, error) {
+	if _, err := NewProjectRepository(tx).GetByID(projectID); err != nil {
+		return nil, err
+	}
+
+	repo := NewMilestoneRepository(tx)
+	position, err := repo.NextPosition(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	m := &Milestone{
+		ProjectID: projectID,
+		Name:      name,
+		Position:  position,
+		DueDate:   dueDate,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Tasks:     []MilestoneTask{},
+	}
+	if err := repo.Create(m); err != nil {
+		return nil, err
+	}
+
+	for i, title := range tasks {
+		t := &MilestoneTask{MilestoneID: m.ID, Title: strings.TrimSpace(title), Position: i + 1, CreatedAt: now}
+		if err := repo.CreateTask(t); err != nil {
+			return nil, err
+		}
+		m.Tasks = append(m.Tasks, *t)
+	}
+
+	return m, nil
+}
+
+// CreateDefaultMilestones adds the standard stages the project does not
+// have yet, matched by name.
+func (s *milestoneService) CreateDefaultMilestones(projectID int) (*ProjectMilestones, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := NewProjectRepository(tx).GetByID(projectID); err != nil {
+		return nil, err
+	}
+	existing, err := NewMilestoneRepository(tx).GetByProject(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	have := map[string]bool{}
+	for _, m := range existing {
+		have[strings.ToLower(m.Name)] = true
+	}
+	for _, name := range defaultMilestones {
+		if have[strings.ToLower(name)] {
+			continue
+		}
+		if _, err := s.createMilestone(tx, projectID, name, nil, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetMilestones(projectID)
+}
+
+// getMilestone loads a milestone and checks it belongs to the project in
+// the URL, reporting a mismatch as not found.
+func getMilestone(repo MilestoneRepository, projectID, id int) (*Milestone, error) {
+	m, err := repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if m.ProjectID != projectID {
+		return nil, sql.ErrNoRows
+	}
+	return m, nil
+}
+
+func (s *milestoneService) UpdateMilestone(projectID, id int, req MilestoneUpdateRequest) (*Milestone, error) {
+	repo := NewMilestoneRepository(s.db)
+	m, err := getMilestone(repo, projectID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		if strings.TrimSpace(*req.Name) == "" {
+			return nil, ErrMilestoneNameRequired
+		}
+		m.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.DueDate != nil {
+		m.DueDate = parseDeadline(*req.DueDate)
+		if *req.DueDate != "" && m.DueDate == nil {
+			return nil, ErrInvalidDeadline
+		}
+	}
+	if req.Position != nil {
+		m.Position = *req.Position
+	}
+	if req.Completed != nil {
+		if len(m.Tasks) > 0 {
+			return nil, ErrMilestoneHasTasks
+		}
+		setCompleted(&m.CompletedAt, *req.Completed)
+	}
+	m.UpdatedAt = time.Now()
+
+	if err := repo.Update(m); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(id)
+}
+
+func (s *milestoneService) DeleteMilestone(projectID, id int) error {
+	repo := NewMilestoneRepository(s.db)
+	if _, err := getMilestone(repo, projectID, id); err != nil {
+		return err
+	}
+	return repo.Delete(id)
+}
+
+func (s *milestoneService) CreateTask(projectID, milestoneID int, req TaskRequest) (*Milestone, error) {
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		return nil, ErrTaskTitleRequired
+	}
+
+	return s.changeTasks(projectID, milestoneID, func(repo MilestoneRepository, m *Milestone) error {
+		position := 1
+		for _, t := range m.Tasks {
+			if t.Position >= position {
+				position = t.Position + 1
+			}
+		}
+		return repo.CreateTask(&MilestoneTask{
+			MilestoneID: m.ID,
+			Title:       title,
+			Position:    position,
+			CreatedAt:   time.Now(),
+		})
+	})
+}
+
+func (s *milestoneService) UpdateTask(projectID, milestoneID, taskID int, req TaskUpdateRequest) (*Milestone, error) {
+	if req.Title != nil && strings.TrimSpace(*req.Title) == "" {
+		return nil, ErrTaskTitleRequired
+	}
+
+	return s.changeTasks(projectID, milestoneID, func(repo MilestoneRepository, m *Milestone) error {
+		t, err := repo.GetTask(taskID)
+		if err != nil {
+			return err
+		}
+		if t.MilestoneID != m.ID {
+			return sql.ErrNoRows
+		}
+
+		if req.Title != nil {
+			t.Title = strings.TrimSpace(*req.Title)
+		}
+		if req.Position != nil {
+			t.Position = *req.Position
+		}
+		if req.Done != nil {
+			t.Done = *req.Done
+			setCompleted(&t.CompletedAt, t.Done)
+		}
+		return repo.UpdateTask(t)
+	})
+}
+
+func (s *milestoneService) DeleteTask(projectID, milestoneID, taskID int) (*Milestone, error) {
+	return s.changeTasks(projectID, milestoneID, func(repo MilestoneRepository, m *Milestone) error {
+		t, err := repo.GetTask(taskID)
+		if err != nil {
+			return err
+		}
+		if t.MilestoneID != m.ID {
+			return sql.ErrNoRows
+		}
+		return repo.DeleteTask(taskID)
+	})
+}
+
+// changeTasks applies change to the milestone's tasks and then marks the
+// milestone complete exactly when all of its tasks are done.
+func (s *milestoneService) changeTasks(projectID, milestoneID int,
+	change func(repo MilestoneRepository, m *Milestone) error) (*Milestone, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	repo := NewMilestoneRepository(tx)
+	m, err := getMilestone(repo, projectID, milestoneID)
+	if err != nil {
+		return nil, err
+	}
+	if err := change(repo, m); err != nil {
+		return nil, err
+	}
+
+	m, err = repo.GetByID(milestoneID)
+	if err != nil {
+		return nil, err
+	}
+	allDone := len(m.Tasks) > 0
+	for _, t := range m.Tasks {
+		allDone = allDone && t.Done
+	}
+	if len(m.Tasks) > 0 && allDone != m.Completed {
+		setCompleted(&m.CompletedAt, allDone)
+		m.UpdatedAt = time.Now()
+		if err := repo.Update(m); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return NewMilestoneRepository(s.db).GetByID(milestoneID)
+}
+
+// setCompleted stamps or clears a completion time, keeping the original
+// stamp when something already complete is marked complete again.
+func setCompleted(completedAt **time.Time, completed bool) {
+	switch {
+	case completed && *completedAt == nil:
+		now := time.Now()
+		*completedAt = &now
+	case !completed:
+		*completedAt = nil
+	}
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type MilestoneHandler struct {
+	service MilestoneService
+}
+
+func NewMilestoneHandler(service MilestoneService) *MilestoneHandler {
+	return &MilestoneHandler{service: service}
+}
+
+func (h *MilestoneHandler) GetMilestones(c *gin.Context) {
+	projectID, _ := strconv.Atoi(c.Param("id"))
+
+	result, err := h.service.GetMilestones(projectID)
+	h.respond(c, http.StatusOK, "", result, err)
+}
+
+func (h *MilestoneHandler) CreateMilestone(c *gin.Context) {
+	projectID, _ := strconv.Atoi(c.Param("id"))
+	var req MilestoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	milestone, err := h.service.CreateMilestone(projectID, req)
+	h.respond(c, http.StatusCreated, "Milestone created successfully", milestone, err)
+}
+
+func (h *MilestoneHandler) CreateDefaultMilestones(c *gin.Context) {
+	projectID, _ := strconv.Atoi(c.Param("id"))
+
+	result, err := h.service.CreateDefaultMilestones(projectID)
+	h.respond(c, http.StatusCreated, "Default milestones added", result, err)
+}
+
+func (h *MilestoneHandler) UpdateMilestone(c *gin.Context) {
+	projectID, _ := strconv.Atoi(c.Param("id"))
+	id, _ := strconv.Atoi(c.Param("milestoneId"))
+	var req MilestoneUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	milestone, err := h.service.UpdateMilestone(projectID, id, req)
+	h.respond(c, http.StatusOK, "Milestone updated successfully", milestone, err)
+}
+
+func (h *MilestoneHandler) DeleteMilestone(c *gin.Context) {
+	projectID, _ := strconv.Atoi(c.Param("id"))
+	id, _ := strconv.Atoi(c.Param("milestoneId"))
+
+	err := h.service.DeleteMilestone(projectID, id)
+	h.respond(c, http.StatusOK, "Milestone deleted successfully", nil, err)
+}
+
+func (h *MilestoneHandler) CreateTask(c *gin.Context) {
+	projectID, _ := strconv.Atoi(c.Param("id"))
+	milestoneID, _ := strconv.Atoi(c.Param("milestoneId"))
+	var req TaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	milestone, err := h.service.CreateTask(projectID, milestoneID, req)
+	h.respond(c, http.StatusCreated, "Task created successfully", milestone, err)
+}
+
+func (h *MilestoneHandler) UpdateTask(c *gin.Context) {
+	projectID, _ := strconv.Atoi(c.Param("id"))
+	milestoneID, _ := strconv.Atoi(c.Param("milestoneId"))
+	taskID, _ := strconv.Atoi(c.Param("taskId"))
+	var req TaskUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	milestone, err := h.service.UpdateTask(projectID, milestoneID, taskID, req)
+	h.respond(c, http.StatusOK, "Task updated successfully", milestone, err)
+}
+
+func (h *MilestoneHandler) DeleteTask(c *gin.Context) {
+	projectID, _ := strconv.Atoi(c.Param("id"))
+	milestoneID, _ := strconv.Atoi(c.Param("milestoneId"))
+	taskID, _ := strconv.Atoi(c.Param("taskId"))
+
+	milestone, err := h.service.DeleteTask(projectID, milestoneID, taskID)
+	h.respond(c, http.StatusOK, "Task deleted successfully", milestone, err)
+}
+
+func (h *MilestoneHandler) respond(c *gin.Context, status int, message string, data interface{}, err error) {
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Not found",
+		})
+		return
+	}
+	if err == ErrMilestoneNameRequired || err == ErrTaskTitleRequired || err == ErrInvalidDeadline {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err == ErrMilestoneHasTasks {
+		c.JSON(http.StatusConflict, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(status, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    data,
+	})
+}
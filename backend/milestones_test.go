@@ -0,0 +1,101 @@
+package main
+
+import "testing"
+
+func TestProjectProgress(t *testing.T) {
+	task := func(done bool) MilestoneTask { return MilestoneTask{Done: done} }
+	tests := []struct {
+		name       string
+		milestones []Milestone
+		want       int
+	}{
+		{"no milestones", nil, 0},
+		{"milestones without tasks", []Milestone{{Completed: true}, {}, {}}, 33},
+		{"all milestones done", []Milestone{{Completed: true}, {Completed: true}}, 100},
+		{"tasks count, not milestones", []Milestone{
+			{Completed: true, Tasks: []MilestoneTask{task(true)}},
+			{Tasks: []MilestoneTask{task(false), task(false), task(false)}},
+		}, 25},
+		{"tasks round to the nearest percent", []Milestone{
+			{Tasks: []MilestoneTask{task(true), task(true), task(false)}},
+		}, 67},
+		{"milestones without tasks are ignored once any has tasks", []Milestone{
+			{Completed: true},
+			{Tasks: []MilestoneTask{task(false), task(true)}},
+		}, 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := projectProgress(tt.milestones); got != tt.want {
+				t.Errorf("projectProgress() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMilestoneFollowsItsTasks(t *testing.T) {
+	db := newTestDB(t)
+	projectID, err := NewProjectRepository(db).Create(ProjectRequest{
+		ClientName:  "Test Client",
+		Email:       "client@example.com",
+		ProjectType: "logo",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	project := int(projectID)
+
+	s := NewMilestoneService(db)
+	sketch, err := s.CreateMilestone(project, MilestoneRequest{Name: "Sketch", Tasks: []string{"Thumbnails", "Rough"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateMilestone(project, MilestoneRequest{Name: "Final"}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := true
+	progress := func(want int) {
+		t.Helper()
+		got, err := s.GetMilestones(project)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Progress != want {
+			t.Errorf("progress = %d, want %d", got.Progress, want)
+		}
+	}
+
+	m, err := s.UpdateTask(project, sketch.ID, sketch.Tasks[0].ID, TaskUpdateRequest{Done: &done})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Completed {
+		t.Error("milestone completed with a task still open")
+	}
+	progress(50)
+
+	m, err = s.UpdateTask(project, sketch.ID, sketch.Tasks[1].ID, TaskUpdateRequest{Done: &done})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Completed || m.CompletedAt == nil {
+		t.Error("milestone not completed once all its tasks are done")
+	}
+	progress(100)
+
+	// A new task reopens the milestone
+	m, err = s.CreateTask(project, sketch.ID, TaskRequest{Title: "Client feedback"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Completed || m.CompletedAt != nil {
+		t.Error("milestone still complete after adding an open task")
+	}
+	progress(67)
+
+	// Milestones with tasks are completed through them
+	if _, err := s.UpdateMilestone(project, sketch.ID, MilestoneUpdateRequest{Completed: &done}); err != ErrMilestoneHasTasks {
+		t.Errorf("completing a milestone with tasks: err = %v, want ErrMilestoneHasTasks", err)
+	}
+}
@@ -0,0 +1,498 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// MODELS
+// ====================
+
+// Payment records money received for (or returned on) an order. Amount is
+// always positive; refunds are subtracted when totals are computed.
+type Payment struct {
+	ID        int       `json:"id" db:"id"`
+	OrderID   string    `json:"orderId" db:"order_id"`
+	InvoiceID *int      `json:"invoiceId" db:"invoice_id"`
+	Kind      string    `json:"kind" db:"kind"`
+	Amount    float64   `json:"amount" db:"amount"`
+	Method    string    `json:"method" db:"method"`
+	Reference string    `json:"reference" db:"reference"`
+	Notes     string    `json:"notes" db:"notes"`
+	PaidAt    time.Time `json:"paidAt" db:"paid_at"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+type PaymentRequest struct {
+	Kind      string    `json:"kind"`
+	Amount    float64   `json:"amount"`
+	Method    string    `json:"method"`
+	Reference string    `json:"reference"`
+	Notes     string    `json:"notes"`
+	InvoiceID *int      `json:"invoiceId"`
+	PaidAt    time.Time `json:"paidAt"`
+}
+
+type PaymentSummary struct {
+	OrderID         string    `json:"orderId"`
+	FinalPrice      float64   `json:"finalPrice"`
+	AmountPaid      float64   `json:"amountPaid"`
+	BalanceDue      float64   `json:"balanceDue"`
+	DepositRequired bool      `json:"depositRequired"`
+	DepositAmount   float64   `json:"depositAmount"`
+	DepositPaid     bool      `json:"depositPaid"`
+	Payments        []Payment `json:"payments"`
+}
+
+var paymentKinds = map[string]bool{
+	"deposit": true,
+	"payment": true,
+	"refund":  true,
+}
+
+var (
+	ErrInvalidPaymentKind = errors.New("payment kind must be deposit, payment or refund")
+	ErrInvalidAmount      = errors.New("amount must be greater than zero")
+	ErrRefundExceedsPaid  = errors.New("refund exceeds the amount paid")
+	ErrInvoiceMismatch    = errors.New("invoice does not belong to this order")
+	ErrDepositRequired    = errors.New("the deposit must be recorded before the order can start")
+)
+
+// netPaidSQL sums payments for the orders row in scope, counting refunds as
+// negative. It is embedded in orderColumns as amount_paid.
+const netPaidSQL = `(SELECT COALESCE(SUM(CASE WHEN p.kind = 'refund' THEN -p.amount ELSE p.amount END), 0)
+	FROM payments p WHERE p.order_id = orders.id)`
+
+// depositAmount is what must be paid before work starts: the configured
+// share of the final price. An order without a final price only needs some
+// deposit recorded.
+func depositAmount(o *Order) float64 {
+	return roundMoney(o.FinalPrice * appConfig.Payments.DepositPercent / 100)
+}
+
+func depositPaid(o *Order) bool {
+	if o.FinalPrice <= 0 {
+		return o.AmountPaid > 0
+	}
+	return o.AmountPaid >= depositAmount(o)
+}
+
+func balanceDue(o *Order) float64 {
+	return roundMoney(o.FinalPrice - o.AmountPaid)
+}
+
+// ====================
+// REPOSITORIES
+// ====================
+
+type PaymentRepository interface {
+	Create(payment *Payment) error
+	GetByOrder(orderID string) ([]Payment, error)
+	GetByID(id int) (*Payment, error)
+	GetByReference(reference string) (*Payment, error)
+	Delete(id int) error
+	NetPaidForInvoice(invoiceID int) (float64, error)
+}
+
+type paymentRepository struct {
+	db DBTX
+}
+
+func NewPaymentRepository(db DBTX) PaymentRepository {
+	return &paymentRepository{db: db}
+}
+
+func (r *paymentRepository) Create(payment *Payment) error {
+	result, err := r.db.Exec(`
+		INSERT INTO payments (order_id, invoice_id, kind, amount, method, reference, notes, paid_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, payment.OrderID, payment.InvoiceID, payment.Kind, payment.Amount, payment.Method,
+		payment.Reference, payment.Notes, payment.PaidAt, payment.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	payment.ID = int(id)
+
+	return nil
+}
+
+const paymentColumns = `id, order_id, invoice_id, kind, amount, method, reference, notes, paid_at, created_at`
+
+func scanPayment(row rowScanner) (*Payment, error) {
+	var p Payment
+	var invoiceID sql.NullInt64
+
+	err := row.Scan(&p.ID, &p.OrderID, &invoiceID, &p.Kind, &p.Amount, &p.Method,
+		&p.Reference, &p.Notes, &p.PaidAt, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if invoiceID.Valid {
+		id := int(invoiceID.Int64)
+		p.InvoiceID = &id
+	}
+
+	return &p, nil
+}
+
+func (r *paymentRepository) GetByOrder(orderID string) ([]Payment, error) {
+	rows, err := r.db.Query("SELECT "+paymentColumns+" FROM payments WHERE order_id = ? ORDER BY paid_at, id", orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := []Payment{}
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, *p)
+	}
+
+	return payments, rows.Err()
+}
+
+func (r *paymentRepository) GetByID(id int) (*Payment, error) {
+	return scanPayment(r.db.QueryRow("SELECT "+paymentColumns+" FROM payments WHERE id = ?", id))
+}
+
+func (r *paymentRepository) GetByReference(reference string) (*Payment, error) {
+	return scanPayment(r.db.QueryRow("SELECT "+paymentColumns+" FROM payments WHERE reference = ? LIMIT 1", reference))
+}
+
+func (r *paymentRepository) Delete(id int) error {
+	result, err := r.db.Exec("DELETE FROM payments WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *paymentRepository) NetPaidForInvoice(invoiceID int) (float64, error) {
+	var total float64
+	err := r.db.QueryRow(`
+		SELECT COALESCE(SUM(CASE WHEN kind = 'refund' THEN -amount ELSE amount END), 0)
+		FROM payments WHERE invoice_id = ?
+	`, invoiceID).Scan(&total)
+
+	return total, err
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type PaymentService interface {
+	RecordPayment(orderID string, req PaymentRequest) (*Payment, error)
+	GetPaymentSummary(orderID string) (*PaymentSummary, error)
+	DeletePayment(id int) error
+}
+
+type paymentService struct {
+	db *sql.DB
+}
+
+func NewPaymentService(db *sql.DB) PaymentService {
+	return &paymentService{db: db}
+}
+
+// RecordPayment stores the payment and, in the same transaction, refreshes
+// the client's total_spent and the status of the order's invoices.
+func (s *paymentService) RecordPayment(orderID string, req PaymentRequest) (*Payment, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	payment, err := recordPayment(tx, orderID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+// recordPayment validates and stores a payment inside the caller's
+// transaction, then applies its side effects.
+func recordPayment(tx DBTX, orderID string, req PaymentRequest) (*Payment, error) {
+	if req.Kind == "" {
+		req.Kind = "payment"
+	}
+	if !paymentKinds[req.Kind] {
+		return nil, ErrInvalidPaymentKind
+	}
+	if req.Amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if req.PaidAt.IsZero() {
+		req.PaidAt = time.Now()
+	}
+
+	order, err := NewOrderRepository(tx).GetByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := roundMoney(req.Amount)
+	if req.Kind == "refund" && amount > order.AmountPaid {
+		return nil, ErrRefundExceedsPaid
+	}
+
+	if req.InvoiceID != nil {
+		invoice, err := NewInvoiceRepository(tx).GetByID(*req.InvoiceID)
+		if err == sql.ErrNoRows || (err == nil && invoice.OrderID != order.ID) {
+			return nil, ErrInvoiceMismatch
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	payment := &Payment{
+		OrderID:   order.ID,
+		InvoiceID: req.InvoiceID,
+		Kind:      req.Kind,
+		Amount:    amount,
+		Method:    req.Method,
+		Reference: req.Reference,
+		Notes:     req.Notes,
+		PaidAt:    req.PaidAt,
+		CreatedAt: time.Now(),
+	}
+	if err := NewPaymentRepository(tx).Create(payment); err != nil {
+		return nil, err
+	}
+
+	if err := applyPaymentSideEffects(tx, order); err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+func (s *paymentService) GetPaymentSummary(orderID string) (*PaymentSummary, error) {
+	order, err := NewOrderRepository(s.db).GetByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	payments, err := NewPaymentRepository(s.db).GetByOrder(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaymentSummary{
+		OrderID:         order.ID,
+		FinalPrice:      order.FinalPrice,
+		AmountPaid:      order.AmountPaid,
+		BalanceDue:      balanceDue(order),
+		DepositRequired: order.DepositRequired,
+		DepositAmount:   depositAmount(order),
+		DepositPaid:     depositPaid(order),
+		Payments:        payments,
+	}, nil
+}
+
+func (s *paymentService) DeletePayment(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	payments := NewPaymentRepository(tx)
+	payment, err := payments.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if err := payments.Delete(id); err != nil {
+		return err
+	}
+
+	order, err := NewOrderRepository(tx).GetByID(payment.OrderID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if order != nil {
+		if err := applyPaymentSideEffects(tx, order); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// applyPaymentSideEffects keeps derived data in line with the payments table.
+// It runs after payments are added and removed, so an order's sent invoices
+// become paid once covered and paid ones go back to sent when they no longer are.
+func applyPaymentSideEffects(tx DBTX, order *Order) error {
+	if err := NewClientRepository(tx).RecalculateTotalSpent(order.Email); err != nil {
+		return err
+	}
+
+	// A deposit taken before invoicing counts towards the invoice once the
+	// order as a whole is settled.
+	current, err := NewOrderRepository(tx).GetByID(order.ID)
+	if err != nil {
+		return err
+	}
+
+	invoiceRepo := NewInvoiceRepository(tx)
+	invoices, err := invoiceRepo.GetAll(order.ID)
+	if err != nil {
+		return err
+	}
+	for _, invoice := range invoices {
+		if invoice.Status != "sent" && invoice.Status != "paid" {
+			continue
+		}
+		paid, err := NewPaymentRepository(tx).NetPaidForInvoice(invoice.ID)
+		if err != nil {
+			return err
+		}
+		status := "sent"
+		if paid >= invoice.Total || balanceDue(current) == 0 {
+			status = "paid"
+		}
+		if status != invoice.Status {
+			if err := invoiceRepo.UpdateStatus(invoice.ID, status); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type PaymentHandler struct {
+	service PaymentService
+}
+
+func NewPaymentHandler(service PaymentService) *PaymentHandler {
+	return &PaymentHandler{service: service}
+}
+
+func (h *PaymentHandler) CreatePayment(c *gin.Context) {
+	orderID := c.Param("id")
+	var req PaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	payment, err := h.service.RecordPayment(orderID, req)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Order not found",
+		})
+		return
+	}
+	if err == ErrInvalidPaymentKind || err == ErrInvalidAmount || err == ErrInvoiceMismatch {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err == ErrRefundExceedsPaid {
+		c.JSON(http.StatusConflict, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, APIResponse{
+		Success: true,
+		Message: "Payment recorded successfully",
+		Data:    payment,
+	})
+}
+
+func (h *PaymentHandler) GetPayments(c *gin.Context) {
+	summary, err := h.service.GetPaymentSummary(c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Order not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    summary,
+	})
+}
+
+func (h *PaymentHandler) DeletePayment(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	err := h.service.DeletePayment(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Payment not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Payment deleted successfully",
+	})
+}
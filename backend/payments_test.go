@@ -0,0 +1,208 @@
+package main
+
+import "testing"
+
+func TestDepositAndBalance(t *testing.T) {
+	saved := appConfig
+	defer func() { appConfig = saved }()
+	appConfig.Payments.DepositPercent = 50
+
+	tests := []struct {
+		name        string
+		finalPrice  float64
+		amountPaid  float64
+		deposit     float64
+		depositPaid bool
+		balanceDue  float64
+	}{
+		{"nothing paid", 1000, 0, 500, false, 1000},
+		{"short of the deposit", 1000, 499.99, 500, false, 500.01},
+		{"exact deposit", 1000, 500, 500, true, 500},
+		{"paid in full", 1000, 1000, 500, true, 0},
+		{"overpaid", 1000, 1200, 500, true, -200},
+		{"odd cents round", 99.99, 50, 50, true, 49.99},
+		{"no final price, nothing paid", 0, 0, 0, false, 0},
+		{"no final price, something paid", 0, 10, 0, true, -10},
+		{"float noise", 0.3, 0.1 + 0.2, 0.15, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Order{FinalPrice: tt.finalPrice, AmountPaid: tt.amountPaid}
+			if got := depositAmount(o); got != tt.deposit {
+				t.Errorf("depositAmount() = %v, want %v", got, tt.deposit)
+			}
+			if got := depositPaid(o); got != tt.depositPaid {
+				t.Errorf("depositPaid() = %v, want %v", got, tt.depositPaid)
+			}
+			if got := balanceDue(o); got != tt.balanceDue {
+				t.Errorf("balanceDue() = %v, want %v", got, tt.balanceDue)
+			}
+		})
+	}
+}
+
+func TestDepositPercentFromConfig(t *testing.T) {
+	saved := appConfig
+	defer func() { appConfig = saved }()
+
+	o := &Order{FinalPrice: 1000, AmountPaid: 250}
+	tests := []struct {
+		percent float64
+		deposit float64
+		paid    bool
+	}{
+		{0, 0, true},
+		{25, 250, true},
+		{30, 300, false},
+		{100, 1000, false},
+	}
+	for _, tt := range tests {
+		appConfig.Payments.DepositPercent = tt.percent
+		if got := depositAmount(o); got != tt.deposit {
+			t.Errorf("%v%%: depositAmount() = %v, want %v", tt.percent, got, tt.deposit)
+		}
+		if got := depositPaid(o); got != tt.paid {
+			t.Errorf("%v%%: depositPaid() = %v, want %v", tt.percent, got, tt.paid)
+		}
+	}
+}
+
+func TestRecordPayment(t *testing.T) {
+	db := newTestDB(t)
+	clients := NewClientRepository(db)
+	if err := clients.Create(&Client{ID: generateClientID(), Name: "Test Client", Email: "client@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	order := newTestOrder(t, db, 1000)
+	invoices := NewInvoiceService(db)
+	payments := NewPaymentService(db)
+
+	invoice, err := invoices.CreateInvoice(InvoiceRequest{OrderID: order.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := invoices.UpdateInvoiceStatus(invoice.ID, "sent"); err != nil {
+		t.Fatal(err)
+	}
+	check := func(step string, amountPaid float64, invoiceStatus string) {
+		t.Helper()
+		summary, err := payments.GetPaymentSummary(order.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary.AmountPaid != amountPaid || summary.BalanceDue != 1000-amountPaid {
+			t.Errorf("%s: paid %v with %v due, want %v paid", step, summary.AmountPaid, summary.BalanceDue, amountPaid)
+		}
+		client, err := clients.GetByEmail("client@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if client.TotalSpent != amountPaid {
+			t.Errorf("%s: client total spent = %v, want %v", step, client.TotalSpent, amountPaid)
+		}
+		inv, err := invoices.GetInvoice(invoice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inv.Status != invoiceStatus {
+			t.Errorf("%s: invoice status = %q, want %q", step, inv.Status, invoiceStatus)
+		}
+	}
+
+	if _, err := payments.RecordPayment(order.ID, PaymentRequest{Kind: "deposit", Amount: 500}); err != nil {
+		t.Fatal(err)
+	}
+	check("deposit", 500, "sent")
+
+	if _, err := payments.RecordPayment(order.ID, PaymentRequest{Kind: "refund", Amount: 600}); err != ErrRefundExceedsPaid {
+		t.Errorf("refunding more than was paid: err = %v, want ErrRefundExceedsPaid", err)
+	}
+	if _, err := payments.RecordPayment(order.ID, PaymentRequest{Amount: 0}); err != ErrInvalidAmount {
+		t.Errorf("zero payment: err = %v, want ErrInvalidAmount", err)
+	}
+	other := newTestOrder(t, db, 1000)
+	if _, err := payments.RecordPayment(other.ID, PaymentRequest{Amount: 100, InvoiceID: &invoice.ID}); err != ErrInvoiceMismatch {
+		t.Errorf("paying another order's invoice: err = %v, want ErrInvoiceMismatch", err)
+	}
+	check("rejected payments", 500, "sent")
+
+	// The deposit counts towards the invoice once the order is settled
+	if _, err := payments.RecordPayment(order.ID, PaymentRequest{Amount: 500, InvoiceID: &invoice.ID}); err != nil {
+		t.Fatal(err)
+	}
+	check("paid in full", 1000, "paid")
+
+	refund, err := payments.RecordPayment(order.ID, PaymentRequest{Kind: "refund", Amount: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("refund", 800, "sent")
+	if err := payments.DeletePayment(refund.ID); err != nil {
+		t.Fatal(err)
+	}
+	check("refund deleted", 1000, "paid")
+}
+
+func TestInvoiceStatusFollowsPayments(t *testing.T) {
+	saved := appConfig
+	defer func() { appConfig = saved }()
+	appConfig.Payments.DepositPercent = 50
+
+	db := newTestDB(t)
+	order := newTestOrder(t, db, 1000)
+	invoices := NewInvoiceService(db)
+	payments := NewPaymentService(db)
+
+	invoice, err := invoices.CreateInvoice(InvoiceRequest{OrderID: order.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := invoices.UpdateInvoiceStatus(invoice.ID, "sent"); err != nil {
+		t.Fatal(err)
+	}
+	status := func() string {
+		t.Helper()
+		inv, err := invoices.GetInvoice(invoice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return inv.Status
+	}
+
+	deposit, err := payments.RecordPayment(order.ID, PaymentRequest{Kind: "deposit", Amount: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got != "sent" {
+		t.Fatalf("after the deposit: status = %q, want sent", got)
+	}
+
+	// The rest, linked to the invoice, settles the order and with it the invoice
+	rest, err := payments.RecordPayment(order.ID, PaymentRequest{Amount: 500, InvoiceID: &invoice.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got != "paid" {
+		t.Fatalf("after paying in full: status = %q, want paid", got)
+	}
+
+	if err := payments.DeletePayment(deposit.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got != "sent" {
+		t.Fatalf("after deleting the deposit: status = %q, want sent", got)
+	}
+
+	if _, err := payments.RecordPayment(order.ID, PaymentRequest{Amount: 500, InvoiceID: &invoice.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got != "paid" {
+		t.Fatalf("after paying the invoice itself: status = %q, want paid", got)
+	}
+	if err := payments.DeletePayment(rest.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got != "sent" {
+		t.Fatalf("after deleting a linked payment: status = %q, want sent", got)
+	}
+}
@@ -0,0 +1,550 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// MODELS
+// ====================
+
+// ClientOrder is what a client sees of their own order: no estimates,
+// internal notes or assignments.
+type ClientOrder struct {
+	ID           string     `json:"id"`
+	ProjectTitle string     `json:"projectTitle"`
+	ProjectType  string     `json:"projectType"`
+	Status       string     `json:"status"`
+	Deadline     string     `json:"deadline"`
+	DeadlineAt   *time.Time `json:"deadlineAt"`
+	FinalPrice   float64    `json:"finalPrice"`
+	AmountPaid   float64    `json:"amountPaid"`
+	BalanceDue   float64    `json:"balanceDue"`
+	CompletedAt  *time.Time `json:"completedAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+type ClientOrderDetail struct {
+	ClientOrder
+	History []OrderStatusChange `json:"history"`
+}
+
+func clientOrder(o *Order) ClientOrder {
+	return ClientOrder{
+		ID:           o.ID,
+		ProjectTitle: o.ProjectTitle,
+		ProjectType:  o.ProjectType,
+		Status:       o.Status,
+		Deadline:     o.Deadline,
+		DeadlineAt:   o.DeadlineAt,
+		FinalPrice:   o.FinalPrice,
+		AmountPaid:   o.AmountPaid,
+		BalanceDue:   balanceDue(o),
+		CompletedAt:  o.CompletedAt,
+		CreatedAt:    o.CreatedAt,
+		UpdatedAt:    o.UpdatedAt,
+	}
+}
+
+type PortalLoginResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Client    *Client   `json:"client"`
+}
+
+const (
+	// loginLinkTTL is how long an emailed login link works; each link
+	// works once.
+	loginLinkTTL      = 15 * time.Minute
+	clientSessionTTL  = 30 * 24 * time.Hour
+	portalLoginPath   = "/portal/login?token="
+	portalLinkMessage = "If that email belongs to a client, a login link is on its way"
+)
+
+// ====================
+// DTOs
+// ====================
+
+type LoginLinkRequest struct {
+	Email string `json:"email"`
+}
+
+type PortalSessionRequest struct {
+	Token string `json:"token"`
+}
+
+var ErrInvalidLoginLink = errors.New("login link is invalid or has expired")
+
+// ====================
+// REPOSITORIES
+// ====================
+
+// PortalRepository keeps client login links and sessions, apart from the
+// staff sessions so a client token never passes RequireAuth.
+type PortalRepository interface {
+	CreateLoginToken(token, clientID string, expiresAt time.Time) error
+	ConsumeLoginToken(token string, now time.Time) (string, error)
+	CreateSession(token, clientID string, expiresAt time.Time) error
+	GetSessionClient(token string, now time.Time) (string, error)
+	DeleteSession(token string) error
+	DeleteByClient(clientID string) error
+}
+
+type portalRepository struct {
+	db DBTX
+}
+
+func NewPortalRepository(db DBTX) PortalRepository {
+	return &portalRepository{db: db}
+}
+
+func (r *portalRepository) CreateLoginToken(token, clientID string, expiresAt time.Time) error {
+	_, err := r.db.Exec(`
+		INSERT INTO client_login_tokens (token, client_id, expires_at, created_at) VALUES (?, ?, ?, ?)
+	`, token, clientID, expiresAt, time.Now())
+	return err
+}
+
+// ConsumeLoginToken returns the client a login link belongs to and marks
+// the link used, so a second attempt with it fails.
+func (r *portalRepository) ConsumeLoginToken(token string, now time.Time) (string, error) {
+	var clientID string
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err := r.db.QueryRow("SELECT client_id, expires_at, used_at FROM client_login_tokens WHERE token = ?", token).
+		Scan(&clientID, &expiresAt, &usedAt)
+	if err != nil {
+		return "", err
+	}
+	if usedAt.Valid || now.After(expiresAt) {
+		return "", sql.ErrNoRows
+	}
+
+	result, err := r.db.Exec("UPDATE client_login_tokens SET used_at = ? WHERE token = ? AND used_at IS NULL",
+		now, token)
+	if err != nil {
+		return "", err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return "", sql.ErrNoRows
+	}
+
+	return clientID, nil
+}
+
+func (r *portalRepository) CreateSession(token, clientID string, expiresAt time.Time) error {
+	_, err := r.db.Exec(`
+		INSERT INTO client_sessions (token, client_id, expires_at, created_at) VALUES (?, ?, ?, ?)
+	`, token, clientID, expiresAt, time.Now())
+	return err
+}
+
+func (r *portalRepository) GetSessionClient(token string, now time.Time) (string, error) {
+	var clientID string
+	var expiresAt time.Time
+	err := r.db.QueryRow("SELECT client_id, expires_at FROM client_sessions WHERE token = ?", token).
+		Scan(&clientID, &expiresAt)
+	if err != nil {
+		return "", err
+	}
+	if now.After(expiresAt) {
+		return "", sql.ErrNoRows
+	}
+
+	return clientID, nil
+}
+
+func (r *portalRepository) DeleteSession(token string) error {
+	_, err := r.db.Exec("DELETE FROM client_sessions WHERE token = ?", token)
+	return err
+}
+
+// DeleteByClient signs a client out everywhere and voids their login links.
+func (r *portalRepository) DeleteByClient(clientID string) error {
+	if _, err := r.db.Exec("DELETE FROM client_sessions WHERE client_id = ?", clientID); err != nil {
+		return err
+	}
+	_, err := r.db.Exec("DELETE FROM client_login_tokens WHERE client_id = ?", clientID)
+	return err
+}
+
+// ====================
+// SERVICES
+// ====================
+
+// PortalService is the client's side of the API. Every lookup goes through
+// ownOrder, so a client only ever reaches orders filed under their email;
+// anything else reads as not found.
+type PortalService interface {
+	RequestLoginLink(req LoginLinkRequest) error
+	Login(req PortalSessionRequest) (*PortalLoginResponse, error)
+	Authenticate(sessionToken string) (*Client, error)
+	Logout(sessionToken string) error
+	GetOrders(client *Client) ([]ClientOrder, error)
+	GetOrder(client *Client, orderID string) (*ClientOrderDetail, error)
+	GetMessages(client *Client, orderID string) ([]OrderMessage, error)
+	PostMessage(client *Client, orderID string, req MessageRequest) (*OrderMessage, error)
+	GetDeliverables(client *Client, orderID string) ([]Deliverable, error)
+	ReviewDeliverable(client *Client, deliverableID int, req ReviewRequest) (*Deliverable, error)
+}
+
+type portalService struct {
+	db           *sql.DB
+	mailer       Mailer
+	messages     MessageService
+	deliverables DeliverableService
+}
+
+func NewPortalService(db *sql.DB, mailer Mailer, messages MessageService, deliverables DeliverableService) PortalService {
+	return &portalService{db: db, mailer: mailer, messages: messages, deliverables: deliverables}
+}
+
+// RequestLoginLink emails a link to known clients and does nothing for
+// other addresses, without saying which happened.
+func (s *portalService) RequestLoginLink(req LoginLinkRequest) error {
+	client, err := NewClientRepository(s.db).GetByEmail(strings.TrimSpace(req.Email))
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return err
+	}
+	if err := NewPortalRepository(s.db).CreateLoginToken(token, client.ID, time.Now().Add(loginLinkTTL)); err != nil {
+		return err
+	}
+
+	// A failure is only logged; reporting it would tell the caller the
+	// address is a client's
+	if err := s.mailer.Send(loginLinkMail(client, token)); err != nil {
+		log.Printf("portal: login link for %s: %v", client.ID, err)
+	}
+	return nil
+}
+
+func loginLinkMail(client *Client, token string) Mail {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Hi %s,\n\n", client.Name)
+	fmt.Fprintf(&b, "Use this link to sign in to your client portal:\n%s\n\n", publicLink(portalLoginPath+token))
+	fmt.Fprintf(&b, "The link works once and expires in %d minutes. If you did not ask for it, you can ignore this email.\n\n",
+		int(loginLinkTTL.Minutes()))
+	fmt.Fprintf(&b, "Thanks,\n%s\n", invoiceBrandName)
+
+	return Mail{
+		To:      client.Email,
+		Subject: fmt.Sprintf("Your %s login link", invoiceBrandName),
+		Body:    b.String(),
+	}
+}
+
+func (s *portalService) Login(req PortalSessionRequest) (*PortalLoginResponse, error) {
+	repo := NewPortalRepository(s.db)
+	clientID, err := repo.ConsumeLoginToken(req.Token, time.Now())
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidLoginLink
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := NewClientRepository(s.db).GetByID(clientID)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidLoginLink
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(clientSessionTTL)
+	if err := repo.CreateSession(token, client.ID, expiresAt); err != nil {
+		return nil, err
+	}
+
+	return &PortalLoginResponse{Token: token, ExpiresAt: expiresAt, Client: client}, nil
+}
+
+func (s *portalService) Authenticate(sessionToken string) (*Client, error) {
+	clientID, err := NewPortalRepository(s.db).GetSessionClient(sessionToken, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return NewClientRepository(s.db).GetByID(clientID)
+}
+
+func (s *portalService) Logout(sessionToken string) error {
+	return NewPortalRepository(s.db).DeleteSession(sessionToken)
+}
+
+func (s *portalService) GetOrders(client *Client) ([]ClientOrder, error) {
+	orders, err := NewOrderRepository(s.db).GetByEmail(client.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	// Held orders may not be the client's at all until someone approves them
+	result := []ClientOrder{}
+	for i := range orders {
+		if orders[i].Status != orderQuarantined {
+			result = append(result, clientOrder(&orders[i]))
+		}
+	}
+	return result, nil
+}
+
+func (s *portalService) ownOrder(client *Client, orderID string) (*Order, error) {
+	order, err := NewOrderRepository(s.db).GetByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Email != client.Email || order.Status == orderQuarantined {
+		return nil, sql.ErrNoRows
+	}
+	return order, nil
+}
+
+func (s *portalService) GetOrder(client *Client, orderID string) (*ClientOrderDetail, error) {
+	order, err := s.ownOrder(client, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := NewOrderRepository(s.db).GetStatusHistory(order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClientOrderDetail{ClientOrder: clientOrder(order), History: history}, nil
+}
+
+func (s *portalService) GetMessages(client *Client, orderID string) ([]OrderMessage, error) {
+	if _, err := s.ownOrder(client, orderID); err != nil {
+		return nil, err
+	}
+	return s.messages.GetMessages(orderID)
+}
+
+func (s *portalService) PostMessage(client *Client, orderID string, req MessageRequest) (*OrderMessage, error) {
+	if _, err := s.ownOrder(client, orderID); err != nil {
+		return nil, err
+	}
+	return s.messages.PostMessage(orderID, messageFromClient, client.Name, req)
+}
+
+func (s *portalService) GetDeliverables(client *Client, orderID string) ([]Deliverable, error) {
+	if _, err := s.ownOrder(client, orderID); err != nil {
+		return nil, err
+	}
+	return s.deliverables.GetDeliverables(orderID)
+}
+
+// ReviewDeliverable records the verdict and posts it to the order's
+// messages, which also lets the studio know.
+func (s *portalService) ReviewDeliverable(client *Client, deliverableID int, req ReviewRequest) (*Deliverable, error) {
+	d, err := s.deliverables.GetDeliverable(deliverableID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.ownOrder(client, d.OrderID); err != nil {
+		return nil, err
+	}
+
+	if err := s.deliverables.ReviewDeliverable(d, req); err != nil {
+		return nil, err
+	}
+
+	body := fmt.Sprintf("Approved %q.", d.Title)
+	if d.Review == "changes-requested" {
+		body = fmt.Sprintf("Requested changes to %q.", d.Title)
+	}
+	if d.ReviewNote != "" {
+		body += "\n\n" + d.ReviewNote
+	}
+	if _, err := s.messages.PostMessage(d.OrderID, messageFromClient, client.Name, MessageRequest{Body: body}); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type PortalHandler struct {
+	service PortalService
+}
+
+func NewPortalHandler(service PortalService) *PortalHandler {
+	return &PortalHandler{service: service}
+}
+
+// RequireClient is RequireAuth for the portal: it takes a client session
+// token and stores the client under "client".
+func (h *PortalHandler) RequireClient(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	client, err := h.service.Authenticate(token)
+	if err == sql.ErrNoRows {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "Authentication required",
+		})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.Set("client", client)
+	c.Next()
+}
+
+func currentClient(c *gin.Context) *Client {
+	client, _ := c.Get("client")
+	cl, _ := client.(*Client)
+	return cl
+}
+
+func (h *PortalHandler) RequestLoginLink(c *gin.Context) {
+	var req LoginLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	err := h.service.RequestLoginLink(req)
+	h.respond(c, http.StatusOK, portalLinkMessage, nil, err)
+}
+
+func (h *PortalHandler) Login(c *gin.Context) {
+	var req PortalSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	session, err := h.service.Login(req)
+	h.respond(c, http.StatusOK, "", session, err)
+}
+
+func (h *PortalHandler) Logout(c *gin.Context) {
+	err := h.service.Logout(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+	h.respond(c, http.StatusOK, "Signed out", nil, err)
+}
+
+func (h *PortalHandler) Me(c *gin.Context) {
+	h.respond(c, http.StatusOK, "", currentClient(c), nil)
+}
+
+func (h *PortalHandler) GetOrders(c *gin.Context) {
+	orders, err := h.service.GetOrders(currentClient(c))
+	h.respond(c, http.StatusOK, "", orders, err)
+}
+
+func (h *PortalHandler) GetOrder(c *gin.Context) {
+	order, err := h.service.GetOrder(currentClient(c), c.Param("id"))
+	h.respond(c, http.StatusOK, "", order, err)
+}
+
+func (h *PortalHandler) GetMessages(c *gin.Context) {
+	messages, err := h.service.GetMessages(currentClient(c), c.Param("id"))
+	h.respond(c, http.StatusOK, "", messages, err)
+}
+
+func (h *PortalHandler) PostMessage(c *gin.Context) {
+	var req MessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	message, err := h.service.PostMessage(currentClient(c), c.Param("id"), req)
+	respondMessage(c, message, err)
+}
+
+func (h *PortalHandler) GetDeliverables(c *gin.Context) {
+	deliverables, err := h.service.GetDeliverables(currentClient(c), c.Param("id"))
+	h.respond(c, http.StatusOK, "", deliverables, err)
+}
+
+func (h *PortalHandler) ReviewDeliverable(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req ReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	deliverable, err := h.service.ReviewDeliverable(currentClient(c), id, req)
+	h.respond(c, http.StatusOK, "Review saved", deliverable, err)
+}
+
+func (h *PortalHandler) respond(c *gin.Context, status int, message string, data interface{}, err error) {
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Not found",
+		})
+		return
+	}
+	if err == ErrInvalidLoginLink {
+		c.JSON(http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err == ErrInvalidReview || err == ErrInvalidMessage {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(status, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    data,
+	})
+}
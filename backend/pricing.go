@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ====================
+// PRICING
+// ====================
+
+// PricingRules drives the instant estimate. Service and project type keys
+// are matched case-insensitively against what the order form sends.
+type PricingRules struct {
+	Currency                string             `json:"currency"`
+	ProjectTypeBase         map[string]float64 `json:"projectTypeBase"`
+	ServicePrices           map[string]float64 `json:"servicePrices"`
+	DefaultServicePrice     float64            `json:"defaultServicePrice"`
+	IncludedRevisionRounds  int                `json:"includedRevisionRounds"`
+	ExtraRevisionRoundPrice float64            `json:"extraRevisionRoundPrice"`
+	UnlimitedRevisionsPrice float64            `json:"unlimitedRevisionsPrice"`
+	FileFormatSurcharges    map[string]float64 `json:"fileFormatSurcharges"`
+	RushDays                int                `json:"rushDays"`       // deadlines closer than this are rush jobs
+	RushMultiplier          float64            `json:"rushMultiplier"` // applied to everything before the urgent fee
+	UrgentFee               float64            `json:"urgentFee"`
+	HourlyRate              float64            `json:"hourlyRate"` // converts the estimate into hours of work
+}
+
+type PriceEstimate struct {
+	Currency string         `json:"currency"`
+	Lines    []EstimateLine `json:"lines"`
+	Rush     bool           `json:"rush"`
+	Total    float64        `json:"total"`
+	Hours    float64        `json:"hours"` // work before rush and urgent surcharges, in half hours
+}
+
+type EstimateLine struct {
+	Kind   string  `json:"kind"` // base, service, revisions, file-format, rush, urgent
+	Label  string  `json:"label"`
+	Amount float64 `json:"amount"`
+}
+
+func defaultPricingRules() PricingRules {
+	return PricingRules{
+		Currency: invoiceCurrency,
+		ProjectTypeBase: map[string]float64{
+			"graphic-design": 50,
+			"illustration":   80,
+			"branding":       150,
+			"digital-art":    60,
+			"print-design":   50,
+		},
+		ServicePrices: map[string]float64{
+			"logo design":           250,
+			"business card design":  80,
+			"brochure design":       200,
+			"website graphics":      180,
+			"social media graphics": 120,
+			"illustration":          220,
+			"character design":      260,
+			"book cover design":     240,
+			"packaging design":      300,
+			"print design":          150,
+		},
+		DefaultServicePrice:     150,
+		IncludedRevisionRounds:  2,
+		ExtraRevisionRoundPrice: 30,
+		UnlimitedRevisionsPrice: 200,
+		FileFormatSurcharges: map[string]float64{
+			"svg": 15,
+			"ai":  25,
+			"psd": 25,
+			"eps": 20,
+		},
+		RushDays:       7,
+		RushMultiplier: 1.5,
+		UrgentFee:      100,
+		HourlyRate:     40,
+	}
+}
+
+// loadPricingRules starts from the defaults and overlays the JSON file at
+// path, if any, so the file only needs the values it changes.
+func loadPricingRules(path string) (PricingRules, error) {
+	rules := defaultPricingRules()
+
+	if path == "" {
+		return rules, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rules, err
+	}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return rules, err
+	}
+
+	return rules, nil
+}
+
+type PricingEngine struct {
+	rules PricingRules
+}
+
+func NewPricingEngine(rules PricingRules) *PricingEngine {
+	return &PricingEngine{rules: rules}
+}
+
+// Estimate prices an order request as of now. Unknown services fall back to
+// DefaultServicePrice; an unparseable deadline never counts as rush.
+func (e *PricingEngine) Estimate(req OrderRequest, now time.Time) *PriceEstimate {
+	r := e.rules
+	estimate := &PriceEstimate{Currency: r.Currency, Lines: []EstimateLine{}}
+	add := func(kind, label string, amount float64) {
+		if amount == 0 {
+			return
+		}
+		estimate.Lines = append(estimate.Lines, EstimateLine{Kind: kind, Label: label, Amount: roundMoney(amount)})
+		estimate.Total += roundMoney(amount)
+	}
+
+	if base, ok := lookupPrice(r.ProjectTypeBase, req.ProjectType); ok {
+		add("base", "Base fee ("+req.ProjectType+")", base)
+	}
+
+	for _, service := range req.Services {
+		price, ok := lookupPrice(r.ServicePrices, service)
+		if !ok {
+			price = r.DefaultServicePrice
+		}
+		add("service", service, price)
+	}
+
+	switch rounds := strings.TrimSpace(req.RevisionRounds); {
+	case strings.EqualFold(rounds, "unlimited"):
+		add("revisions", "Unlimited revisions", r.UnlimitedRevisionsPrice)
+	default:
+		if n, err := strconv.Atoi(rounds); err == nil && n > r.IncludedRevisionRounds {
+			extra := n - r.IncludedRevisionRounds
+			add("revisions", strconv.Itoa(extra)+" extra revision round(s)", float64(extra)*r.ExtraRevisionRoundPrice)
+		}
+	}
+
+	for _, format := range req.FileFormat {
+		if surcharge, ok := lookupPrice(r.FileFormatSurcharges, format); ok {
+			add("file-format", strings.ToUpper(format)+" source files", surcharge)
+		}
+	}
+
+	if r.HourlyRate > 0 {
+		estimate.Hours = math.Round(estimate.Total/r.HourlyRate*2) / 2
+	}
+
+	if deadline := parseDeadline(req.Deadline); deadline != nil {
+		days := daysUntil(*deadline, now)
+		if days < r.RushDays && r.RushMultiplier > 1 {
+			estimate.Rush = true
+			add("rush", "Rush delivery ("+strconv.Itoa(days)+" days)", estimate.Total*(r.RushMultiplier-1))
+		}
+	}
+
+	if req.Priority == "urgent" {
+		add("urgent", "Urgent priority", r.UrgentFee)
+	}
+
+	estimate.Total = roundMoney(estimate.Total)
+	return estimate
+}
+
+func lookupPrice(prices map[string]float64, key string) (float64, bool) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	for k, v := range prices {
+		if strings.ToLower(k) == key {
+			return v, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// MODELS
+// ====================
+
+// PersonalData holds the contact fields that identify a client. It is used
+// both to describe what is stored and as the replacement values on erasure.
+type PersonalData struct {
+	Name    string
+	Email   string
+	Phone   string
+	Company string
+}
+
+// Titles that replace those of an erased client's orders and projects, which
+// lists and reports still show.
+const (
+	erasedOrderTitle   = "Erased order"
+	erasedProjectTitle = "Erased project"
+)
+
+type ClientDataExport struct {
+	ExportedAt   time.Time                `json:"exportedAt"`
+	Client       Client                   `json:"client"`
+	Orders       []map[string]interface{} `json:"orders"`
+	Projects     []map[string]interface{} `json:"projects"`
+	Invoices     []Invoice                `json:"invoices"`
+	Payments     []Payment                `json:"payments"`
+	Attachments  []Upload                 `json:"attachments"`
+	Deliverables []Deliverable            `json:"deliverables"`
+	Messages     []OrderMessage           `json:"messages"`
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type PrivacyService interface {
+	ExportClientData(clientID string) (*ClientDataExport, error)
+	EraseClient(clientID string) (*Client, error)
+}
+
+type privacyService struct {
+	db   *sql.DB
+	root string // upload directory
+}
+
+func NewPrivacyService(db *sql.DB, uploadDir string) PrivacyService {
+	return &privacyService{db: db, root: uploadDir}
+}
+
+func (s *privacyService) ExportClientData(clientID string) (*ClientDataExport, error) {
+	client, err := NewClientRepository(s.db).GetByID(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := NewOrderRepository(s.db).GetByEmail(client.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	projects, err := NewProjectRepository(s.db).GetByEmail(client.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &ClientDataExport{
+		ExportedAt:   time.Now(),
+		Client:       *client,
+		Orders:       []map[string]interface{}{},
+		Projects:     []map[string]interface{}{},
+		Invoices:     []Invoice{},
+		Payments:     []Payment{},
+		Attachments:  []Upload{},
+		Deliverables: []Deliverable{},
+		Messages:     []OrderMessage{},
+	}
+	for _, o := range orders {
+		export.Orders = append(export.Orders, orderToMap(o))
+
+		invoices, err := NewInvoiceRepository(s.db).GetAll(o.ID)
+		if err != nil {
+			return nil, err
+		}
+		export.Invoices = append(export.Invoices, invoices...)
+
+		payments, err := NewPaymentRepository(s.db).GetByOrder(o.ID)
+		if err != nil {
+			return nil, err
+		}
+		export.Payments = append(export.Payments, payments...)
+
+		attachments, err := NewUploadRepository(s.db).GetByOwner("order", o.ID)
+		if err != nil {
+			return nil, err
+		}
+		export.Attachments = append(export.Attachments, attachments...)
+
+		deliverables, err := NewDeliverableRepository(s.db).GetByOrder(o.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range deliverables {
+			if d.File, err = NewUploadRepository(s.db).GetByID(d.UploadID); err != nil {
+				return nil, err
+			}
+			export.Deliverables = append(export.Deliverables, d)
+		}
+
+		messages, err := NewMessageRepository(s.db).GetByOrder(o.ID)
+		if err != nil {
+			return nil, err
+		}
+		export.Messages = append(export.Messages, messages...)
+	}
+	for _, p := range projects {
+		export.Projects = append(export.Projects, projectToMap(p))
+	}
+
+	return export, nil
+}
+
+// EraseClient replaces the client's contact details on the client row and on
+// every order and project filed under their email, deletes the files and
+// messages of their orders, voids their tracking links and signs them out of
+// the portal. Order counts, totals, budgets and dates are kept so financial
+// reporting stays correct.
+func (s *privacyService) EraseClient(clientID string) (*Client, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	clientRepo := NewClientRepository(tx)
+	client, err := clientRepo.GetByID(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	pii := PersonalData{
+		Name:  "Erased Client",
+		Email: "erased-" + client.ID + "@erased.invalid",
+	}
+
+	orders, err := NewOrderRepository(tx).GetByEmail(client.Email)
+	if err != nil {
+		return nil, err
+	}
+	uploadRepo := NewUploadRepository(tx)
+	deliverableRepo := NewDeliverableRepository(tx)
+	var files []Upload
+	for _, o := range orders {
+		if err := NewMessageRepository(tx).DeleteByOrder(o.ID); err != nil {
+			return nil, err
+		}
+
+		deliverables, err := deliverableRepo.GetByOrder(o.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range deliverables {
+			if err := deliverableRepo.Delete(d.ID); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, ownerType := range []string{"order", "deliverable"} {
+			uploads, err := uploadRepo.GetByOwner(ownerType, o.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, u := range uploads {
+				if err := uploadRepo.Delete(u.ID); err != nil {
+					return nil, err
+				}
+			}
+			files = append(files, uploads...)
+		}
+	}
+
+	if err := NewOrderRepository(tx).AnonymizeByEmail(client.Email, pii); err != nil {
+		return nil, err
+	}
+	if err := NewProjectRepository(tx).AnonymizeByEmail(client.Email, pii); err != nil {
+		return nil, err
+	}
+	if err := clientRepo.Anonymize(client.ID, pii); err != nil {
+		return nil, err
+	}
+	if err := NewPortalRepository(tx).DeleteByClient(client.ID); err != nil {
+		return nil, err
+	}
+
+	erased, err := clientRepo.GetByID(client.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// Files go only once the erasure is committed
+	for i := range files {
+		removeUploadFiles(s.root, &files[i])
+	}
+
+	return erased, nil
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type PrivacyHandler struct {
+	service PrivacyService
+}
+
+func NewPrivacyHandler(service PrivacyService) *PrivacyHandler {
+	return &PrivacyHandler{service: service}
+}
+
+func (h *PrivacyHandler) ExportClient(c *gin.Context) {
+	id := c.Param("id")
+
+	export, err := h.service.ExportClientData(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Client not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if c.DefaultQuery("format", "json") != "zip" {
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Data:    export,
+		})
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="`+id+`-export.zip"`)
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"client.json", export.Client},
+		{"orders.json", export.Orders},
+		{"projects.json", export.Projects},
+		{"invoices.json", export.Invoices},
+		{"payments.json", export.Payments},
+		{"attachments.json", export.Attachments},
+		{"deliverables.json", export.Deliverables},
+		{"messages.json", export.Messages},
+	}
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.content); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		c.Error(err)
+	}
+}
+
+func (h *PrivacyHandler) EraseClient(c *gin.Context) {
+	id := c.Param("id")
+
+	client, err := h.service.EraseClient(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Client not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Client personal data erased",
+		Data:    client,
+	})
+}
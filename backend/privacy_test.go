@@ -0,0 +1,113 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEraseClient(t *testing.T) {
+	db := newTestDB(t)
+	clients := NewClientRepository(db)
+	client := &Client{
+		ID:            generateClientID(),
+		Name:          "Test Client",
+		Email:         "client@example.com",
+		Phone:         "+62 812 0000 0000",
+		Company:       "Test Company",
+		TotalOrders:   1,
+		TotalSpent:    1000,
+		LastOrderDate: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		CreatedAt:     time.Now(),
+	}
+	if err := clients.Create(client); err != nil {
+		t.Fatal(err)
+	}
+	order := newTestOrder(t, db, 1000)
+
+	projects := NewProjectRepository(db)
+	project := ProjectRequest{
+		ClientName:      "Test Client",
+		Email:           "client@example.com",
+		Phone:           "+62 812 0000 0000",
+		ProjectType:     "logo",
+		Services:        []string{"Logo Design"},
+		ProjectTitle:    "Bakery logo",
+		Description:     "A logo for our bakery",
+		Budget:          "500-1000",
+		ReferenceFiles:  "https://example.com/moodboard",
+		AdditionalNotes: "Call me after five",
+	}
+	projectID, err := projects.Create(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := project
+	other.ClientName = "Someone Else"
+	other.Email = "other@example.com"
+	otherID, err := projects.Create(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	erased, err := NewPrivacyService(db, t.TempDir()).EraseClient(client.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Contact details are replaced, the numbers are kept
+	if erased.Name != "Erased Client" || erased.Phone != "" || erased.Company != "" ||
+		!strings.HasSuffix(erased.Email, "@erased.invalid") {
+		t.Errorf("client = %q, %q, %q, %q; want erased contact details",
+			erased.Name, erased.Email, erased.Phone, erased.Company)
+	}
+	if erased.TotalOrders != 1 || erased.TotalSpent != 1000 || !erased.LastOrderDate.Equal(client.LastOrderDate) {
+		t.Errorf("client totals = %d, %v, %v; want them kept", erased.TotalOrders, erased.TotalSpent, erased.LastOrderDate)
+	}
+
+	o, err := NewOrderRepository(db).GetByID(order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wiped := map[string]string{
+		"email":            o.Email,
+		"phone":            o.Phone,
+		"company":          o.Company,
+		"description":      o.Description,
+		"additional notes": o.AdditionalNotes,
+		"tracking token":   o.TrackingToken,
+	}
+	for field, value := range wiped {
+		if value != "" && !strings.HasSuffix(value, "@erased.invalid") {
+			t.Errorf("order %s = %q, want it wiped", field, value)
+		}
+	}
+	if o.ClientName != "Erased Client" || o.ProjectTitle != erasedOrderTitle {
+		t.Errorf("order name and title = %q, %q", o.ClientName, o.ProjectTitle)
+	}
+	if o.FinalPrice != 1000 || o.Budget != "500-1000" || o.Services != "Logo Design" || o.Status != "pending" {
+		t.Errorf("order price, budget, services, status = %v, %q, %q, %q; want them kept",
+			o.FinalPrice, o.Budget, o.Services, o.Status)
+	}
+
+	p, err := projects.GetByID(int(projectID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ClientName != "Erased Client" || p.Phone != "" || p.ProjectTitle != erasedProjectTitle ||
+		p.Description != "" || p.ReferenceFiles != "" || p.AdditionalNotes != "" {
+		t.Errorf("project = %+v, want its contact details and free text wiped", p)
+	}
+	if p.Budget != "500-1000" || p.ProjectType != "logo" {
+		t.Errorf("project budget and type = %q, %q; want them kept", p.Budget, p.ProjectType)
+	}
+
+	// Other clients are left alone
+	p, err = projects.GetByID(int(otherID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ClientName != "Someone Else" || p.Email != "other@example.com" || p.Description != other.Description {
+		t.Errorf("another client's project changed: %+v", p)
+	}
+}
@@ -0,0 +1,811 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// MODELS
+// ====================
+
+// Quote is a priced offer for a pending order. The client answers through
+// the tokenized link mailed to them; accepting fixes the order's final price.
+type Quote struct {
+	ID            int         `json:"id" db:"id"`
+	OrderID       string      `json:"orderId" db:"order_id"`
+	Token         string      `json:"-" db:"token"` // only ever sent in the client's email
+	Status        string      `json:"status" db:"status"`
+	Currency      string      `json:"currency" db:"currency"`
+	Total         float64     `json:"total" db:"total"`
+	Notes         string      `json:"notes" db:"notes"`
+	ValidUntil    time.Time   `json:"validUntil" db:"valid_until"`
+	SentAt        *time.Time  `json:"sentAt" db:"sent_at"`
+	RespondedAt   *time.Time  `json:"respondedAt" db:"responded_at"`
+	DeclineReason string      `json:"declineReason" db:"decline_reason"`
+	CreatedAt     time.Time   `json:"createdAt" db:"created_at"`
+	UpdatedAt     time.Time   `json:"updatedAt" db:"updated_at"`
+	Items         []QuoteItem `json:"items"`
+}
+
+type QuoteItem struct {
+	ID          int     `json:"id" db:"id"`
+	QuoteID     int     `json:"quoteId" db:"quote_id"`
+	Description string  `json:"description" db:"description"`
+	Quantity    float64 `json:"quantity" db:"quantity"`
+	UnitPrice   float64 `json:"unitPrice" db:"unit_price"`
+	Amount      float64 `json:"amount" db:"amount"`
+}
+
+// PublicQuote is what the client sees behind the quote link.
+type PublicQuote struct {
+	ProjectTitle string      `json:"projectTitle"`
+	ClientName   string      `json:"clientName"`
+	Status       string      `json:"status"`
+	Currency     string      `json:"currency"`
+	Total        float64     `json:"total"`
+	Notes        string      `json:"notes"`
+	ValidUntil   time.Time   `json:"validUntil"`
+	Items        []QuoteItem `json:"items"`
+}
+
+// ====================
+// DTOs
+// ====================
+
+// QuoteRequest creates a draft quote. ValidUntil is a YYYY-MM-DD date and
+// defaults to defaultQuoteValidDays from today.
+type QuoteRequest struct {
+	ValidUntil string             `json:"validUntil"`
+	Notes      string             `json:"notes"`
+	Items      []QuoteItemRequest `json:"items"`
+}
+
+type QuoteItemRequest struct {
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	UnitPrice   float64 `json:"unitPrice"`
+}
+
+type QuoteDeclineRequest struct {
+	Reason string `json:"reason"`
+}
+
+const defaultQuoteValidDays = 30
+
+var (
+	ErrOrderNotPending        = errors.New("quotes can only be made for pending orders")
+	ErrInvalidQuoteItems      = errors.New("quote items need a description, a positive quantity and a non-negative price")
+	ErrInvalidValidUntil      = errors.New("validUntil must be today or later, formatted YYYY-MM-DD")
+	ErrInvalidQuoteTransition = errors.New("quote status change not allowed")
+	ErrQuoteExpired           = errors.New("quote has expired")
+)
+
+// expired reports whether the quote can no longer be answered. ValidUntil
+// is a date, so the quote stays open until the end of that day.
+func (q *Quote) expired(now time.Time) bool {
+	return now.After(q.ValidUntil.AddDate(0, 0, 1))
+}
+
+// ====================
+// REPOSITORIES
+// ====================
+
+type QuoteRepository interface {
+	Create(quote *Quote) error
+	GetByOrder(orderID string) ([]Quote, error)
+	GetByID(id int) (*Quote, error)
+	GetByToken(token string) (*Quote, error)
+	UpdateStatus(id int, status string) error
+	MarkSent(id int, at time.Time) error
+	// UnmarkSent puts a sent quote back to draft when its mail failed.
+	UnmarkSent(id int) error
+	MarkResponded(id int, status, reason string, at time.Time) error
+	SupersedeOthers(orderID string, keepID int) error
+}
+
+type quoteRepository struct {
+	db DBTX
+}
+
+func NewQuoteRepository(db DBTX) QuoteRepository {
+	return &quoteRepository{db: db}
+}
+
+func (r *quoteRepository) Create(quote *Quote) error {
+	result, err := r.db.Exec(`
+		INSERT INTO quotes (order_id, token, status, currency, total, notes, valid_until,
+		decline_reason, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, quote.OrderID, quote.Token, quote.Status, quote.Currency, quote.Total, quote.Notes,
+		quote.ValidUntil, quote.DeclineReason, quote.CreatedAt, quote.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	quote.ID = int(id)
+
+	for i := range quote.Items {
+		item := &quote.Items[i]
+		item.QuoteID = quote.ID
+		result, err := r.db.Exec(`
+			INSERT INTO quote_items (quote_id, description, quantity, unit_price, amount)
+			VALUES (?, ?, ?, ?, ?)
+		`, item.QuoteID, item.Description, item.Quantity, item.UnitPrice, item.Amount)
+		if err != nil {
+			return err
+		}
+		itemID, _ := result.LastInsertId()
+		item.ID = int(itemID)
+	}
+
+	return nil
+}
+
+const quoteColumns = `id, order_id, token, status, currency, total, notes, valid_until,
+	sent_at, responded_at, decline_reason, created_at, updated_at`
+
+func scanQuote(row rowScanner) (*Quote, error) {
+	var q Quote
+	var sentAt, respondedAt sql.NullTime
+
+	err := row.Scan(&q.ID, &q.OrderID, &q.Token, &q.Status, &q.Currency, &q.Total, &q.Notes,
+		&q.ValidUntil, &sentAt, &respondedAt, &q.DeclineReason, &q.CreatedAt, &q.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if sentAt.Valid {
+		q.SentAt = &sentAt.Time
+	}
+	if respondedAt.Valid {
+		q.RespondedAt = &respondedAt.Time
+	}
+
+	return &q, nil
+}
+
+func (r *quoteRepository) GetByOrder(orderID string) ([]Quote, error) {
+	rows, err := r.db.Query("SELECT "+quoteColumns+" FROM quotes WHERE order_id = ? ORDER BY id DESC", orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quotes := []Quote{}
+	for rows.Next() {
+		q, err := scanQuote(rows)
+		if err != nil {
+			return nil, err
+		}
+		quotes = append(quotes, *q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range quotes {
+		if quotes[i].Items, err = r.getItems(quotes[i].ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return quotes, nil
+}
+
+func (r *quoteRepository) GetByID(id int) (*Quote, error) {
+	return r.getOne("SELECT "+quoteColumns+" FROM quotes WHERE id = ?", id)
+}
+
+func (r *quoteRepository) GetByToken(token string) (*Quote, error) {
+	return r.getOne("SELECT "+quoteColumns+" FROM quotes WHERE token = ?", token)
+}
+
+func (r *quoteRepository) getOne(query string, arg interface{}) (*Quote, error) {
+	q, err := scanQuote(r.db.QueryRow(query, arg))
+	if err != nil {
+		return nil, err
+	}
+
+	q.Items, err = r.getItems(q.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+func (r *quoteRepository) getItems(quoteID int) ([]QuoteItem, error) {
+	rows, err := r.db.Query(`
+		SELECT id, quote_id, description, quantity, unit_price, amount
+		FROM quote_items WHERE quote_id = ? ORDER BY id
+	`, quoteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []QuoteItem{}
+	for rows.Next() {
+		var item QuoteItem
+		err := rows.Scan(&item.ID, &item.QuoteID, &item.Description, &item.Quantity,
+			&item.UnitPrice, &item.Amount)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+func (r *quoteRepository) UpdateStatus(id int, status string) error {
+	result, err := r.db.Exec("UPDATE quotes SET status = ?, updated_at = ? WHERE id = ?",
+		status, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *quoteRepository) MarkSent(id int, at time.Time) error {
+	_, err := r.db.Exec("UPDATE quotes SET status = 'sent', sent_at = ?, updated_at = ? WHERE id = ?",
+		at, at, id)
+	return err
+}
+
+func (r *quoteRepository) UnmarkSent(id int) error {
+	_, err := r.db.Exec(`
+		UPDATE quotes SET status = 'draft', sent_at = NULL, updated_at = ? WHERE id = ? AND status = 'sent'
+	`, time.Now(), id)
+	return err
+}
+
+func (r *quoteRepository) MarkResponded(id int, status, reason string, at time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE quotes SET status = ?, decline_reason = ?, responded_at = ?, updated_at = ?
+		WHERE id = ?
+	`, status, reason, at, at, id)
+	return err
+}
+
+// SupersedeOthers retires the order's other open quotes so only the latest
+// link can be accepted.
+func (r *quoteRepository) SupersedeOthers(orderID string, keepID int) error {
+	_, err := r.db.Exec(`
+		UPDATE quotes SET status = 'superseded', updated_at = ?
+		WHERE order_id = ? AND id != ? AND status IN ('draft', 'sent')
+	`, time.Now(), orderID, keepID)
+	return err
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type QuoteService interface {
+	CreateQuote(orderID string, req QuoteRequest) (*Quote, error)
+	GetQuotes(orderID string) ([]Quote, error)
+	GetQuote(id int) (*Quote, error)
+	SendQuote(id int) (*Quote, error)
+	GetPublicQuote(token string) (*PublicQuote, error)
+	AcceptQuote(token string) (*PublicQuote, error)
+	DeclineQuote(token, reason string) (*PublicQuote, error)
+}
+
+type quoteService struct {
+	db     *sql.DB
+	mailer Mailer
+}
+
+func NewQuoteService(db *sql.DB, mailer Mailer) QuoteService {
+	return &quoteService{db: db, mailer: mailer}
+}
+
+func (s *quoteService) CreateQuote(orderID string, req QuoteRequest) (*Quote, error) {
+	order, err := NewOrderRepository(s.db).GetByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != "pending" {
+		return nil, ErrOrderNotPending
+	}
+
+	now := time.Now()
+	validUntil := now.AddDate(0, 0, defaultQuoteValidDays)
+	if req.ValidUntil != "" {
+		validUntil, err = time.ParseInLocation("2006-01-02", req.ValidUntil, time.Local)
+		if err != nil {
+			return nil, ErrInvalidValidUntil
+		}
+	}
+	validUntil = time.Date(validUntil.Year(), validUntil.Month(), validUntil.Day(), 0, 0, 0, 0, time.Local)
+
+	quote := &Quote{
+		OrderID:    order.ID,
+		Status:     "draft",
+		Currency:   invoiceCurrency,
+		Notes:      req.Notes,
+		ValidUntil: validUntil,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if quote.expired(now) {
+		return nil, ErrInvalidValidUntil
+	}
+
+	if len(req.Items) == 0 {
+		return nil, ErrInvalidQuoteItems
+	}
+	for _, r := range req.Items {
+		if strings.TrimSpace(r.Description) == "" || r.Quantity <= 0 || r.UnitPrice < 0 {
+			return nil, ErrInvalidQuoteItems
+		}
+		unitPrice := roundMoney(r.UnitPrice)
+		item := QuoteItem{
+			Description: r.Description,
+			Quantity:    r.Quantity,
+			UnitPrice:   unitPrice,
+			Amount:      roundMoney(r.Quantity * unitPrice),
+		}
+		quote.Items = append(quote.Items, item)
+		quote.Total += item.Amount
+	}
+	quote.Total = roundMoney(quote.Total)
+
+	if quote.Token, err = generateToken(); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := NewQuoteRepository(tx).Create(quote); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return quote, nil
+}
+
+func (s *quoteService) GetQuotes(orderID string) ([]Quote, error) {
+	if _, err := NewOrderRepository(s.db).GetByID(orderID); err != nil {
+		return nil, err
+	}
+	return NewQuoteRepository(s.db).GetByOrder(orderID)
+}
+
+func (s *quoteService) GetQuote(id int) (*Quote, error) {
+	return NewQuoteRepository(s.db).GetByID(id)
+}
+
+// SendQuote mails the client their link and supersedes any earlier quote for
+// the order. The quote is marked sent before the mail goes out, so a slow
+// mail server never holds the write lock, and back to draft if it fails.
+func (s *quoteService) SendQuote(id int) (*Quote, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	repo := NewQuoteRepository(tx)
+	quote, err := repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if quote.Status != "draft" {
+		return nil, ErrInvalidQuoteTransition
+	}
+	now := time.Now()
+	if quote.expired(now) {
+		return nil, ErrQuoteExpired
+	}
+
+	order, err := NewOrderRepository(tx).GetByID(quote.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != "pending" {
+		return nil, ErrOrderNotPending
+	}
+
+	if err := repo.MarkSent(quote.ID, now); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if err := s.mailer.Send(quoteMail(quote, order)); err != nil {
+		if revertErr := NewQuoteRepository(s.db).UnmarkSent(quote.ID); revertErr != nil {
+			log.Printf("quotes: revert quote %d after failed mail: %v", quote.ID, revertErr)
+		}
+		return nil, err
+	}
+
+	// Earlier quotes stay open until the client actually has the new one
+	if err := NewQuoteRepository(s.db).SupersedeOthers(quote.OrderID, quote.ID); err != nil {
+		return nil, err
+	}
+
+	return s.GetQuote(id)
+}
+
+func quoteMail(quote *Quote, order *Order) Mail {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Hi %s,\n\n", order.ClientName)
+	fmt.Fprintf(&b, "Here is our quote for %q:\n\n", order.ProjectTitle)
+	for _, item := range quote.Items {
+		fmt.Fprintf(&b, "  %s x %s  %s\n", strconv.FormatFloat(item.Quantity, 'f', -1, 64),
+			item.Description, formatMoney(item.Amount, quote.Currency))
+	}
+	fmt.Fprintf(&b, "\nTotal: %s\n", formatMoney(quote.Total, quote.Currency))
+	if quote.Notes != "" {
+		fmt.Fprintf(&b, "\n%s\n", quote.Notes)
+	}
+	fmt.Fprintf(&b, "\nThe quote is valid until %s. You can accept or decline it here:\n%s\n\n",
+		quote.ValidUntil.Format("2 January 2006"), publicLink("/quote/"+quote.Token))
+	fmt.Fprintf(&b, "Thanks,\n%s\n", invoiceBrandName)
+
+	return Mail{
+		To:      order.Email,
+		Subject: fmt.Sprintf("Your quote from %s: %s", invoiceBrandName, order.ProjectTitle),
+		Body:    b.String(),
+	}
+}
+
+func (s *quoteService) GetPublicQuote(token string) (*PublicQuote, error) {
+	quote, err := NewQuoteRepository(s.db).GetByToken(token)
+	if err != nil {
+		return nil, err
+	}
+	return s.publicQuote(s.db, quote)
+}
+
+func (s *quoteService) publicQuote(db DBTX, quote *Quote) (*PublicQuote, error) {
+	order, err := NewOrderRepository(db).GetByID(quote.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := quote.Status
+	if status == "sent" && quote.expired(time.Now()) {
+		status = "expired"
+	}
+
+	return &PublicQuote{
+		ProjectTitle: order.ProjectTitle,
+		ClientName:   order.ClientName,
+		Status:       status,
+		Currency:     quote.Currency,
+		Total:        quote.Total,
+		Notes:        quote.Notes,
+		ValidUntil:   quote.ValidUntil,
+		Items:        quote.Items,
+	}, nil
+}
+
+// AcceptQuote fixes the order's final price at the quote total. Work starts
+// straight away unless a deposit is still owed, in which case the order stays
+// pending until the deposit is paid.
+func (s *quoteService) AcceptQuote(token string) (*PublicQuote, error) {
+	return s.respond(token, "accepted", "", func(orders OrderRepository, order *Order, quote *Quote) error {
+		if err := orders.SetFinalPrice(order.ID, quote.Total); err != nil {
+			return err
+		}
+		order.FinalPrice = quote.Total
+		if order.DepositRequired && !depositPaid(order) {
+			return nil
+		}
+		return orders.UpdateStatus(order.ID, "in-progress")
+	})
+}
+
+// DeclineQuote cancels the order; the studio can reopen it and quote again.
+func (s *quoteService) DeclineQuote(token, reason string) (*PublicQuote, error) {
+	return s.respond(token, "declined", reason, func(orders OrderRepository, order *Order, quote *Quote) error {
+		return orders.UpdateStatus(order.ID, "cancelled")
+	})
+}
+
+func (s *quoteService) respond(token, status, reason string,
+	apply func(orders OrderRepository, order *Order, quote *Quote) error) (*PublicQuote, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	repo := NewQuoteRepository(tx)
+	quote, err := repo.GetByToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if quote.Status != "sent" {
+		return nil, ErrInvalidQuoteTransition
+	}
+
+	now := time.Now()
+	if quote.expired(now) {
+		if err := repo.UpdateStatus(quote.ID, "expired"); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, ErrQuoteExpired
+	}
+
+	orders := NewOrderRepository(tx)
+	order, err := orders.GetByID(quote.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != "pending" {
+		return nil, ErrOrderNotPending
+	}
+
+	if err := repo.MarkResponded(quote.ID, status, reason, now); err != nil {
+		return nil, err
+	}
+	if err := apply(orders, order, quote); err != nil {
+		return nil, err
+	}
+	quote.Status = status
+
+	public, err := s.publicQuote(tx, quote)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return public, nil
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type QuoteHandler struct {
+	service QuoteService
+}
+
+func NewQuoteHandler(service QuoteService) *QuoteHandler {
+	return &QuoteHandler{service: service}
+}
+
+func (h *QuoteHandler) CreateQuote(c *gin.Context) {
+	var req QuoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	quote, err := h.service.CreateQuote(c.Param("id"), req)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Order not found",
+		})
+		return
+	}
+	if err == ErrInvalidValidUntil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err == ErrInvalidQuoteItems {
+		c.JSON(http.StatusUnprocessableEntity, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err == ErrOrderNotPending {
+		c.JSON(http.StatusConflict, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, APIResponse{
+		Success: true,
+		Message: "Quote created successfully",
+		Data:    quote,
+	})
+}
+
+func (h *QuoteHandler) GetQuotes(c *gin.Context) {
+	quotes, err := h.service.GetQuotes(c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Order not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    quotes,
+	})
+}
+
+func (h *QuoteHandler) GetQuote(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	quote, err := h.service.GetQuote(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Quote not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    quote,
+	})
+}
+
+func (h *QuoteHandler) SendQuote(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	quote, err := h.service.SendQuote(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Quote not found",
+		})
+		return
+	}
+	if err == ErrInvalidQuoteTransition || err == ErrOrderNotPending {
+		c.JSON(http.StatusConflict, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err == ErrQuoteExpired {
+		c.JSON(http.StatusGone, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Quote sent successfully",
+		Data:    quote,
+	})
+}
+
+func (h *QuoteHandler) GetPublicQuote(c *gin.Context) {
+	quote, err := h.service.GetPublicQuote(c.Param("token"))
+	h.respond(c, quote, err, "")
+}
+
+func (h *QuoteHandler) AcceptQuote(c *gin.Context) {
+	quote, err := h.service.AcceptQuote(c.Param("token"))
+	h.respond(c, quote, err, "Quote accepted")
+}
+
+func (h *QuoteHandler) DeclineQuote(c *gin.Context) {
+	var req QuoteDeclineRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+	}
+
+	quote, err := h.service.DeclineQuote(c.Param("token"), req.Reason)
+	h.respond(c, quote, err, "Quote declined")
+}
+
+// respond writes the result of a tokenized quote request. An unknown token
+// is reported as not found so tokens cannot be probed.
+func (h *QuoteHandler) respond(c *gin.Context, quote *PublicQuote, err error, message string) {
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Quote not found",
+		})
+		return
+	}
+	if err == ErrInvalidQuoteTransition || err == ErrOrderNotPending {
+		c.JSON(http.StatusConflict, APIResponse{
+			Success: false,
+			Message: "This quote can no longer be answered",
+		})
+		return
+	}
+	if err == ErrQuoteExpired {
+		c.JSON(http.StatusGone, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    quote,
+	})
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testMailer keeps what it sends, or fails with err.
+type testMailer struct {
+	sent []Mail
+	err  error
+}
+
+func (m *testMailer) Send(mail Mail) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, mail)
+	return nil
+}
+
+// sendTestQuote creates and sends a quote for two items totalling 500.
+func sendTestQuote(t *testing.T, s QuoteService, orderID string) *Quote {
+	t.Helper()
+	quote, err := s.CreateQuote(orderID, QuoteRequest{Items: []QuoteItemRequest{
+		{Description: "Logo concepts", Quantity: 2, UnitPrice: 150},
+		{Description: "Brand guide", Quantity: 1, UnitPrice: 200},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SendQuote(quote.ID); err != nil {
+		t.Fatal(err)
+	}
+	return quote
+}
+
+func TestQuoteResponses(t *testing.T) {
+	tests := []struct {
+		name            string
+		decline         bool
+		depositRequired bool
+		wantQuote       string
+		wantOrder       string
+		wantFinalPrice  float64
+	}{
+		{"accept", false, false, "accepted", "in-progress", 500},
+		{"accept with a deposit owed", false, true, "accepted", "pending", 500},
+		{"decline", true, false, "declined", "cancelled", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			order := newTestOrder(t, db, 0)
+			if _, err := db.Exec("UPDATE orders SET deposit_required = ? WHERE id = ?", tt.depositRequired, order.ID); err != nil {
+				t.Fatal(err)
+			}
+			mailer := &testMailer{}
+			s := NewQuoteService(db, mailer)
+			quote := sendTestQuote(t, s, order.ID)
+
+			if len(mailer.sent) != 1 || !strings.Contains(mailer.sent[0].Body, "/quote/"+quote.Token) {
+				t.Fatalf("mails = %+v, want one with the quote link", mailer.sent)
+			}
+			public, err := s.GetPublicQuote(quote.Token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if public.Status != "sent" || public.Total != 500 || len(public.Items) != 2 {
+				t.Errorf("public quote = %+v", public)
+			}
+
+			if tt.decline {
+				public, err = s.DeclineQuote(quote.Token, "Over our budget")
+			} else {
+				public, err = s.AcceptQuote(quote.Token)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if public.Status != tt.wantQuote {
+				t.Errorf("quote status = %q, want %q", public.Status, tt.wantQuote)
+			}
+			o, err := NewOrderRepository(db).GetByID(order.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if o.Status != tt.wantOrder || o.FinalPrice != tt.wantFinalPrice {
+				t.Errorf("order = %q at %v, want %q at %v", o.Status, o.FinalPrice, tt.wantOrder, tt.wantFinalPrice)
+			}
+			if tt.decline {
+				stored, err := s.GetQuote(quote.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if stored.DeclineReason != "Over our budget" || stored.RespondedAt == nil {
+					t.Errorf("declined quote = %q at %v", stored.DeclineReason, stored.RespondedAt)
+				}
+			}
+
+			// A quote is answered once
+			if _, err := s.AcceptQuote(quote.Token); err != ErrInvalidQuoteTransition {
+				t.Errorf("second answer: err = %v, want ErrInvalidQuoteTransition", err)
+			}
+		})
+	}
+}
+
+func TestQuoteTokenLookup(t *testing.T) {
+	db := newTestDB(t)
+	order := newTestOrder(t, db, 0)
+	s := NewQuoteService(db, &testMailer{})
+
+	if _, err := s.GetPublicQuote("no-such-token"); err != sql.ErrNoRows {
+		t.Errorf("unknown token: err = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := s.AcceptQuote("no-such-token"); err != sql.ErrNoRows {
+		t.Errorf("accepting an unknown token: err = %v, want sql.ErrNoRows", err)
+	}
+
+	draft, err := s.CreateQuote(order.ID, QuoteRequest{Items: []QuoteItemRequest{{Description: "Logo", Quantity: 1, UnitPrice: 100}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AcceptQuote(draft.Token); err != ErrInvalidQuoteTransition {
+		t.Errorf("accepting a draft: err = %v, want ErrInvalidQuoteTransition", err)
+	}
+
+	// Sending a newer quote retires the older link
+	first := sendTestQuote(t, s, order.ID)
+	second := sendTestQuote(t, s, order.ID)
+	if _, err := s.AcceptQuote(first.Token); err != ErrInvalidQuoteTransition {
+		t.Errorf("accepting a superseded quote: err = %v, want ErrInvalidQuoteTransition", err)
+	}
+
+	if _, err := db.Exec("UPDATE quotes SET valid_until = '2020-01-01 00:00:00+00:00' WHERE id = ?", second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AcceptQuote(second.Token); err != ErrQuoteExpired {
+		t.Errorf("accepting an expired quote: err = %v, want ErrQuoteExpired", err)
+	}
+	stored, err := s.GetQuote(second.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != "expired" {
+		t.Errorf("expired quote status = %q, want expired", stored.Status)
+	}
+}
+
+func TestSendQuoteMailFailure(t *testing.T) {
+	db := newTestDB(t)
+	order := newTestOrder(t, db, 0)
+	mailer := &testMailer{err: errors.New("smtp down")}
+	s := NewQuoteService(db, mailer)
+
+	quote, err := s.CreateQuote(order.ID, QuoteRequest{Items: []QuoteItemRequest{{Description: "Logo", Quantity: 1, UnitPrice: 100}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SendQuote(quote.ID); err != mailer.err {
+		t.Fatalf("err = %v, want the mail error", err)
+	}
+	stored, err := s.GetQuote(quote.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != "draft" || stored.SentAt != nil {
+		t.Errorf("quote = %q sent at %v, want it back to draft", stored.Status, stored.SentAt)
+	}
+}
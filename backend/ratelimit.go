@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// RATE LIMITS
+// ====================
+
+// RateLimit is a token bucket: PerMinute tokens drip in, up to Burst saved
+// up. A PerMinute of 0 turns the limit off.
+type RateLimit struct {
+	PerMinute float64 `yaml:"perMinute" toml:"perMinute"`
+	Burst     int     `yaml:"burst" toml:"burst"`
+}
+
+// RateLimits holds a limit per route group, set under rateLimits in the
+// config file. Every request counts against "default" by IP; the other
+// groups are attached to their routes in main and count by signed-in user
+// or portal client where there is one.
+type RateLimits map[string]RateLimit
+
+func defaultRateLimits() RateLimits {
+	return RateLimits{
+		"default": {PerMinute: 600, Burst: 200},
+		"staff":   {PerMinute: 300, Burst: 100},
+		"portal":  {PerMinute: 120, Burst: 40},
+		"public":  {PerMinute: 60, Burst: 30},
+		"login":   {PerMinute: 10, Burst: 5},
+	}
+}
+
+const rateLimitSweepInterval = 5 * time.Minute
+
+// ====================
+// LIMITER
+// ====================
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// bucketGroup holds the buckets of one route group. Buckets live in memory,
+// so they start full again when the server restarts.
+type bucketGroup struct {
+	mu      sync.Mutex
+	limit   RateLimit
+	buckets map[string]*tokenBucket
+}
+
+// rateDecision is what take found, for the RateLimit headers.
+type rateDecision struct {
+	allowed    bool
+	remaining  int
+	reset      time.Duration // until the bucket is full again
+	retryAfter time.Duration // until the next token, when not allowed
+}
+
+func (g *bucketGroup) take(key string, now time.Time) rateDecision {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	perSecond := g.limit.PerMinute / 60
+	b, ok := g.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(g.limit.Burst), last: now}
+		g.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(g.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+
+	d := rateDecision{allowed: b.tokens >= 1}
+	if d.allowed {
+		b.tokens--
+	} else {
+		d.retryAfter = secondsToDuration((1 - b.tokens) / perSecond)
+	}
+	d.remaining = int(b.tokens)
+	d.reset = secondsToDuration((float64(g.limit.Burst) - b.tokens) / perSecond)
+	return d
+}
+
+// sweep drops buckets that have filled up again; a fresh one is the same.
+func (g *bucketGroup) sweep(now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	perSecond := g.limit.PerMinute / 60
+	for key, b := range g.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*perSecond >= float64(g.limit.Burst) {
+			delete(g.buckets, key)
+		}
+	}
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
+
+// RateLimiter hands out a middleware per route group.
+type RateLimiter struct {
+	groups map[string]*bucketGroup
+}
+
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	groups := map[string]*bucketGroup{}
+	for name, limit := range limits {
+		if limit.PerMinute > 0 {
+			groups[name] = &bucketGroup{limit: limit, buckets: map[string]*tokenBucket{}}
+		}
+	}
+	return &RateLimiter{groups: groups}
+}
+
+// Limit returns the middleware for group; unknown or disabled groups let
+// everything through. Place it after RequireAuth or RequireClient to count
+// by user rather than by IP.
+func (l *RateLimiter) Limit(group string) gin.HandlerFunc {
+	g, ok := l.groups[group]
+	if !ok {
+		return func(c *gin.Context) { c.Next() }
+	}
+	policy := fmt.Sprintf("%d;w=%d", g.limit.Burst, int(math.Ceil(float64(g.limit.Burst)*60/g.limit.PerMinute)))
+
+	return func(c *gin.Context) {
+		d := g.take(rateLimitKey(c), time.Now())
+
+		c.Header("RateLimit-Policy", policy)
+		c.Header("RateLimit-Limit", strconv.Itoa(g.limit.Burst))
+		c.Header("RateLimit-Remaining", strconv.Itoa(d.remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.reset)))
+		if !d.allowed {
+			retry := ceilSeconds(d.retryAfter)
+			c.Header("Retry-After", strconv.Itoa(retry))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Too many requests, please retry in %d seconds", retry),
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Sweep runs as a background job so idle clients don't keep their buckets.
+func (l *RateLimiter) Sweep(now time.Time) error {
+	for _, g := range l.groups {
+		g.sweep(now)
+	}
+	return nil
+}
+
+func rateLimitKey(c *gin.Context) string {
+	if user := currentUser(c); user != nil {
+		return "user:" + user.ID
+	}
+	if client := currentClient(c); client != nil {
+		return "client:" + client.ID
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
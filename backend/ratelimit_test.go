@@ -0,0 +1,124 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketGroupTake(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	type step struct {
+		after     time.Duration // since start
+		allowed   bool
+		remaining int
+	}
+	tests := []struct {
+		name  string
+		limit RateLimit
+		steps []step
+	}{
+		{
+			name:  "burst then refused",
+			limit: RateLimit{PerMinute: 60, Burst: 3},
+			steps: []step{
+				{0, true, 2},
+				{0, true, 1},
+				{0, true, 0},
+				{0, false, 0},
+			},
+		},
+		{
+			name:  "refills one token a second",
+			limit: RateLimit{PerMinute: 60, Burst: 2},
+			steps: []step{
+				{0, true, 1},
+				{0, true, 0},
+				{500 * time.Millisecond, false, 0},
+				{time.Second, true, 0},
+				{time.Second, false, 0},
+			},
+		},
+		{
+			name:  "never refills past the burst",
+			limit: RateLimit{PerMinute: 60, Burst: 2},
+			steps: []step{
+				{0, true, 1},
+				{time.Hour, true, 1},
+				{time.Hour, true, 0},
+				{time.Hour, false, 0},
+			},
+		},
+		{
+			name:  "slow rate",
+			limit: RateLimit{PerMinute: 1, Burst: 1},
+			steps: []step{
+				{0, true, 0},
+				{30 * time.Second, false, 0},
+				{time.Minute, true, 0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &bucketGroup{limit: tt.limit, buckets: map[string]*tokenBucket{}}
+			for i, s := range tt.steps {
+				d := g.take("ip:1.2.3.4", start.Add(s.after))
+				if d.allowed != s.allowed || d.remaining != s.remaining {
+					t.Fatalf("step %d: allowed=%v remaining=%d, want allowed=%v remaining=%d",
+						i, d.allowed, d.remaining, s.allowed, s.remaining)
+				}
+			}
+		})
+	}
+}
+
+func TestBucketGroupTakeTimings(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	g := &bucketGroup{limit: RateLimit{PerMinute: 30, Burst: 2}, buckets: map[string]*tokenBucket{}}
+
+	g.take("a", now)
+	g.take("a", now)
+	d := g.take("a", now)
+	if d.allowed {
+		t.Fatal("third request in the same instant was allowed")
+	}
+	// 30 a minute is one token every 2s; the bucket holds 2
+	if d.retryAfter != 2*time.Second {
+		t.Errorf("retryAfter = %v, want 2s", d.retryAfter)
+	}
+	if d.reset != 4*time.Second {
+		t.Errorf("reset = %v, want 4s", d.reset)
+	}
+
+	// Keys don't share buckets
+	if d := g.take("b", now); !d.allowed || d.remaining != 1 {
+		t.Errorf("other key: allowed=%v remaining=%d, want a full bucket", d.allowed, d.remaining)
+	}
+}
+
+func TestBucketGroupSweep(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	g := &bucketGroup{limit: RateLimit{PerMinute: 60, Burst: 2}, buckets: map[string]*tokenBucket{}}
+	g.take("idle", now)
+	g.take("busy", now.Add(5*time.Second))
+	g.take("busy", now.Add(5*time.Second))
+
+	g.sweep(now.Add(5 * time.Second))
+	if _, ok := g.buckets["idle"]; ok {
+		t.Error("a bucket that has filled up again was kept")
+	}
+	if _, ok := g.buckets["busy"]; !ok {
+		t.Error("a bucket still short of tokens was dropped")
+	}
+}
+
+func TestRateLimiterDisabledGroups(t *testing.T) {
+	l := NewRateLimiter(RateLimits{"off": {PerMinute: 0, Burst: 5}, "on": {PerMinute: 10, Burst: 5}})
+	if _, ok := l.groups["off"]; ok {
+		t.Error("a limit of 0 per minute should turn the group off")
+	}
+	if _, ok := l.groups["on"]; !ok {
+		t.Error("an enabled group is missing")
+	}
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// MODELS
+// ====================
+
+// ReportRange limits a report to [From, To). Zero values are open ends.
+type ReportRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// RevenueMonth puts money received (payments by payment date) next to
+// revenue booked (final prices of orders by completion date).
+type RevenueMonth struct {
+	Month           string  `json:"month,omitempty"` // YYYY-MM
+	Received        float64 `json:"received"`
+	Refunded        float64 `json:"refunded"`
+	Net             float64 `json:"net"`
+	Booked          float64 `json:"booked"`
+	CompletedOrders int     `json:"completedOrders"`
+}
+
+type RevenueReport struct {
+	Months []RevenueMonth `json:"months"`
+	Totals RevenueMonth   `json:"totals"`
+}
+
+type BreakdownRow struct {
+	Key            string  `json:"key"`
+	Orders         int     `json:"orders"`
+	FinalPrice     float64 `json:"finalPrice"`
+	EstimatedPrice float64 `json:"estimatedPrice"`
+}
+
+type OrderBreakdown struct {
+	Total         int            `json:"total"`
+	ByStatus      []BreakdownRow `json:"byStatus"`
+	ByProjectType []BreakdownRow `json:"byProjectType"`
+	ByPriority    []BreakdownRow `json:"byPriority"`
+}
+
+type TurnaroundRow struct {
+	ProjectType     string  `json:"projectType,omitempty"`
+	CompletedOrders int     `json:"completedOrders"`
+	AverageDays     float64 `json:"averageDays"`
+	MinDays         float64 `json:"minDays"`
+	MaxDays         float64 `json:"maxDays"`
+}
+
+type TurnaroundReport struct {
+	TurnaroundRow
+	ByProjectType []TurnaroundRow `json:"byProjectType"`
+}
+
+// ConversionReport follows the orders created in the range. Rates are
+// percentages; CloseRate ignores orders that are still open.
+type ConversionReport struct {
+	Created        int     `json:"created"`
+	Completed      int     `json:"completed"`
+	Cancelled      int     `json:"cancelled"`
+	Open           int     `json:"open"`
+	ConversionRate float64 `json:"conversionRate"`
+	CloseRate      float64 `json:"closeRate"`
+}
+
+type TopClient struct {
+	Email       string    `json:"email"`
+	Name        string    `json:"name"`
+	Orders      int       `json:"orders"`
+	Completed   int       `json:"completed"`
+	Booked      float64   `json:"booked"`
+	Paid        float64   `json:"paid"`
+	LastOrderAt time.Time `json:"lastOrderAt"`
+}
+
+// topClientOrder maps the "by" parameter to a column of the top clients query.
+var topClientOrder = map[string]string{
+	"paid":   "paid",
+	"booked": "booked",
+	"orders": "orders",
+}
+
+const defaultTopClients = 10
+
+var (
+	ErrInvalidReportDate = errors.New("from and to must be dates in YYYY-MM-DD format")
+	ErrInvalidTopClients = errors.New("by must be paid, booked or orders and limit between 1 and 100")
+)
+
+// clause restricts column to the range, for appending to a WHERE clause.
+func (r ReportRange) clause(column string) (string, []interface{}) {
+	var cond string
+	var args []interface{}
+	if !r.From.IsZero() {
+		cond += " AND " + column + " >= ?"
+		args = append(args, r.From)
+	}
+	if !r.To.IsZero() {
+		cond += " AND " + column + " < ?"
+		args = append(args, r.To)
+	}
+	return cond, args
+}
+
+func percent(part, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return math.Round(float64(part)*1000/float64(whole)) / 10
+}
+
+func roundDays(days float64) float64 {
+	return math.Round(days*10) / 10
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type ReportService interface {
+	Revenue(r ReportRange) (*RevenueReport, error)
+	Orders(r ReportRange) (*OrderBreakdown, error)
+	Turnaround(r ReportRange) (*TurnaroundReport, error)
+	Conversion(r ReportRange) (*ConversionReport, error)
+	TopClients(r ReportRange, by string, limit int) ([]TopClient, error)
+}
+
+type reportService struct {
+	db *sql.DB
+}
+
+func NewReportService(db *sql.DB) ReportService {
+	return &reportService{db: db}
+}
+
+func (s *reportService) Revenue(r ReportRange) (*RevenueReport, error) {
+	months := map[string]*RevenueMonth{}
+	month := func(key string) *RevenueMonth {
+		if m, ok := months[key]; ok {
+			return m
+		}
+		months[key] = &RevenueMonth{Month: key}
+		return months[key]
+	}
+
+	where, args := r.clause("paid_at")
+	rows, err := s.db.Query(`
+		SELECT strftime('%Y-%m', paid_at) AS month,
+			COALESCE(SUM(CASE WHEN kind = 'refund' THEN 0 ELSE amount END), 0),
+			COALESCE(SUM(CASE WHEN kind = 'refund' THEN amount ELSE 0 END), 0)
+		FROM payments WHERE 1 = 1`+where+`
+		GROUP BY month`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var key string
+		var received, refunded float64
+		if err := rows.Scan(&key, &received, &refunded); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		m := month(key)
+		m.Received, m.Refunded = received, refunded
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	where, args = r.clause("completed_at")
+	rows, err = s.db.Query(`
+		SELECT strftime('%Y-%m', completed_at) AS month, COUNT(*), COALESCE(SUM(final_price), 0)
+		FROM orders WHERE status = 'completed' AND completed_at IS NOT NULL`+where+`
+		GROUP BY month`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var key string
+		var count int
+		var booked float64
+		if err := rows.Scan(&key, &count, &booked); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		m := month(key)
+		m.CompletedOrders, m.Booked = count, booked
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	report := &RevenueReport{Months: []RevenueMonth{}}
+	for _, m := range months {
+		m.Received = roundMoney(m.Received)
+		m.Refunded = roundMoney(m.Refunded)
+		m.Net = roundMoney(m.Received - m.Refunded)
+		m.Booked = roundMoney(m.Booked)
+		report.Months = append(report.Months, *m)
+
+		report.Totals.Received += m.Received
+		report.Totals.Refunded += m.Refunded
+		report.Totals.Booked += m.Booked
+		report.Totals.CompletedOrders += m.CompletedOrders
+	}
+	sort.Slice(report.Months, func(i, j int) bool { return report.Months[i].Month < report.Months[j].Month })
+	report.Totals.Received = roundMoney(report.Totals.Received)
+	report.Totals.Refunded = roundMoney(report.Totals.Refunded)
+	report.Totals.Net = roundMoney(report.Totals.Received - report.Totals.Refunded)
+	report.Totals.Booked = roundMoney(report.Totals.Booked)
+
+	return report, nil
+}
+
+func (s *reportService) Orders(r ReportRange) (*OrderBreakdown, error) {
+	report := &OrderBreakdown{}
+	where, args := r.clause("created_at")
+
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM orders WHERE status != 'quarantined'"+where, args...).Scan(&report.Total); err != nil {
+		return nil, err
+	}
+
+	breakdowns := []struct {
+		column string
+		into   *[]BreakdownRow
+	}{
+		{"status", &report.ByStatus},
+		{"project_type", &report.ByProjectType},
+		{"priority", &report.ByPriority},
+	}
+	for _, b := range breakdowns {
+		rows, err := s.db.Query(`
+			SELECT COALESCE(NULLIF(`+b.column+`, ''), 'unknown') AS key, COUNT(*),
+				COALESCE(SUM(final_price), 0), COALESCE(SUM(estimated_price), 0)
+			FROM orders WHERE status != 'quarantined'`+where+`
+			GROUP BY key ORDER BY COUNT(*) DESC, key`, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		result := []BreakdownRow{}
+		for rows.Next() {
+			var row BreakdownRow
+			if err := rows.Scan(&row.Key, &row.Orders, &row.FinalPrice, &row.EstimatedPrice); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			row.FinalPrice = roundMoney(row.FinalPrice)
+			row.EstimatedPrice = roundMoney(row.EstimatedPrice)
+			result = append(result, row)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		*b.into = result
+	}
+
+	return report, nil
+}
+
+// Turnaround measures creation to completion for orders completed in the
+// range.
+func (s *reportService) Turnaround(r ReportRange) (*TurnaroundReport, error) {
+	where, args := r.clause("completed_at")
+	const days = `julianday(completed_at) - julianday(created_at)`
+	rows, err := s.db.Query(`
+		SELECT COALESCE(NULLIF(project_type, ''), 'unknown') AS type, COUNT(*),
+			AVG(`+days+`), MIN(`+days+`), MAX(`+days+`)
+		FROM orders WHERE status = 'completed' AND completed_at IS NOT NULL`+where+`
+		GROUP BY type ORDER BY COUNT(*) DESC, type`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &TurnaroundReport{ByProjectType: []TurnaroundRow{}}
+	var totalDays float64
+	for rows.Next() {
+		var row TurnaroundRow
+		if err := rows.Scan(&row.ProjectType, &row.CompletedOrders, &row.AverageDays, &row.MinDays, &row.MaxDays); err != nil {
+			return nil, err
+		}
+
+		if report.CompletedOrders == 0 || row.MinDays < report.MinDays {
+			report.MinDays = row.MinDays
+		}
+		if row.MaxDays > report.MaxDays {
+			report.MaxDays = row.MaxDays
+		}
+		report.CompletedOrders += row.CompletedOrders
+		totalDays += row.AverageDays * float64(row.CompletedOrders)
+
+		row.AverageDays = roundDays(row.AverageDays)
+		row.MinDays = roundDays(row.MinDays)
+		row.MaxDays = roundDays(row.MaxDays)
+		report.ByProjectType = append(report.ByProjectType, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if report.CompletedOrders > 0 {
+		report.AverageDays = roundDays(totalDays / float64(report.CompletedOrders))
+	}
+	report.MinDays = roundDays(report.MinDays)
+	report.MaxDays = roundDays(report.MaxDays)
+
+	return report, nil
+}
+
+func (s *reportService) Conversion(r ReportRange) (*ConversionReport, error) {
+	where, args := r.clause("created_at")
+	var report ConversionReport
+	err := s.db.QueryRow(`
+		SELECT COUNT(*),
+			COALESCE(SUM(status = 'completed'), 0),
+			COALESCE(SUM(status = 'cancelled'), 0),
+			COALESCE(SUM(status IN ('pending', 'in-progress', 'on-hold')), 0)
+		FROM orders WHERE status != 'quarantined'`+where, args...).
+		Scan(&report.Created, &report.Completed, &report.Cancelled, &report.Open)
+	if err != nil {
+		return nil, err
+	}
+
+	report.ConversionRate = percent(report.Completed, report.Created)
+	report.CloseRate = percent(report.Completed, report.Completed+report.Cancelled)
+
+	return &report, nil
+}
+
+// TopClients ranks clients, by email, over the orders they placed in the
+// range. Booked counts final prices of completed orders; paid is net of
+// refunds.
+func (s *reportService) TopClients(r ReportRange, by string, limit int) ([]TopClient, error) {
+	column, ok := topClientOrder[by]
+	if !ok || limit < 1 || limit > 100 {
+		return nil, ErrInvalidTopClients
+	}
+
+	where, args := r.clause("created_at")
+	rows, err := s.db.Query(`
+		SELECT email, MAX(client_name), COUNT(*) AS orders,
+			COALESCE(SUM(status = 'completed'), 0),
+			COALESCE(SUM(CASE WHEN status = 'completed' THEN final_price ELSE 0 END), 0) AS booked,
+			COALESCE(SUM(`+netPaidSQL+`), 0) AS paid,
+			MAX(created_at)
+		FROM orders WHERE email != '' AND status != 'quarantined'`+where+`
+		GROUP BY email ORDER BY `+column+` DESC, orders DESC, email
+		LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []TopClient{}
+	for rows.Next() {
+		var c TopClient
+		var lastOrderAt string
+		if err := rows.Scan(&c.Email, &c.Name, &c.Orders, &c.Completed, &c.Booked, &c.Paid, &lastOrderAt); err != nil {
+			return nil, err
+		}
+		// MAX() hands back the stored text rather than a DATETIME
+		c.LastOrderAt, _ = time.Parse("2006-01-02 15:04:05.999999999-07:00", lastOrderAt)
+		c.Booked = roundMoney(c.Booked)
+		c.Paid = roundMoney(c.Paid)
+		clients = append(clients, c)
+	}
+
+	return clients, rows.Err()
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type ReportHandler struct {
+	service ReportService
+}
+
+func NewReportHandler(service ReportService) *ReportHandler {
+	return &ReportHandler{service: service}
+}
+
+// reportRangeFromQuery reads the inclusive from and to dates (YYYY-MM-DD)
+// every report accepts. Unlike the order list, bad dates are rejected so a
+// typo cannot silently widen a report.
+func reportRangeFromQuery(c *gin.Context) (ReportRange, error) {
+	var r ReportRange
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return r, ErrInvalidReportDate
+		}
+		r.From = t
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return r, ErrInvalidReportDate
+		}
+		r.To = t.AddDate(0, 0, 1)
+	}
+	return r, nil
+}
+
+func (h *ReportHandler) Revenue(c *gin.Context) {
+	h.run(c, func(r ReportRange) (interface{}, error) { return h.service.Revenue(r) })
+}
+
+func (h *ReportHandler) Orders(c *gin.Context) {
+	h.run(c, func(r ReportRange) (interface{}, error) { return h.service.Orders(r) })
+}
+
+func (h *ReportHandler) Turnaround(c *gin.Context) {
+	h.run(c, func(r ReportRange) (interface{}, error) { return h.service.Turnaround(r) })
+}
+
+func (h *ReportHandler) Conversion(c *gin.Context) {
+	h.run(c, func(r ReportRange) (interface{}, error) { return h.service.Conversion(r) })
+}
+
+func (h *ReportHandler) TopClients(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultTopClients)))
+	if err != nil {
+		limit = 0
+	}
+	by := c.DefaultQuery("by", "paid")
+
+	h.run(c, func(r ReportRange) (interface{}, error) { return h.service.TopClients(r, by, limit) })
+}
+
+func (h *ReportHandler) run(c *gin.Context, report func(r ReportRange) (interface{}, error)) {
+	r, err := reportRangeFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	data, err := report(r)
+	if err == ErrInvalidTopClients {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    data,
+	})
+}
@@ -0,0 +1,573 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// MODELS
+// ====================
+
+// orderQuarantined holds suspicious submissions from the public order form
+// until someone approves or discards them. Quarantined orders are left out
+// of order listings, reports and client records.
+const orderQuarantined = "quarantined"
+
+// QuarantinedOrder is a held order along with why it was held.
+type QuarantinedOrder struct {
+	Order         map[string]interface{} `json:"order"`
+	Reason        string                 `json:"reason"`
+	IP            string                 `json:"ip"`
+	QuarantinedAt time.Time              `json:"quarantinedAt"`
+}
+
+// SubmissionVerdict is what the guard decided about a submission that was
+// not rejected outright. Dropped submissions get a normal-looking response
+// but are never stored.
+type SubmissionVerdict struct {
+	Drop       bool
+	Quarantine string // the reason, empty when the order goes straight in
+}
+
+// SubmissionLimits caps how many orders one IP address or email address can
+// submit within Window. Over the IP limit is rejected; over the email limit
+// is quarantined, since it may be a real client resubmitting.
+type SubmissionLimits struct {
+	PerIP    int      `yaml:"perIp" toml:"perIp" env:"ORDER_LIMIT_PER_IP"`
+	PerEmail int      `yaml:"perEmail" toml:"perEmail" env:"ORDER_LIMIT_PER_EMAIL"`
+	Window   Duration `yaml:"window" toml:"window" env:"ORDER_LIMIT_WINDOW"`
+}
+
+const (
+	maxLinksPerOrder         = 3
+	submissionSweepInterval  = 10 * time.Minute
+	captchaVerifyTimeout     = 10 * time.Second
+	defaultFakeCaptchaAnswer = "pass"
+)
+
+var (
+	ErrTooManySubmissions = errors.New("too many orders submitted, please try again later")
+	ErrCaptchaFailed      = errors.New("captcha verification failed")
+	ErrNotQuarantined     = errors.New("order is not quarantined")
+	ErrOrderQuarantined   = errors.New("order is quarantined; approve or discard it first")
+)
+
+func defaultSubmissionLimits() SubmissionLimits {
+	return SubmissionLimits{PerIP: 5, PerEmail: 3, Window: Duration(time.Hour)}
+}
+
+// ====================
+// CAPTCHA
+// ====================
+
+// CaptchaVerifier checks the token the order form got from the captcha
+// widget. A token the provider rejects is ErrCaptchaFailed; any other error
+// means the provider could not be asked.
+type CaptchaVerifier interface {
+	Verify(token, remoteIP string) error
+}
+
+// captchaVerifyURLs are providers that share the reCAPTCHA siteverify API.
+var captchaVerifyURLs = map[string]string{
+	"recaptcha": "https://www.google.com/recaptcha/api/siteverify",
+	"hcaptcha":  "https://api.hcaptcha.com/siteverify",
+	"turnstile": "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// newCaptchaVerifier returns nil, turning captcha checks off, when no
+// provider is configured.
+func newCaptchaVerifier(cfg CaptchaConfig) CaptchaVerifier {
+	switch cfg.Provider {
+	case "":
+		return nil
+	case "fake":
+		return NewFakeCaptchaVerifier(cfg.FakeToken)
+	}
+
+	verifyURL := captchaVerifyURLs[cfg.Provider]
+	if cfg.VerifyURL != "" {
+		verifyURL = cfg.VerifyURL
+	}
+	return NewSiteVerifyCaptcha(cfg.Provider, verifyURL, cfg.Secret)
+}
+
+type siteVerifyCaptcha struct {
+	provider  string
+	verifyURL string
+	secret    string
+	client    *http.Client
+}
+
+func NewSiteVerifyCaptcha(provider, verifyURL, secret string) CaptchaVerifier {
+	return &siteVerifyCaptcha{
+		provider:  provider,
+		verifyURL: verifyURL,
+		secret:    secret,
+		client:    &http.Client{Timeout: captchaVerifyTimeout},
+	}
+}
+
+func (v *siteVerifyCaptcha) Verify(token, remoteIP string) error {
+	if strings.TrimSpace(token) == "" {
+		return ErrCaptchaFailed
+	}
+
+	form := url.Values{}
+	form.Set("secret", v.secret)
+	form.Set("response", token)
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	resp, err := v.client.PostForm(v.verifyURL, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: %s", v.provider, resp.Status)
+	}
+	if !body.Success {
+		return ErrCaptchaFailed
+	}
+	return nil
+}
+
+// fakeCaptchaVerifier never leaves the process; it accepts one fixed answer.
+type fakeCaptchaVerifier struct {
+	answer string
+}
+
+func NewFakeCaptchaVerifier(answer string) CaptchaVerifier {
+	if answer == "" {
+		answer = defaultFakeCaptchaAnswer
+	}
+	return &fakeCaptchaVerifier{answer: answer}
+}
+
+func (v *fakeCaptchaVerifier) Verify(token, remoteIP string) error {
+	if token != v.answer {
+		return ErrCaptchaFailed
+	}
+	return nil
+}
+
+// ====================
+// SUBMISSION GUARD
+// ====================
+
+// submissionWindow counts hits per key over a sliding window. It lives in
+// memory, so limits reset when the server restarts.
+type submissionWindow struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	hits   map[string][]time.Time
+}
+
+func newSubmissionWindow(limit int, window time.Duration) *submissionWindow {
+	return &submissionWindow{limit: limit, window: window, hits: map[string][]time.Time{}}
+}
+
+// Hit records an attempt for key and reports whether it is within the
+// limit. Attempts over the limit still count, so a client that keeps
+// hammering stays blocked.
+func (w *submissionWindow) Hit(key string, now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	recent := w.recent(key, now)
+	recent = append(recent, now)
+	w.hits[key] = recent
+	return len(recent) <= w.limit
+}
+
+func (w *submissionWindow) recent(key string, now time.Time) []time.Time {
+	hits := w.hits[key]
+	cutoff := now.Add(-w.window)
+	i := 0
+	for i < len(hits) && !hits[i].After(cutoff) {
+		i++
+	}
+	return hits[i:]
+}
+
+// Sweep forgets keys with no hits inside the window.
+func (w *submissionWindow) Sweep(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for key := range w.hits {
+		if recent := w.recent(key, now); len(recent) == 0 {
+			delete(w.hits, key)
+		} else {
+			w.hits[key] = recent
+		}
+	}
+}
+
+// SubmissionGuard screens submissions to the public order form before they
+// become orders.
+type SubmissionGuard struct {
+	captcha  CaptchaVerifier // nil turns captcha checks off
+	perIP    *submissionWindow
+	perEmail *submissionWindow
+}
+
+func NewSubmissionGuard(captcha CaptchaVerifier, limits SubmissionLimits) *SubmissionGuard {
+	return &SubmissionGuard{
+		captcha:  captcha,
+		perIP:    newSubmissionWindow(limits.PerIP, time.Duration(limits.Window)),
+		perEmail: newSubmissionWindow(limits.PerEmail, time.Duration(limits.Window)),
+	}
+}
+
+// Check runs the honeypot, the rate limits and the captcha, in that order.
+// It returns ErrTooManySubmissions or ErrCaptchaFailed for submissions to
+// reject.
+func (g *SubmissionGuard) Check(req OrderRequest, ip string, now time.Time) (SubmissionVerdict, error) {
+	if drop, err := g.admit(req, ip, now); drop || err != nil {
+		return SubmissionVerdict{Drop: drop}, err
+	}
+
+	hold, err := g.VerifyCaptcha(req.CaptchaToken, ip)
+	if err != nil {
+		return SubmissionVerdict{}, err
+	}
+	return g.screen(req, now, hold), nil
+}
+
+// CheckSynced is Check for one order of a synced batch, whose captcha was
+// checked once for the whole batch; hold is what VerifyCaptcha returned.
+func (g *SubmissionGuard) CheckSynced(req OrderRequest, ip string, now time.Time, hold string) (SubmissionVerdict, error) {
+	if drop, err := g.admit(req, ip, now); drop || err != nil {
+		return SubmissionVerdict{Drop: drop}, err
+	}
+	return g.screen(req, now, hold), nil
+}
+
+// VerifyCaptcha returns ErrCaptchaFailed for a rejected token, and a
+// quarantine reason when the provider could not be asked: rather than lose
+// the order while it is down, the order is held.
+func (g *SubmissionGuard) VerifyCaptcha(token, ip string) (string, error) {
+	if g.captcha == nil {
+		return "", nil
+	}
+
+	err := g.captcha.Verify(token, ip)
+	if err == ErrCaptchaFailed {
+		return "", err
+	}
+	if err != nil {
+		log.Printf("spam: captcha check for %s: %v", ip, err)
+		return "captcha could not be verified", nil
+	}
+	return "", nil
+}
+
+func (g *SubmissionGuard) admit(req OrderRequest, ip string, now time.Time) (drop bool, err error) {
+	// People never see the honeypot field, so anything in it is a bot
+	if strings.TrimSpace(req.Website) != "" {
+		return true, nil
+	}
+	if !g.perIP.Hit(ip, now) {
+		return false, ErrTooManySubmissions
+	}
+	return false, nil
+}
+
+func (g *SubmissionGuard) screen(req OrderRequest, now time.Time, hold string) SubmissionVerdict {
+	verdict := SubmissionVerdict{Quarantine: hold}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if email != "" && !g.perEmail.Hit(email, now) && verdict.Quarantine == "" {
+		verdict.Quarantine = "too many orders from " + email
+	}
+	if n := countLinks(req.ProjectTitle, req.Description, req.AdditionalNotes); n > maxLinksPerOrder &&
+		verdict.Quarantine == "" {
+		verdict.Quarantine = fmt.Sprintf("contains %d links", n)
+	}
+
+	return verdict
+}
+
+// Sweep runs as a background job so the windows don't keep every IP that
+// ever submitted.
+func (g *SubmissionGuard) Sweep(now time.Time) error {
+	g.perIP.Sweep(now)
+	g.perEmail.Sweep(now)
+	return nil
+}
+
+func countLinks(fields ...string) int {
+	n := 0
+	for _, f := range fields {
+		f = strings.ToLower(f)
+		n += strings.Count(f, "http://") + strings.Count(f, "https://")
+	}
+	return n
+}
+
+// ====================
+// REPOSITORIES
+// ====================
+
+type quarantineEntry struct {
+	Reason string
+	IP     string
+	At     time.Time
+}
+
+type QuarantineRepository interface {
+	Create(orderID, reason, ip string, at time.Time) error
+	GetAll() (map[string]quarantineEntry, error)
+	Delete(orderID string) error
+}
+
+type quarantineRepository struct {
+	db DBTX
+}
+
+func NewQuarantineRepository(db DBTX) QuarantineRepository {
+	return &quarantineRepository{db: db}
+}
+
+func (r *quarantineRepository) Create(orderID, reason, ip string, at time.Time) error {
+	_, err := r.db.Exec("INSERT INTO order_quarantine (order_id, reason, ip, created_at) VALUES (?, ?, ?, ?)",
+		orderID, reason, ip, at)
+	return err
+}
+
+func (r *quarantineRepository) GetAll() (map[string]quarantineEntry, error) {
+	rows, err := r.db.Query("SELECT order_id, reason, ip, created_at FROM order_quarantine")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := map[string]quarantineEntry{}
+	for rows.Next() {
+		var id string
+		var e quarantineEntry
+		if err := rows.Scan(&id, &e.Reason, &e.IP, &e.At); err != nil {
+			return nil, err
+		}
+		entries[id] = e
+	}
+
+	return entries, rows.Err()
+}
+
+func (r *quarantineRepository) Delete(orderID string) error {
+	_, err := r.db.Exec("DELETE FROM order_quarantine WHERE order_id = ?", orderID)
+	return err
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type QuarantineService interface {
+	// Quarantine records why an order created as quarantined was held.
+	Quarantine(orderID, reason, ip string) error
+	GetQuarantined() ([]QuarantinedOrder, error)
+	// Approve releases the order as pending and files it under its client.
+	Approve(orderID string) (map[string]interface{}, error)
+	// Discard deletes the order and everything attached to it.
+	Discard(orderID string) error
+}
+
+type quarantineService struct {
+	db *sql.DB
+}
+
+func NewQuarantineService(db *sql.DB) QuarantineService {
+	return &quarantineService{db: db}
+}
+
+func (s *quarantineService) Quarantine(orderID, reason, ip string) error {
+	return NewQuarantineRepository(s.db).Create(orderID, reason, ip, time.Now())
+}
+
+func (s *quarantineService) GetQuarantined() ([]QuarantinedOrder, error) {
+	entries, err := NewQuarantineRepository(s.db).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	// Go by order status, so an order whose entry failed to save still
+	// shows up for review
+	held := []QuarantinedOrder{}
+	err = NewOrderRepository(s.db).Each(OrderFilter{Status: orderQuarantined}, func(o Order) error {
+		entry, ok := entries[o.ID]
+		if !ok {
+			entry = quarantineEntry{At: o.CreatedAt}
+		}
+		held = append(held, QuarantinedOrder{
+			Order:         orderToMap(o),
+			Reason:        entry.Reason,
+			IP:            entry.IP,
+			QuarantinedAt: entry.At,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return held, nil
+}
+
+func (s *quarantineService) Approve(orderID string) (map[string]interface{}, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	orders := &orderService{
+		orderRepo:  NewOrderRepository(tx),
+		clientRepo: NewClientRepository(tx),
+	}
+	order, err := quarantinedOrder(orders.orderRepo, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := orders.orderRepo.UpdateStatus(order.ID, "pending"); err != nil {
+		return nil, err
+	}
+	order.Status = "pending"
+	if err := orders.orderRepo.SetDeadlineStatus(order.ID, deadlineState(order, now)); err != nil {
+		return nil, err
+	}
+	if err := NewQuarantineRepository(tx).Delete(order.ID); err != nil {
+		return nil, err
+	}
+	if err := orders.updateClientRecord(order.Email, order.ClientName, order.Phone, order.Company, order.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	approved, err := orders.orderRepo.GetByID(order.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return orderToMap(*approved), nil
+}
+
+func (s *quarantineService) Discard(orderID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	repo := NewOrderRepository(tx)
+	if _, err := quarantinedOrder(repo, orderID); err != nil {
+		return err
+	}
+	if err := repo.Delete(orderID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func quarantinedOrder(repo OrderRepository, id string) (*Order, error) {
+	order, err := repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != orderQuarantined {
+		return nil, ErrNotQuarantined
+	}
+	return order, nil
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type QuarantineHandler struct {
+	service QuarantineService
+}
+
+func NewQuarantineHandler(service QuarantineService) *QuarantineHandler {
+	return &QuarantineHandler{service: service}
+}
+
+func (h *QuarantineHandler) GetQuarantined(c *gin.Context) {
+	held, err := h.service.GetQuarantined()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    held,
+	})
+}
+
+func (h *QuarantineHandler) Approve(c *gin.Context) {
+	order, err := h.service.Approve(c.Param("id"))
+	h.respond(c, "Order approved", order, err)
+}
+
+func (h *QuarantineHandler) Discard(c *gin.Context) {
+	err := h.service.Discard(c.Param("id"))
+	h.respond(c, "Order discarded", nil, err)
+}
+
+func (h *QuarantineHandler) respond(c *gin.Context, message string, data interface{}, err error) {
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Order not found",
+		})
+		return
+	}
+	if err == ErrNotQuarantined {
+		c.JSON(http.StatusConflict, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    data,
+	})
+}
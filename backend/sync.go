@@ -0,0 +1,325 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// MODELS
+// ====================
+
+// SyncOrder is an order the frontend saved to localStorage while the API
+// was down, with the ID and creation time it was given there.
+type SyncOrder struct {
+	LocalID   string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	OrderRequest
+}
+
+type SyncRequest struct {
+	Orders       []SyncOrder `json:"orders"`
+	CaptchaToken string      `json:"captchaToken"` // checked once for the batch
+}
+
+// SyncMapping tells the frontend which server order a local one became.
+// Result is "created", "existing" or "failed".
+type SyncMapping struct {
+	LocalID string `json:"localId"`
+	ID      string `json:"id,omitempty"`
+	Result  string `json:"result"`
+	Error   string `json:"error,omitempty"`
+}
+
+type SyncReport struct {
+	Created  int           `json:"created"`
+	Existing int           `json:"existing"`
+	Failed   int           `json:"failed"`
+	Orders   []SyncMapping `json:"orders"`
+}
+
+const (
+	maxSyncBatch = 50
+
+	// An order with the same email and title created this close to the
+	// local one is taken to be the same order: the API call that seemed to
+	// fail had gone through
+	syncMatchWindow = 10 * time.Minute
+
+	// The creation time comes from the client, so it is only believed this
+	// far back: long enough for a queue kept through an outage, too short
+	// to matter to reports
+	syncMaxAge = 72 * time.Hour
+)
+
+var ErrSyncBatchTooLarge = errors.New("at most 50 orders can be synced at once")
+
+// ====================
+// REPOSITORIES
+// ====================
+
+// OrderSyncRepository remembers which server order each synced local order
+// became, so syncing the same batch twice creates nothing new.
+type OrderSyncRepository interface {
+	GetOrderID(localID, email string) (string, error)
+	// FindMatch looks for an order the same client placed around createdAt.
+	FindMatch(email, projectTitle string, createdAt time.Time) (string, error)
+	Record(localID, email, orderID string, at time.Time) error
+}
+
+type orderSyncRepository struct {
+	db DBTX
+}
+
+func NewOrderSyncRepository(db DBTX) OrderSyncRepository {
+	return &orderSyncRepository{db: db}
+}
+
+func (r *orderSyncRepository) GetOrderID(localID, email string) (string, error) {
+	var orderID string
+	err := r.db.QueryRow(`
+		SELECT s.order_id FROM order_sync_ids s JOIN orders o ON o.id = s.order_id
+		WHERE s.local_id = ? AND s.email = ?
+	`, localID, email).Scan(&orderID)
+	return orderID, err
+}
+
+func (r *orderSyncRepository) FindMatch(email, projectTitle string, createdAt time.Time) (string, error) {
+	var orderID string
+	err := r.db.QueryRow(`
+		SELECT id FROM orders
+		WHERE email = ? AND project_title = ? AND created_at BETWEEN ? AND ?
+		ORDER BY created_at LIMIT 1
+	`, email, projectTitle, createdAt.Add(-syncMatchWindow), createdAt.Add(syncMatchWindow)).Scan(&orderID)
+	return orderID, err
+}
+
+func (r *orderSyncRepository) Record(localID, email, orderID string, at time.Time) error {
+	_, err := r.db.Exec(`
+		INSERT OR REPLACE INTO order_sync_ids (local_id, email, order_id, synced_at) VALUES (?, ?, ?, ?)
+	`, localID, email, orderID, at)
+	return err
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type SyncService interface {
+	// SyncOrders creates the local orders the server doesn't have yet and
+	// maps every local ID to its server order. The batch fails as a whole
+	// only for a bad captcha or an oversized batch.
+	SyncOrders(req SyncRequest, ip string) (*SyncReport, error)
+}
+
+type syncService struct {
+	db      *sql.DB
+	pricing *PricingEngine
+	guard   *SubmissionGuard
+}
+
+func NewSyncService(db *sql.DB, pricing *PricingEngine, guard *SubmissionGuard) SyncService {
+	return &syncService{db: db, pricing: pricing, guard: guard}
+}
+
+func (s *syncService) SyncOrders(req SyncRequest, ip string) (*SyncReport, error) {
+	if len(req.Orders) > maxSyncBatch {
+		return nil, ErrSyncBatchTooLarge
+	}
+	hold, err := s.guard.VerifyCaptcha(req.CaptchaToken, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	report := &SyncReport{Orders: []SyncMapping{}}
+	for _, order := range req.Orders {
+		// As with imports, a savepoint per order keeps a half-written one
+		// out of the batch
+		if _, err := tx.Exec("SAVEPOINT sync_order"); err != nil {
+			return nil, err
+		}
+
+		mapping, err := s.syncOrder(tx, order, ip, hold)
+		if err != nil {
+			if _, rbErr := tx.Exec("ROLLBACK TO sync_order"); rbErr != nil {
+				return nil, rbErr
+			}
+			mapping = SyncMapping{LocalID: order.LocalID, Result: "failed", Error: err.Error()}
+		}
+		if _, err := tx.Exec("RELEASE sync_order"); err != nil {
+			return nil, err
+		}
+
+		switch mapping.Result {
+		case "created":
+			report.Created++
+		case "existing":
+			report.Existing++
+		default:
+			report.Failed++
+		}
+		report.Orders = append(report.Orders, mapping)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (s *syncService) syncOrder(tx *sql.Tx, local SyncOrder, ip, hold string) (SyncMapping, error) {
+	mapping := SyncMapping{LocalID: local.LocalID}
+	local.LocalID = strings.TrimSpace(local.LocalID)
+	if local.LocalID == "" {
+		return mapping, errors.New("id is required")
+	}
+	if err := validateOrderRequest(local.OrderRequest); err != nil {
+		return mapping, err
+	}
+
+	now := time.Now()
+	// Stored like the times of orders made here, so they compare as equals
+	createdAt := local.CreatedAt.Local()
+	if local.CreatedAt.IsZero() || createdAt.After(now) {
+		createdAt = now
+	}
+	if oldest := now.Add(-syncMaxAge); createdAt.Before(oldest) {
+		createdAt = oldest
+	}
+
+	syncs := NewOrderSyncRepository(tx)
+	orders := &orderService{
+		orderRepo:  NewOrderRepository(tx),
+		clientRepo: NewClientRepository(tx),
+		pricing:    s.pricing,
+	}
+	existingID, err := findSyncedOrder(orders.orderRepo, syncs, local, createdAt)
+	if err == nil {
+		mapping.ID, mapping.Result = existingID, "existing"
+		return mapping, syncs.Record(local.LocalID, local.Email, existingID, now)
+	}
+	if err != sql.ErrNoRows {
+		return mapping, err
+	}
+
+	verdict, err := s.guard.CheckSynced(local.OrderRequest, ip, now, hold)
+	if err != nil {
+		return mapping, err
+	}
+	// Like the order form, bots can't tell a dropped order from a real one
+	if verdict.Drop {
+		mapping.ID, mapping.Result = generateOrderID(), "created"
+		return mapping, nil
+	}
+
+	req := local.OrderRequest
+	if verdict.Quarantine != "" {
+		req.Status = orderQuarantined
+	}
+	order, err := newOrderFromRequest(req, createdAt)
+	if err != nil {
+		return mapping, err
+	}
+
+	// Priced now: a made-up creation time mustn't dodge the rush multiplier
+	estimate := s.pricing.Estimate(req, now)
+	estimateJSON, _ := json.Marshal(estimate)
+	order.EstimatedPrice = estimate.Total
+	order.Estimate = string(estimateJSON)
+	order.EstimatedHours = estimate.Hours
+
+	if err := orders.orderRepo.Create(order); err != nil {
+		return mapping, err
+	}
+	if verdict.Quarantine != "" {
+		err = NewQuarantineRepository(tx).Create(order.ID, verdict.Quarantine, ip, now)
+	} else {
+		err = orders.updateClientRecord(req.Email, req.ClientName, req.Phone, req.Company, createdAt)
+	}
+	if err != nil {
+		return mapping, err
+	}
+	if err := syncs.Record(local.LocalID, local.Email, order.ID, now); err != nil {
+		return mapping, err
+	}
+
+	mapping.ID, mapping.Result = order.ID, "created"
+	return mapping, nil
+}
+
+// findSyncedOrder finds the server order a local one already became: from
+// an earlier sync, an import that kept its local ID, or the API call that
+// seemed to fail but had gone through.
+func findSyncedOrder(orderRepo OrderRepository, syncs OrderSyncRepository, local SyncOrder, createdAt time.Time) (string, error) {
+	if id, err := syncs.GetOrderID(local.LocalID, local.Email); err != sql.ErrNoRows {
+		return id, err
+	}
+
+	order, err := orderRepo.GetByID(local.LocalID)
+	if err == nil && order.Email == local.Email {
+		return order.ID, nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+
+	return syncs.FindMatch(local.Email, local.ProjectTitle, createdAt)
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type SyncHandler struct {
+	service SyncService
+}
+
+func NewSyncHandler(service SyncService) *SyncHandler {
+	return &SyncHandler{service: service}
+}
+
+func (h *SyncHandler) SyncOrders(c *gin.Context) {
+	var req SyncRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	report, err := h.service.SyncOrders(req, c.ClientIP())
+	if err == ErrSyncBatchTooLarge || err == ErrCaptchaFailed {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Synced %d of %d orders", report.Created+report.Existing, len(req.Orders)),
+		Data:    report,
+	})
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// MODELS
+// ====================
+
+// Workload summarises what is on one artist's plate. Assignee is nil for
+// the bucket of unassigned work.
+type Workload struct {
+	Assignee          *User              `json:"assignee"`
+	OpenOrders        int                `json:"openOrders"`
+	Projects          int                `json:"projects"`
+	EstimatedHours    float64            `json:"estimatedHours"`
+	Overdue           int                `json:"overdue"`
+	AtRisk            int                `json:"atRisk"`
+	UpcomingDeadlines []WorkloadDeadline `json:"upcomingDeadlines"`
+}
+
+type WorkloadDeadline struct {
+	Kind       string    `json:"kind"` // order, project or milestone
+	ID         string    `json:"id"`
+	Title      string    `json:"title"`
+	ClientName string    `json:"clientName"`
+	DeadlineAt time.Time `json:"deadlineAt"`
+	DaysLeft   int       `json:"daysLeft"`
+}
+
+// ====================
+// DTOs
+// ====================
+
+type MemberRequest struct {
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Role     string `json:"role"` // defaults to artist
+	Password string `json:"password"`
+}
+
+var (
+	ErrUnknownAssignee = errors.New("assignee is not a known user")
+	ErrInvalidMember   = errors.New("username, email and a password of at least 8 characters are required")
+	ErrUnknownRole     = errors.New("role must be administrator or artist")
+	ErrUsernameTaken   = errors.New("username is already taken")
+)
+
+// checkAssignee accepts an empty ID (unassigned) or the ID of a user.
+func checkAssignee(users UserRepository, id string) error {
+	if id == "" {
+		return nil
+	}
+
+	_, err := users.GetByID(id)
+	if err == sql.ErrNoRows {
+		return ErrUnknownAssignee
+	}
+	return err
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type TeamService interface {
+	GetMembers() ([]User, error)
+	CreateMember(req MemberRequest) (*User, error)
+	GetWorkload(within time.Duration, now time.Time) ([]Workload, error)
+}
+
+type teamService struct {
+	db *sql.DB
+}
+
+func NewTeamService(db *sql.DB) TeamService {
+	return &teamService{db: db}
+}
+
+func (s *teamService) GetMembers() ([]User, error) {
+	return NewUserRepository(s.db).GetAll()
+}
+
+func (s *teamService) CreateMember(req MemberRequest) (*User, error) {
+	username := strings.TrimSpace(req.Username)
+	email := strings.TrimSpace(req.Email)
+	if username == "" || email == "" || len(req.Password) < 8 {
+		return nil, ErrInvalidMember
+	}
+	if req.Role == "" {
+		req.Role = roleArtist
+	}
+	if req.Role != roleArtist && req.Role != roleAdministrator {
+		return nil, ErrUnknownRole
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = username
+	}
+
+	repo := NewUserRepository(s.db)
+	if _, err := repo.GetByUsername(username); err == nil {
+		return nil, ErrUsernameTaken
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	return createUser(repo, username, name, email, req.Role, req.Password)
+}
+
+// GetWorkload returns one entry per team member plus a final entry for
+// unassigned work. Upcoming deadlines are those due before now+within,
+// overdue ones included, soonest first.
+func (s *teamService) GetWorkload(within time.Duration, now time.Time) ([]Workload, error) {
+	users, err := NewUserRepository(s.db).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	orders, err := NewOrderRepository(s.db).GetOpen()
+	if err != nil {
+		return nil, err
+	}
+	projects, err := NewProjectRepository(s.db).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	milestones, err := NewMilestoneRepository(s.db).GetOpenWithDueDate()
+	if err != nil {
+		return nil, err
+	}
+
+	byAssignee := map[string]*Workload{}
+	result := make([]Workload, len(users)+1)
+	for i := range users {
+		result[i].Assignee = &users[i]
+		byAssignee[users[i].ID] = &result[i]
+	}
+	unassigned := &result[len(users)]
+	workloadFor := func(assigneeID string) *Workload {
+		// Work assigned to a deleted user counts as unassigned
+		if w, ok := byAssignee[assigneeID]; ok {
+			return w
+		}
+		return unassigned
+	}
+
+	cutoff := daysUntil(now.Add(within), now)
+	upcoming := func(w *Workload, d WorkloadDeadline) {
+		d.DaysLeft = daysUntil(d.DeadlineAt, now)
+		if d.DaysLeft <= cutoff {
+			w.UpcomingDeadlines = append(w.UpcomingDeadlines, d)
+		}
+	}
+
+	for i := range orders {
+		o := &orders[i]
+		w := workloadFor(o.AssigneeID)
+		w.OpenOrders++
+		w.EstimatedHours += o.EstimatedHours
+		switch deadlineState(o, now) {
+		case "overdue":
+			w.Overdue++
+		case "at-risk":
+			w.AtRisk++
+		}
+		if o.DeadlineAt != nil {
+			upcoming(w, WorkloadDeadline{Kind: "order", ID: o.ID, Title: o.ProjectTitle,
+				ClientName: o.ClientName, DeadlineAt: *o.DeadlineAt})
+		}
+	}
+
+	projectsByID := map[int]*Project{}
+	for i := range projects {
+		p := &projects[i]
+		projectsByID[p.ID] = p
+		w := workloadFor(p.AssigneeID)
+		w.Projects++
+		// Projects have no status, so a passed deadline is not listed
+		if p.DeadlineAt != nil && daysUntil(*p.DeadlineAt, now) >= 0 {
+			upcoming(w, WorkloadDeadline{Kind: "project", ID: strconv.Itoa(p.ID), Title: p.ProjectTitle,
+				ClientName: p.ClientName, DeadlineAt: *p.DeadlineAt})
+		}
+	}
+
+	for _, m := range milestones {
+		p, ok := projectsByID[m.ProjectID]
+		if !ok {
+			continue
+		}
+		upcoming(workloadFor(p.AssigneeID), WorkloadDeadline{Kind: "milestone", ID: strconv.Itoa(m.ID),
+			Title: m.Name + ": " + p.ProjectTitle, ClientName: p.ClientName, DeadlineAt: *m.DueDate})
+	}
+
+	for i := range result {
+		w := &result[i]
+		w.EstimatedHours = math.Round(w.EstimatedHours*2) / 2
+		if w.UpcomingDeadlines == nil {
+			w.UpcomingDeadlines = []WorkloadDeadline{}
+		}
+		sort.SliceStable(w.UpcomingDeadlines, func(a, b int) bool {
+			return w.UpcomingDeadlines[a].DeadlineAt.Before(w.UpcomingDeadlines[b].DeadlineAt)
+		})
+	}
+
+	return result, nil
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type TeamHandler struct {
+	service TeamService
+}
+
+func NewTeamHandler(service TeamService) *TeamHandler {
+	return &TeamHandler{service: service}
+}
+
+func (h *TeamHandler) GetMembers(c *gin.Context) {
+	users, err := h.service.GetMembers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    users,
+	})
+}
+
+func (h *TeamHandler) CreateMember(c *gin.Context) {
+	var req MemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	user, err := h.service.CreateMember(req)
+	if err == ErrInvalidMember || err == ErrUnknownRole {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err == ErrUsernameTaken {
+		c.JSON(http.StatusConflict, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, APIResponse{
+		Success: true,
+		Message: "Team member created successfully",
+		Data:    user,
+	})
+}
+
+func (h *TeamHandler) GetWorkload(c *gin.Context) {
+	within, err := parseWithin(c.DefaultQuery("within", "14d"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	workload, err := h.service.GetWorkload(within, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    workload,
+	})
+}
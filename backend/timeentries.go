@@ -0,0 +1,539 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// MODELS
+// ====================
+
+// TimeEntry is time a user spent on an order or a project. A running timer
+// has no EndedAt; its Minutes count up to the time it was read.
+type TimeEntry struct {
+	ID        int        `json:"id" db:"id"`
+	UserID    string     `json:"userId" db:"user_id"`
+	OrderID   string     `json:"orderId" db:"order_id"`
+	ProjectID *int       `json:"projectId" db:"project_id"`
+	Note      string     `json:"note" db:"note"`
+	StartedAt time.Time  `json:"startedAt" db:"started_at"`
+	EndedAt   *time.Time `json:"endedAt" db:"ended_at"`
+	Running   bool       `json:"running"`
+	Minutes   int        `json:"minutes"`
+	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// OrderProfitability compares tracked time against what the order earns.
+// Orders without a final price are measured against their estimate.
+type OrderProfitability struct {
+	OrderID             string  `json:"orderId"`
+	Price               float64 `json:"price"`
+	PriceBasis          string  `json:"priceBasis"` // final, estimate or none
+	EstimatedHours      float64 `json:"estimatedHours"`
+	TrackedHours        float64 `json:"trackedHours"`
+	EffectiveHourlyRate float64 `json:"effectiveHourlyRate"` // 0 until time is tracked
+	Entries             int     `json:"entries"`
+}
+
+// ====================
+// DTOs
+// ====================
+
+type TimerRequest struct {
+	OrderID   string `json:"orderId"`
+	ProjectID *int   `json:"projectId"`
+	Note      string `json:"note"`
+}
+
+// TimeEntryRequest logs time after the fact, either as a start and end or
+// as a start and a number of minutes.
+type TimeEntryRequest struct {
+	OrderID   string     `json:"orderId"`
+	ProjectID *int       `json:"projectId"`
+	Note      string     `json:"note"`
+	StartedAt time.Time  `json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt"`
+	Minutes   int        `json:"minutes"`
+}
+
+type TimeEntryFilter struct {
+	UserID    string
+	OrderID   string
+	ProjectID int
+	From      time.Time
+	To        time.Time
+}
+
+var (
+	ErrTimeTarget       = errors.New("time entries need either an orderId or a projectId")
+	ErrInvalidTimeRange = errors.New("startedAt is required and the entry must end after it starts")
+	ErrNoRunningTimer   = errors.New("no timer is running")
+)
+
+// entryMinutes counts whole minutes, running timers up to now.
+func entryMinutes(e *TimeEntry, now time.Time) int {
+	end := now
+	if e.EndedAt != nil {
+		end = *e.EndedAt
+	}
+	return int(end.Sub(e.StartedAt) / time.Minute)
+}
+
+// ====================
+// REPOSITORIES
+// ====================
+
+type TimeEntryRepository interface {
+	Create(e *TimeEntry) error
+	GetByID(id int) (*TimeEntry, error)
+	GetAll(filter TimeEntryFilter) ([]TimeEntry, error)
+	GetRunning(userID string) (*TimeEntry, error)
+	Stop(id int, endedAt time.Time) error
+	Delete(id int) error
+	DeleteByOrder(orderID string) error
+	DeleteByProject(projectID int) error
+}
+
+type timeEntryRepository struct {
+	db DBTX
+}
+
+func NewTimeEntryRepository(db DBTX) TimeEntryRepository {
+	return &timeEntryRepository{db: db}
+}
+
+const timeEntryColumns = `id, user_id, order_id, project_id, note, started_at, ended_at, created_at`
+
+func scanTimeEntry(row rowScanner) (*TimeEntry, error) {
+	var e TimeEntry
+	var projectID sql.NullInt64
+	var endedAt sql.NullTime
+
+	err := row.Scan(&e.ID, &e.UserID, &e.OrderID, &projectID, &e.Note, &e.StartedAt, &endedAt, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if projectID.Valid {
+		id := int(projectID.Int64)
+		e.ProjectID = &id
+	}
+	if endedAt.Valid {
+		e.EndedAt = &endedAt.Time
+	}
+	e.Running = e.EndedAt == nil
+	e.Minutes = entryMinutes(&e, time.Now())
+
+	return &e, nil
+}
+
+func (r *timeEntryRepository) Create(e *TimeEntry) error {
+	result, err := r.db.Exec(`
+		INSERT INTO time_entries (user_id, order_id, project_id, note, started_at, ended_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, e.UserID, e.OrderID, e.ProjectID, e.Note, e.StartedAt, e.EndedAt, e.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	e.ID = int(id)
+
+	return nil
+}
+
+func (r *timeEntryRepository) GetByID(id int) (*TimeEntry, error) {
+	return scanTimeEntry(r.db.QueryRow("SELECT "+timeEntryColumns+" FROM time_entries WHERE id = ?", id))
+}
+
+func (r *timeEntryRepository) GetAll(filter TimeEntryFilter) ([]TimeEntry, error) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.UserID != "" {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if filter.OrderID != "" {
+		conditions = append(conditions, "order_id = ?")
+		args = append(args, filter.OrderID)
+	}
+	if filter.ProjectID != 0 {
+		conditions = append(conditions, "project_id = ?")
+		args = append(args, filter.ProjectID)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "started_at >= ?")
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "started_at < ?")
+		args = append(args, filter.To)
+	}
+
+	query := "SELECT " + timeEntryColumns + " FROM time_entries"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	rows, err := r.db.Query(query+" ORDER BY started_at DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []TimeEntry{}
+	for rows.Next() {
+		e, err := scanTimeEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *e)
+	}
+
+	return entries, rows.Err()
+}
+
+func (r *timeEntryRepository) GetRunning(userID string) (*TimeEntry, error) {
+	return scanTimeEntry(r.db.QueryRow("SELECT "+timeEntryColumns+
+		" FROM time_entries WHERE user_id = ? AND ended_at IS NULL ORDER BY started_at DESC LIMIT 1", userID))
+}
+
+func (r *timeEntryRepository) Stop(id int, endedAt time.Time) error {
+	result, err := r.db.Exec("UPDATE time_entries SET ended_at = ? WHERE id = ? AND ended_at IS NULL", endedAt, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *timeEntryRepository) Delete(id int) error {
+	result, err := r.db.Exec("DELETE FROM time_entries WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *timeEntryRepository) DeleteByOrder(orderID string) error {
+	_, err := r.db.Exec("DELETE FROM time_entries WHERE order_id = ?", orderID)
+	return err
+}
+
+func (r *timeEntryRepository) DeleteByProject(projectID int) error {
+	_, err := r.db.Exec("DELETE FROM time_entries WHERE project_id = ?", projectID)
+	return err
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type TimeTrackingService interface {
+	StartTimer(user *User, req TimerRequest) (*TimeEntry, error)
+	StopTimer(user *User) (*TimeEntry, error)
+	LogTime(user *User, req TimeEntryRequest) (*TimeEntry, error)
+	GetEntries(filter TimeEntryFilter) ([]TimeEntry, error)
+	DeleteEntry(user *User, id int) error
+	GetOrderProfitability(orderID string) (*OrderProfitability, error)
+}
+
+type timeTrackingService struct {
+	db *sql.DB
+}
+
+func NewTimeTrackingService(db *sql.DB) TimeTrackingService {
+	return &timeTrackingService{db: db}
+}
+
+// checkTimeTarget makes sure the entry points at exactly one existing order or
+// project. A missing one is reported as sql.ErrNoRows.
+func checkTimeTarget(db DBTX, orderID string, projectID *int) error {
+	switch {
+	case (orderID == "") == (projectID == nil):
+		return ErrTimeTarget
+	case orderID != "":
+		_, err := NewOrderRepository(db).GetByID(orderID)
+		return err
+	default:
+		_, err := NewProjectRepository(db).GetByID(*projectID)
+		return err
+	}
+}
+
+// StartTimer stops the user's running timer, if any, and starts a new one;
+// a user only works on one thing at a time.
+func (s *timeTrackingService) StartTimer(user *User, req TimerRequest) (*TimeEntry, error) {
+	req.OrderID = strings.TrimSpace(req.OrderID)
+	if err := checkTimeTarget(s.db, req.OrderID, req.ProjectID); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	repo := NewTimeEntryRepository(tx)
+	now := time.Now()
+	if running, err := repo.GetRunning(user.ID); err == nil {
+		if err := repo.Stop(running.ID, now); err != nil {
+			return nil, err
+		}
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	entry := &TimeEntry{
+		UserID:    user.ID,
+		OrderID:   req.OrderID,
+		ProjectID: req.ProjectID,
+		Note:      strings.TrimSpace(req.Note),
+		StartedAt: now,
+		Running:   true,
+		CreatedAt: now,
+	}
+	if err := repo.Create(entry); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (s *timeTrackingService) StopTimer(user *User) (*TimeEntry, error) {
+	repo := NewTimeEntryRepository(s.db)
+	running, err := repo.GetRunning(user.ID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoRunningTimer
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := repo.Stop(running.ID, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(running.ID)
+}
+
+func (s *timeTrackingService) LogTime(user *User, req TimeEntryRequest) (*TimeEntry, error) {
+	req.OrderID = strings.TrimSpace(req.OrderID)
+	if req.EndedAt == nil && req.Minutes > 0 {
+		end := req.StartedAt.Add(time.Duration(req.Minutes) * time.Minute)
+		req.EndedAt = &end
+	}
+	if req.StartedAt.IsZero() || req.EndedAt == nil || !req.EndedAt.After(req.StartedAt) {
+		return nil, ErrInvalidTimeRange
+	}
+	if err := checkTimeTarget(s.db, req.OrderID, req.ProjectID); err != nil {
+		return nil, err
+	}
+
+	entry := &TimeEntry{
+		UserID:    user.ID,
+		OrderID:   req.OrderID,
+		ProjectID: req.ProjectID,
+		Note:      strings.TrimSpace(req.Note),
+		StartedAt: req.StartedAt,
+		EndedAt:   req.EndedAt,
+		CreatedAt: time.Now(),
+	}
+	entry.Minutes = entryMinutes(entry, entry.CreatedAt)
+	if err := NewTimeEntryRepository(s.db).Create(entry); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (s *timeTrackingService) GetEntries(filter TimeEntryFilter) ([]TimeEntry, error) {
+	return NewTimeEntryRepository(s.db).GetAll(filter)
+}
+
+// DeleteEntry lets users remove their own entries; administrators can
+// remove anyone's.
+func (s *timeTrackingService) DeleteEntry(user *User, id int) error {
+	repo := NewTimeEntryRepository(s.db)
+	entry, err := repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if entry.UserID != user.ID && user.Role != roleAdministrator {
+		return sql.ErrNoRows
+	}
+
+	return repo.Delete(id)
+}
+
+func (s *timeTrackingService) GetOrderProfitability(orderID string) (*OrderProfitability, error) {
+	order, err := NewOrderRepository(s.db).GetByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := NewTimeEntryRepository(s.db).GetAll(TimeEntryFilter{OrderID: orderID})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &OrderProfitability{
+		OrderID:        orderID,
+		PriceBasis:     "none",
+		EstimatedHours: order.EstimatedHours,
+		Entries:        len(entries),
+	}
+	switch {
+	case order.FinalPrice > 0:
+		result.Price, result.PriceBasis = order.FinalPrice, "final"
+	case order.EstimatedPrice > 0:
+		result.Price, result.PriceBasis = order.EstimatedPrice, "estimate"
+	}
+
+	minutes := 0
+	for _, e := range entries {
+		minutes += e.Minutes
+	}
+	result.TrackedHours = math.Round(float64(minutes)/60*100) / 100
+	if minutes > 0 {
+		result.EffectiveHourlyRate = roundMoney(result.Price / (float64(minutes) / 60))
+	}
+
+	return result, nil
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type TimeTrackingHandler struct {
+	service TimeTrackingService
+}
+
+func NewTimeTrackingHandler(service TimeTrackingService) *TimeTrackingHandler {
+	return &TimeTrackingHandler{service: service}
+}
+
+func (h *TimeTrackingHandler) StartTimer(c *gin.Context) {
+	var req TimerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	entry, err := h.service.StartTimer(currentUser(c), req)
+	h.respond(c, http.StatusCreated, "Timer started", entry, err)
+}
+
+func (h *TimeTrackingHandler) StopTimer(c *gin.Context) {
+	entry, err := h.service.StopTimer(currentUser(c))
+	h.respond(c, http.StatusOK, "Timer stopped", entry, err)
+}
+
+func (h *TimeTrackingHandler) LogTime(c *gin.Context) {
+	var req TimeEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	entry, err := h.service.LogTime(currentUser(c), req)
+	h.respond(c, http.StatusCreated, "Time entry created successfully", entry, err)
+}
+
+// GetEntries lists entries, filtered by the userId, orderId, projectId,
+// from and to (YYYY-MM-DD, inclusive) query parameters.
+func (h *TimeTrackingHandler) GetEntries(c *gin.Context) {
+	filter := TimeEntryFilter{
+		UserID:  c.Query("userId"),
+		OrderID: c.Query("orderId"),
+	}
+	filter.ProjectID, _ = strconv.Atoi(c.Query("projectId"))
+	if from, err := time.Parse("2006-01-02", c.Query("from")); err == nil {
+		filter.From = from
+	}
+	if to, err := time.Parse("2006-01-02", c.Query("to")); err == nil {
+		filter.To = to.AddDate(0, 0, 1)
+	}
+
+	entries, err := h.service.GetEntries(filter)
+	h.respond(c, http.StatusOK, "", entries, err)
+}
+
+func (h *TimeTrackingHandler) DeleteEntry(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	err := h.service.DeleteEntry(currentUser(c), id)
+	h.respond(c, http.StatusOK, "Time entry deleted successfully", nil, err)
+}
+
+func (h *TimeTrackingHandler) GetOrderProfitability(c *gin.Context) {
+	result, err := h.service.GetOrderProfitability(c.Param("id"))
+	h.respond(c, http.StatusOK, "", result, err)
+}
+
+func (h *TimeTrackingHandler) respond(c *gin.Context, status int, message string, data interface{}, err error) {
+	if err == sql.ErrNoRows || err == ErrNoRunningTimer {
+		msg := "Not found"
+		if err == ErrNoRunningTimer {
+			msg = err.Error()
+		}
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: msg,
+		})
+		return
+	}
+	if err == ErrTimeTarget || err == ErrInvalidTimeRange {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(status, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    data,
+	})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====================
+// MODELS
+// ====================
+
+// TrackedOrder is the redacted view behind a tracking link. Anyone with
+// the link can see it, so it carries no names, contact details or prices.
+type TrackedOrder struct {
+	OrderID        string          `json:"orderId"`
+	Status         string          `json:"status"`
+	Deadline       string          `json:"deadline"`
+	DeadlineAt     *time.Time      `json:"deadlineAt"`
+	RevisionRounds RevisionRounds  `json:"revisionRounds"`
+	LatestMessage  *TrackedMessage `json:"latestMessage"`
+	UpdatedAt      time.Time       `json:"updatedAt"`
+}
+
+// RevisionRounds compares the rounds agreed on the order with the previews
+// the client sent back for changes.
+type RevisionRounds struct {
+	Included string `json:"included"`
+	Used     int    `json:"used"`
+}
+
+type TrackedMessage struct {
+	Author    string    `json:"author"` // client or studio
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// trackingPath is where the client-facing site shows a tracking link.
+const trackingPath = "/track/"
+
+// backfillTrackingTokens gives orders created before tracking links existed
+// a token, so the studio can still share one with the client.
+func backfillTrackingTokens(db *sql.DB) error {
+	rows, err := db.Query("SELECT id FROM orders WHERE tracking_token IS NULL OR tracking_token = ''")
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		token, err := generateToken()
+		if err != nil {
+			return err
+		}
+		if _, err := db.Exec("UPDATE orders SET tracking_token = ? WHERE id = ?", token, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ====================
+// SERVICES
+// ====================
+
+type TrackingService interface {
+	GetTrackedOrder(token string) (*TrackedOrder, error)
+}
+
+type trackingService struct {
+	db *sql.DB
+}
+
+func NewTrackingService(db *sql.DB) TrackingService {
+	return &trackingService{db: db}
+}
+
+func (s *trackingService) GetTrackedOrder(token string) (*TrackedOrder, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, sql.ErrNoRows
+	}
+	order, err := NewOrderRepository(s.db).GetByTrackingToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	deliverables, err := NewDeliverableRepository(s.db).GetByOrder(order.ID)
+	if err != nil {
+		return nil, err
+	}
+	used := 0
+	for _, d := range deliverables {
+		if d.Review == "changes-requested" {
+			used++
+		}
+	}
+
+	// A held order looks like any other new order from outside
+	status := order.Status
+	if status == orderQuarantined {
+		status = "pending"
+	}
+
+	tracked := &TrackedOrder{
+		OrderID:        order.ID,
+		Status:         status,
+		Deadline:       order.Deadline,
+		DeadlineAt:     order.DeadlineAt,
+		RevisionRounds: RevisionRounds{Included: order.RevisionRounds, Used: used},
+		UpdatedAt:      order.UpdatedAt,
+	}
+
+	messages, err := NewMessageRepository(s.db).GetByOrder(order.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) > 0 {
+		latest := messages[len(messages)-1]
+		tracked.LatestMessage = &TrackedMessage{Author: latest.Author, Body: latest.Body, CreatedAt: latest.CreatedAt}
+	}
+
+	return tracked, nil
+}
+
+// ====================
+// HANDLERS
+// ====================
+
+type TrackingHandler struct {
+	service TrackingService
+}
+
+func NewTrackingHandler(service TrackingService) *TrackingHandler {
+	return &TrackingHandler{service: service}
+}
+
+func (h *TrackingHandler) GetTrackedOrder(c *gin.Context) {
+	tracked, err := h.service.GetTrackedOrder(c.Param("token"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Order not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    tracked,
+	})
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// WatermarkSettings controls how previews of unpaid work are rendered. A
+// logo replaces the text when both are set.
+type WatermarkSettings struct {
+	Text        string
+	Logo        image.Image
+	Opacity     float64 // 0-1
+	Tiled       bool    // repeat across the image rather than stamp once
+	PreviewEdge int     // longest edge of the preview in pixels
+}
+
+func defaultWatermarkSettings() WatermarkSettings {
+	return WatermarkSettings{
+		Text:        "PREVIEW",
+		Opacity:     0.35,
+		Tiled:       true,
+		PreviewEdge: 1280,
+	}
+}
+
+// loadWatermarkSettings turns the checked config into settings, reading
+// the logo file if there is one.
+func loadWatermarkSettings(cfg WatermarkConfig) (WatermarkSettings, error) {
+	w := WatermarkSettings{
+		Text:        strings.TrimSpace(cfg.Text),
+		Opacity:     cfg.Opacity,
+		Tiled:       cfg.Tiled,
+		PreviewEdge: cfg.PreviewMaxEdge,
+	}
+	if w.Text == "" {
+		w.Text = defaultWatermarkSettings().Text
+	}
+	if cfg.Logo != "" {
+		data, err := os.ReadFile(cfg.Logo)
+		if err != nil {
+			return w, err
+		}
+		if w.Logo, _, err = image.Decode(bytes.NewReader(data)); err != nil {
+			return w, err
+		}
+	}
+
+	return w, nil
+}
+
+var watermarkFont, _ = opentype.Parse(gobold.TTF)
+
+// renderPreview shrinks img to the preview size and stamps the watermark
+// over it. Tiled stamps are staggered row by row so no strip of the image
+// is left clean.
+func renderPreview(img image.Image, w WatermarkSettings) image.Image {
+	scaled := scaleToFit(img, w.PreviewEdge)
+	b := scaled.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), scaled, b.Min, draw.Src)
+
+	share := 2 // stamp width as a fraction of the preview, 1/share
+	if w.Tiled {
+		share = 4
+	}
+	stamp := watermarkStamp(w, dst.Bounds().Dx()/share)
+	if stamp == nil {
+		return dst
+	}
+
+	mask := image.NewUniform(color.Alpha{A: uint8(w.Opacity * 255)})
+	sw, sh := stamp.Bounds().Dx(), stamp.Bounds().Dy()
+	place := func(x, y int) {
+		r := image.Rect(x, y, x+sw, y+sh)
+		draw.DrawMask(dst, r, stamp, stamp.Bounds().Min, mask, image.Point{}, draw.Over)
+	}
+
+	if !w.Tiled {
+		place((dst.Bounds().Dx()-sw)/2, (dst.Bounds().Dy()-sh)/2)
+		return dst
+	}
+
+	stepX, stepY := sw*3/2, sh*3
+	for row, y := 0, -sh/2; y < dst.Bounds().Dy(); row, y = row+1, y+stepY {
+		offset := 0
+		if row%2 == 1 {
+			offset = stepX / 2
+		}
+		for x := -offset; x < dst.Bounds().Dx(); x += stepX {
+			place(x, y)
+		}
+	}
+	return dst
+}
+
+// watermarkStamp draws the logo, or the text, about width pixels wide.
+func watermarkStamp(w WatermarkSettings, width int) image.Image {
+	if width < 16 {
+		width = 16
+	}
+
+	if w.Logo != nil {
+		lb := w.Logo.Bounds()
+		height := max(1, lb.Dy()*width/lb.Dx())
+		stamp := image.NewNRGBA(image.Rect(0, 0, width, height))
+		xdraw.CatmullRom.Scale(stamp, stamp.Bounds(), w.Logo, lb, draw.Src, nil)
+		return stamp
+	}
+	if w.Text == "" || watermarkFont == nil {
+		return nil
+	}
+
+	// Size the font so the text spans the requested width
+	size := float64(width) / float64(len([]rune(w.Text))) * 1.6
+	face, err := opentype.NewFace(watermarkFont, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil
+	}
+	defer face.Close()
+
+	metrics := face.Metrics()
+	textWidth := font.MeasureString(face, w.Text).Ceil()
+	shadow := max(1, int(size/24))
+	stamp := image.NewNRGBA(image.Rect(0, 0, textWidth+shadow, (metrics.Ascent+metrics.Descent).Ceil()+shadow))
+
+	// A dark offset copy keeps white text readable on light artwork
+	for _, layer := range []struct {
+		offset int
+		color  color.Color
+	}{{shadow, color.Black}, {0, color.White}} {
+		d := &font.Drawer{
+			Dst:  stamp,
+			Src:  image.NewUniform(layer.color),
+			Face: face,
+			Dot:  fixed.P(layer.offset, metrics.Ascent.Ceil()+layer.offset),
+		}
+		d.DrawString(w.Text)
+	}
+	return stamp
+}